@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func addAddOnRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/addons", GetAddOns(db))
+	router.GET("/addons/:pid/:timestamp", GetDepartureAddOns(db))
+	router.PUT("/addons", checkJWT(), logActionMiddle(db), SaveAddOn(db))
+	router.DELETE("/addons/:id", checkJWT(), logActionMiddle(db), DeleteAddOn(db))
+}
+
+// GetAddOns lists the merchant's add-ons, optionally only those of the
+// ?product= given
+func GetAddOns(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := db.Where("merchant_id = ?", c.Param("merchantid"))
+		if pid := c.Query("product"); pid != "" {
+			scope = scope.Where("product_id = ?", pid)
+		}
+
+		var out []types.AddOn
+		scope.Order("product_id, name").Find(&out)
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// GetDepartureAddOns lists the add-ons that can be put in a cart for a
+// departure along with their skus and how many are left
+func GetDepartureAddOns(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pid, t, err := departureParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+		c.JSON(http.StatusOK, pricing.DepartureAddOns(db, &conf, pid, t))
+	}
+}
+
+// SaveAddOn creates or updates an add-on of one of the merchant's products
+func SaveAddOn(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var a types.AddOn
+		if err := c.ShouldBindJSON(&a); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := a.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var prod Product
+		if db.Find(&prod, "id = ? AND merchant_id = ?", a.ProductID, c.Param("merchantid")).RecordNotFound() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "product not found"})
+			return
+		}
+
+		a.MerchantID = c.Param("merchantid")
+		var old *types.AddOn
+		if a.ID != 0 {
+			old = &types.AddOn{}
+			if db.Find(old, "id = ? AND merchant_id = ?", a.ID, a.MerchantID).RecordNotFound() {
+				c.JSON(http.StatusNotFound, gin.H{"error": "add-on not found"})
+				return
+			}
+			a.CreatedAt = old.CreatedAt
+		}
+
+		db.Save(&a)
+		recordChange(c, "addon", a.ID, old, &a)
+		c.JSON(http.StatusOK, a)
+	}
+}
+
+// DeleteAddOn stops an add-on from being sold, past orders keep it
+func DeleteAddOn(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var old types.AddOn
+		if db.Find(&old, "id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid")).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "add-on not found"})
+			return
+		}
+
+		db.Delete(&old)
+		recordChange(c, "addon", old.ID, &old, nil)
+		c.Status(http.StatusOK)
+	}
+}
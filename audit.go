@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+const auditChangesKey = "audit_changes"
+
+type auditChange struct {
+	EntityType string
+	EntityID   string
+	Diff       map[string]interface{}
+}
+
+// recordChange attaches the difference between the before and after state
+// of an entity to the current request so that logActionMiddle can store it
+// alongside the log entry. Either side may be nil for creates and deletes.
+func recordChange(c *gin.Context, entityType string, entityID interface{}, before, after interface{}) {
+	diff, err := jsonDiff(before, after)
+	if err != nil {
+		log.Println("audit diff:", err)
+		return
+	}
+
+	var changes []auditChange
+	if v, ok := c.Get(auditChangesKey); ok {
+		changes = v.([]auditChange)
+	}
+
+	c.Set(auditChangesKey, append(changes, auditChange{
+		EntityType: entityType,
+		EntityID:   toString(entityID),
+		Diff:       diff,
+	}))
+}
+
+func toString(v interface{}) string {
+	switch id := v.(type) {
+	case string:
+		return id
+	case uint:
+		return strconv.FormatUint(uint64(id), 10)
+	case int:
+		return strconv.Itoa(id)
+	default:
+		data, _ := json.Marshal(id)
+		return string(data)
+	}
+}
+
+// jsonDiff compares the JSON representations of two values and returns the
+// top level keys which differ, each mapped to an object holding the old and
+// new values.
+func jsonDiff(before, after interface{}) (map[string]interface{}, error) {
+	oldMap, err := toJSONMap(before)
+	if err != nil {
+		return nil, err
+	}
+	newMap, err := toJSONMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]interface{})
+	for k, ov := range oldMap {
+		nv, ok := newMap[k]
+		if !ok || !reflect.DeepEqual(ov, nv) {
+			diff[k] = gin.H{"old": ov, "new": nv}
+		}
+	}
+	for k, nv := range newMap {
+		if _, ok := oldMap[k]; !ok {
+			diff[k] = gin.H{"old": nil, "new": nv}
+		}
+	}
+	return diff, nil
+}
+
+func toJSONMap(v interface{}) (map[string]interface{}, error) {
+	ret := make(map[string]interface{})
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return ret, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ret, json.Unmarshal(data, &ret)
+}
+
+func toJsonb(data []byte) postgres.Jsonb {
+	if len(data) == 0 || !json.Valid(data) {
+		data = []byte("null")
+	}
+	return postgres.Jsonb{RawMessage: json.RawMessage(data)}
+}
+
+var userNames = struct {
+	sync.RWMutex
+	names map[string]string
+}{names: make(map[string]string)}
+
+// userDisplayName looks up the name for an auth0 user, caching the result
+// so we aren't hitting the management api for every logged request.
+func userDisplayName(userid string) string {
+	userNames.RLock()
+	name, ok := userNames.names[userid]
+	userNames.RUnlock()
+	if ok {
+		return name
+	}
+
+	u := auth0Client.GetUserByID(userid)
+	if u == nil {
+		return ""
+	}
+
+	name = u.Name
+	if name == "" {
+		name = u.Email
+	}
+	if name == "" {
+		return ""
+	}
+
+	userNames.Lock()
+	userNames.names[userid] = name
+	userNames.Unlock()
+	return name
+}
+
+func logActionMiddle(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userid, ok := c.Get("user_id")
+		if !ok {
+			return
+		}
+
+		var data []byte
+		if c.Request.Body != nil {
+			data, _ = ioutil.ReadAll(c.Request.Body)
+			c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(data))
+		}
+
+		c.Next()
+
+		l := types.LogAction{
+			MerchantID: c.Param("merchantid"),
+			UserID:     userid.(string),
+			UserName:   userDisplayName(userid.(string)),
+			Url:        c.Request.URL.Path,
+			Method:     c.Request.Method,
+			Payload:    toJsonb(data),
+			Status:     c.Writer.Status(),
+			Diff:       toJsonb(nil),
+		}
+
+		v, ok := c.Get(auditChangesKey)
+		if !ok {
+			db.Create(&l)
+			return
+		}
+
+		for _, ch := range v.([]auditChange) {
+			entry := l
+			entry.EntityType = ch.EntityType
+			entry.EntityID = ch.EntityID
+			diff, _ := json.Marshal(ch.Diff)
+			entry.Diff = toJsonb(diff)
+			db.Create(&entry)
+		}
+	}
+}
+
+func getLogActions(db *gorm.DB) gin.HandlerFunc {
+	type LogQuery struct {
+		User     string    `form:"user"`
+		Entity   string    `form:"entity"`
+		EntityID string    `form:"entityId"`
+		From     time.Time `form:"from" time_format:"2006-01-02"`
+		To       time.Time `form:"to" time_format:"2006-01-02"`
+		Page     uint      `form:"page"`
+		PerPage  uint      `form:"perPage"`
+	}
+
+	return func(c *gin.Context) {
+		var q LogQuery
+		if err := c.ShouldBindQuery(&q); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		scope := db.Model(&types.LogAction{}).Where("merchant_id = ?", c.Param("merchantid"))
+		if q.User != "" {
+			scope = scope.Where("user_id = ?", q.User)
+		}
+		if q.Entity != "" {
+			scope = scope.Where("entity_type = ?", q.Entity)
+		}
+		if q.EntityID != "" {
+			scope = scope.Where("entity_id = ?", q.EntityID)
+		}
+		if !q.From.IsZero() {
+			scope = scope.Where("created_at >= ?", time.Date(q.From.Year(), q.From.Month(), q.From.Day(), 0, 0, 0, 0, loc))
+		}
+		if !q.To.IsZero() {
+			scope = scope.Where("created_at < ?", time.Date(q.To.Year(), q.To.Month(), q.To.Day()+1, 0, 0, 0, 0, loc))
+		}
+
+		var count uint
+		scope.Count(&count)
+
+		if q.PerPage > 0 {
+			if q.Page == 0 {
+				q.Page = 1
+			}
+			scope = scope.Offset((q.Page - 1) * q.PerPage).Limit(q.PerPage)
+		}
+
+		var logs []types.LogAction
+		scope.Order("created_at DESC").Find(&logs)
+
+		// the count is a header so the response is still the plain list
+		// existing clients expect
+		c.Header("X-Total-Count", strconv.FormatUint(uint64(count), 10))
+		c.JSON(http.StatusOK, logs)
+	}
+}
+
+// auditRetention reads the number of days to keep audit log entries from
+// $AUDIT_RETENTION_DAYS, zero or unset means keep them forever.
+func auditRetention() time.Duration {
+	days, _ := strconv.Atoi(os.Getenv("AUDIT_RETENTION_DAYS"))
+	if days <= 0 {
+		return 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func purgeLogActions(db *gorm.DB, retention time.Duration) {
+	res := db.Unscoped().Where("created_at < ?", time.Now().Add(-retention)).Delete(&types.LogAction{})
+	if res.Error != nil {
+		log.Println("audit purge:", res.Error)
+		return
+	}
+	if res.RowsAffected > 0 {
+		log.Println("audit purge: removed", res.RowsAffected, "log entries")
+	}
+}
+
+// runAuditPurge removes expired log entries once a day until the
+// context is cancelled.
+func runAuditPurge(ctx context.Context, db *gorm.DB) {
+	retention := auditRetention()
+	if retention == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	purgeLogActions(db, retention)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purgeLogActions(db, retention)
+		}
+	}
+}
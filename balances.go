@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/internal"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func addBalanceRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/balances", checkJWT(), GetBalances(db))
+	router.GET("/balances/:token", GetBalance(db))
+	router.POST("/balances/:token/capture", CaptureBalance(db))
+	router.POST("/balances/:token/remind", checkJWT(), logActionMiddle(db), RemindBalance(db))
+	router.DELETE("/balances/:token", checkJWT(), logActionMiddle(db), CancelBalance(db))
+}
+
+// GetBalances lists the merchant's balances due, soonest first, optionally
+// only those with the given ?status=
+func GetBalances(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := db.Where("merchant_id = ?", c.Param("merchantid"))
+		if st := c.Query("status"); st != "" {
+			scope = scope.Where("status = ?", st)
+		}
+
+		var out []types.BalanceDue
+		scope.Order("due_date").Find(&out)
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// GetBalance shows a customer the balance behind their payment link
+func GetBalance(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var b types.BalanceDue
+		if db.Where("merchant_id = ? AND token = ?", c.Param("merchantid"), c.Param("token")).
+			First(&b).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": types.ErrBalanceNotFound.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, b)
+	}
+}
+
+// CaptureBalance captures a PayPal order made by paypal.CreateBalanceOrder
+// and marks the balance as paid.
+func CaptureBalance(db *gorm.DB) gin.HandlerFunc {
+	env := internal.SANDBOX
+	if strings.ToLower(os.Getenv("PAYPAL_ENV")) == "live" {
+		env = internal.LIVE
+	}
+
+	type captureReq struct {
+		OrderID string `json:"orderId" binding:"required"`
+	}
+
+	return func(c *gin.Context) {
+		var req captureReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		b, err := pricing.LoadBalance(db, c.Param("merchantid"), c.Param("token"))
+		switch err {
+		case nil:
+		case types.ErrBalanceNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		var pending types.PendingOrder
+		if db.Where("id = ? AND balance_token = ? AND captured_at IS NULL", req.OrderID, b.Token).
+			First(&pending).RecordNotFound() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order isn't for this balance"})
+			return
+		}
+
+		resp, err := internal.NewClient(env).CaptureOrder(req.OrderID)
+		if err != nil {
+			c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
+			return
+		}
+		defer resp.Body.Close()
+
+		dec := json.NewDecoder(resp.Body)
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+			var f FailedCapture
+			if err = dec.Decode(&f); err != nil {
+				c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(resp.StatusCode, f)
+			return
+		}
+
+		var r CaptureResponse
+		if err = dec.Decode(&r); err != nil {
+			c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
+			return
+		}
+
+		order := AddOrderToDB(&r, db)
+		now := time.Now()
+		db.Model(&pending).Update("captured_at", &now)
+		db.Model(order).Update("commission", b.Commission.Min(b.Amount))
+
+		if err := pricing.PayBalance(db, b, order.ID); err != nil {
+			log.Println("could not pay balance:", b.Token, order.ID, err)
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "balance": b, "order": r})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"balance": b, "order": r})
+	}
+}
+
+// RemindBalance emails the customer their payment link again
+func RemindBalance(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, err := pricing.LoadBalance(db, c.Param("merchantid"), c.Param("token"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", b.MerchantID)
+		if err := internal.SendBalanceEmail(apiKey, &conf, b, true); err != nil {
+			c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
+			return
+		}
+		pricing.Reminded(db, b, time.Now())
+		c.Status(http.StatusOK)
+	}
+}
+
+// CancelBalance writes off a balance so it no longer has to be paid
+func CancelBalance(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, err := pricing.LoadBalance(db, c.Param("merchantid"), c.Param("token"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		old := *b
+		b.Status = types.BalanceCancelled
+		db.Model(b).Update("status", b.Status)
+		recordChange(c, "balance", b.ID, &old, b)
+		c.Status(http.StatusOK)
+	}
+}
+
+// runBalanceReminders marks unpaid balances overdue and emails reminders
+// for the ones coming due every hour until the context is cancelled.
+func runBalanceReminders(ctx context.Context, db *gorm.DB) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if n := pricing.MarkOverdue(db, now); n > 0 {
+			log.Printf("%d balances are now overdue", n)
+		}
+
+		for _, b := range pricing.BalancesToRemind(db, now) {
+			var conf types.MerchantConfig
+			db.Find(&conf, "id = ?", b.MerchantID)
+			if err := internal.SendBalanceEmail(apiKey, &conf, &b, true); err != nil {
+				log.Println("could not send balance reminder:", b.ID, err)
+				continue
+			}
+			pricing.Reminded(db, &b, now)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func addBlackoutRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/blackouts", GetBlackouts(db))
+	router.PUT("/blackouts", checkJWT(), logActionMiddle(db), SaveBlackout(db))
+	router.DELETE("/blackouts/:id", checkJWT(), logActionMiddle(db), DeleteBlackout(db))
+	router.GET("/holidays/:year", GetHolidays())
+	router.GET("/extras/:from/:to", GetExtraDepartures(db))
+	router.PUT("/extras", checkJWT(), logActionMiddle(db), SaveExtraDeparture(db))
+	router.DELETE("/extras/:id", checkJWT(), logActionMiddle(db), DeleteExtraDeparture(db))
+}
+
+// GetBlackouts lists the merchant's blackout calendars
+func GetBlackouts(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var out []types.Blackout
+		db.Where("merchant_id = ?", c.Param("merchantid")).Order("name").Find(&out)
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// SaveBlackout creates or updates a blackout calendar and the products it
+// applies to
+func SaveBlackout(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in types.Blackout
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := in.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		merchantID := c.Param("merchantid")
+		var count int
+		db.Model(&Product{}).Where("merchant_id = ? AND id IN (?)", merchantID, []int64(in.ProductIDs)).Count(&count)
+		if count != len(in.ProductIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "product not found"})
+			return
+		}
+
+		var old *types.Blackout
+		if in.ID != 0 {
+			old = &types.Blackout{}
+			if db.Find(old, "id = ? AND merchant_id = ?", in.ID, merchantID).RecordNotFound() {
+				c.JSON(http.StatusNotFound, gin.H{"error": "blackout not found"})
+				return
+			}
+			in.CreatedAt = old.CreatedAt
+		}
+
+		in.MerchantID = merchantID
+		if err := db.Save(&in).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		recordChange(c, "blackout", in.ID, old, &in)
+		c.JSON(http.StatusOK, in)
+	}
+}
+
+// DeleteBlackout removes a blackout calendar from all of its products
+func DeleteBlackout(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var b types.Blackout
+		if db.Find(&b, "id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid")).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "blackout not found"})
+			return
+		}
+		db.Delete(&b)
+		recordChange(c, "blackout", b.ID, &b, nil)
+		c.Status(http.StatusOK)
+	}
+}
+
+// GetHolidays returns the US federal holidays of a year to fill in a
+// blackout calendar with
+func GetHolidays() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		year, err := strconv.Atoi(c.Param("year"))
+		if err != nil || year < 1971 || year > 9999 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid year"})
+			return
+		}
+		c.JSON(http.StatusOK, types.FederalHolidays(year))
+	}
+}
+
+// GetExtraDepartures lists the one-off trips between the from and to dates
+// (inclusive, YYYY-MM-DD)
+func GetExtraDepartures(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := time.ParseInLocation("2006-01-02", c.Param("from"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := time.ParseInLocation("2006-01-02", c.Param("to"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var out []types.ExtraDeparture
+		db.Where("merchant_id = ? AND time >= ? AND time < ?", c.Param("merchantid"), from, to.AddDate(0, 0, 1)).
+			Order("time, product_id").Find(&out)
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// SaveExtraDeparture adds a one-off trip of a product or moves one that
+// nobody has bought tickets for yet, refusing to put the boat out on two
+// trips at once
+func SaveExtraDeparture(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in types.ExtraDeparture
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		var prod Product
+		if db.Find(&prod, "id = ? AND merchant_id = ?", in.ProductID, conf.ID).RecordNotFound() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "product not found"})
+			return
+		}
+
+		var old *types.ExtraDeparture
+		if in.ID != 0 {
+			old = &types.ExtraDeparture{}
+			if db.Find(old, "id = ? AND merchant_id = ?", in.ID, conf.ID).RecordNotFound() {
+				c.JSON(http.StatusNotFound, gin.H{"error": "extra departure not found"})
+				return
+			}
+			if (old.ProductID != in.ProductID || !old.Time.Equal(in.Time)) && pricing.SeatsSold(db, &conf, old.ProductID, old.Time) > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "tickets have been sold for this trip"})
+				return
+			}
+			in.CreatedAt = old.CreatedAt
+		}
+
+		in.MerchantID = conf.ID
+		in.Time = in.Time.In(timeloc)
+		if conflicts := pricing.ExtraConflicts(db, conf.ID, &in); len(conflicts) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the boat is already out then", "conflicts": conflicts})
+			return
+		}
+
+		if err := db.Save(&in).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		recordChange(c, "extra_departure", in.ID, old, &in)
+		c.JSON(http.StatusOK, in)
+	}
+}
+
+// DeleteExtraDeparture removes a one-off trip nobody has bought tickets for
+func DeleteExtraDeparture(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		var e types.ExtraDeparture
+		if db.Find(&e, "id = ? AND merchant_id = ?", c.Param("id"), conf.ID).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "extra departure not found"})
+			return
+		}
+		if pricing.SeatsSold(db, &conf, e.ProductID, e.Time) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "tickets have been sold for this trip, cancel it instead"})
+			return
+		}
+		db.Delete(&e)
+		recordChange(c, "extra_departure", e.ID, &e, nil)
+		c.Status(http.StatusOK)
+	}
+}
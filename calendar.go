@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func addCalendarRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/calendar.ics", GetTripCalendar(db))
+	router.GET("/calendars", checkJWT(), GetCalendarTokens(db))
+	router.GET("/calendars/:token", GetTokenCalendar(db))
+	router.PUT("/calendars", checkJWT(), logActionMiddle(db), SaveCalendarToken(db))
+	router.DELETE("/calendars/:id", checkJWT(), logActionMiddle(db), DeleteCalendarToken(db))
+	router.GET("/mycalendar", checkJWT(), GetMyCalendar(db))
+}
+
+// writeCalendar responds with a calendar in iCalendar format
+func writeCalendar(c *gin.Context, cal *types.Calendar) {
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", `inline; filename="calendar.ics"`)
+	c.Status(http.StatusOK)
+	cal.WriteICS(c.Writer)
+}
+
+// GetTripCalendar is the public feed of upcoming departures, ?days= sets
+// how far ahead it goes
+func GetTripCalendar(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		days, err := strconv.Atoi(c.Query("days"))
+		if err != nil || days <= 0 || days > 366 {
+			days = pricing.CalendarDays
+		}
+
+		now := time.Now().In(loc)
+		writeCalendar(c, pricing.TripCalendar(db, conf.ID, conf.EmailName, now, now.AddDate(0, 0, days), 0))
+	}
+}
+
+// GetCalendarTokens lists the merchant's boat and crew feeds
+func GetCalendarTokens(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var out []types.CalendarToken
+		db.Where("merchant_id = ?", c.Param("merchantid")).Order("name").Find(&out)
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// GetTokenCalendar is the feed of a boat's departures or a crew member's
+// trips, found by the secret token in its URL which can end in .ics
+func GetTokenCalendar(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var tok types.CalendarToken
+		if db.Where("merchant_id = ? AND token = ?", c.Param("merchantid"),
+			strings.TrimSuffix(c.Param("token"), ".ics")).First(&tok).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+			return
+		}
+
+		now := time.Now().In(loc)
+		if tok.UserID != "" {
+			writeCalendar(c, pricing.CrewCalendar(db, tok.MerchantID, tok.UserID, tok.Name, now))
+			return
+		}
+		writeCalendar(c, pricing.TripCalendar(db, tok.MerchantID, tok.Name, now, now.AddDate(0, 0, pricing.CalendarDays), tok.BoatID))
+	}
+}
+
+// SaveCalendarToken creates the secret feed of a boat or a crew member
+func SaveCalendarToken(db *gorm.DB) gin.HandlerFunc {
+	type tokenReq struct {
+		BoatID uint   `json:"boatId"`
+		UserID string `json:"userId"`
+	}
+
+	return func(c *gin.Context) {
+		var req tokenReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if (req.BoatID == 0) == (req.UserID == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a calendar is for either a boat or a crew member"})
+			return
+		}
+
+		merchantID := c.Param("merchantid")
+		tok := types.CalendarToken{MerchantID: merchantID, BoatID: req.BoatID, UserID: req.UserID}
+		if req.BoatID != 0 {
+			var boat Boat
+			if db.Find(&boat, "id = ? AND merchant_id = ?", req.BoatID, merchantID).RecordNotFound() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "boat not found"})
+				return
+			}
+			tok.Name = boat.Name
+		} else {
+			u := merchantUser(req.UserID, merchantID)
+			if u == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown user"})
+				return
+			}
+			tok.Name = u.Name
+		}
+
+		var err error
+		if tok.Token, err = types.NewCalendarToken(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		db.Create(&tok)
+		recordChange(c, "calendar_token", tok.ID, nil, &tok)
+		c.JSON(http.StatusOK, tok)
+	}
+}
+
+// DeleteCalendarToken revokes a feed, its URL stops working
+func DeleteCalendarToken(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var tok types.CalendarToken
+		if db.Where("merchant_id = ? AND id = ?", c.Param("merchantid"), c.Param("id")).First(&tok).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+			return
+		}
+		db.Delete(&tok)
+		recordChange(c, "calendar_token", tok.ID, &tok, nil)
+		c.Status(http.StatusOK)
+	}
+}
+
+// GetMyCalendar returns the logged in crew member's feed, creating it the
+// first time
+func GetMyCalendar(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		merchantID, userID := c.Param("merchantid"), c.GetString("user_id")
+
+		var tok types.CalendarToken
+		if db.Where("merchant_id = ? AND user_id = ?", merchantID, userID).First(&tok).RecordNotFound() {
+			u := merchantUser(userID, merchantID)
+			if u == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown user"})
+				return
+			}
+			tok = types.CalendarToken{MerchantID: merchantID, UserID: userID, Name: u.Name}
+
+			var err error
+			if tok.Token, err = types.NewCalendarToken(); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			db.Create(&tok)
+		}
+		c.JSON(http.StatusOK, tok)
+	}
+}
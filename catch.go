@@ -0,0 +1,297 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/internal"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// maxPhotoSize is the largest photo that can be uploaded to a catch report
+const maxPhotoSize = 10 << 20
+
+// photoTypes are the images which can be uploaded and their extensions
+var photoTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+var photos = internal.NewPhotoStore()
+
+func addCatchRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/catch-reports", GetCatchReports(db))
+	router.GET("/catch-reports/:id", GetCatchReport(db))
+	router.PUT("/catch-reports", checkJWT(), logActionMiddle(db), SaveCatchReport(db))
+	router.DELETE("/catch-reports/:id", checkJWT(), logActionMiddle(db), DeleteCatchReport(db))
+	router.POST("/catch-reports/:id/photos", checkJWT(), logActionMiddle(db), UploadCatchPhoto(db))
+	router.DELETE("/catch-reports/:id/photos/:photo", checkJWT(), logActionMiddle(db), DeleteCatchPhoto(db))
+	router.POST("/catch-reports/:id/email", checkJWT(), logActionMiddle(db), EmailCatchReport(db))
+}
+
+// productNames fills in the name of the product of each report
+func productNames(db *gorm.DB, reports []types.CatchReport) {
+	names := make(map[uint]string)
+	for idx := range reports {
+		r := &reports[idx]
+		if _, ok := names[r.ProductID]; !ok {
+			var prod Product
+			db.Unscoped().Select("name").Find(&prod, "id = ?", r.ProductID)
+			names[r.ProductID] = prod.Name
+		}
+		r.Product = names[r.ProductID]
+	}
+}
+
+// loadCatchReport finds one of the merchant's catch reports with its catches
+// and photos
+func loadCatchReport(db *gorm.DB, merchantID, id string) (*types.CatchReport, bool) {
+	var r types.CatchReport
+	if db.Preload("Catches").Preload("Photos").
+		Where("id = ? AND merchant_id = ?", id, merchantID).First(&r).RecordNotFound() {
+		return nil, false
+	}
+	list := []types.CatchReport{r}
+	productNames(db, list)
+	return &list[0], true
+}
+
+// GetCatchReports is the public feed of published catch reports, newest
+// trips first. It can be limited to a ?product= and paged with ?before= a
+// unix timestamp and ?limit= (20 by default)
+func GetCatchReports(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := db.Preload("Catches").Preload("Photos").
+			Where("merchant_id = ? AND published", c.Param("merchantid"))
+		if pid := c.Query("product"); pid != "" {
+			scope = scope.Where("product_id = ?", pid)
+		}
+		if before, err := strconv.ParseInt(c.Query("before"), 10, 64); err == nil {
+			scope = scope.Where("time < ?", time.Unix(before, 0))
+		}
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || limit <= 0 || limit > 100 {
+			limit = 20
+		}
+
+		var out []types.CatchReport
+		scope.Order("time desc").Limit(limit).Find(&out)
+		productNames(db, out)
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// GetCatchReport returns a single published catch report
+func GetCatchReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, ok := loadCatchReport(db, c.Param("merchantid"), c.Param("id"))
+		if !ok || !r.Published {
+			c.JSON(http.StatusNotFound, gin.H{"error": types.ErrCatchNotFound.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+// SaveCatchReport posts or updates the catch report of a departure, the
+// catches sent replace the ones already on it. The captain defaults to who
+// is assigned to the trip.
+func SaveCatchReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in types.CatchReport
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := in.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		merchantID := c.Param("merchantid")
+		var prod Product
+		if db.Find(&prod, "id = ? AND merchant_id = ?", in.ProductID, merchantID).RecordNotFound() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "product not found"})
+			return
+		}
+
+		var old *types.CatchReport
+		if in.ID != 0 {
+			var ok bool
+			if old, ok = loadCatchReport(db, merchantID, strconv.FormatUint(uint64(in.ID), 10)); !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": types.ErrCatchNotFound.Error()})
+				return
+			}
+			in.CreatedAt, in.UserID, in.EmailedAt = old.CreatedAt, old.UserID, old.EmailedAt
+		} else {
+			in.UserID = c.GetString("user_id")
+		}
+
+		in.MerchantID = merchantID
+		in.Time = in.Time.In(timeloc)
+		if in.Captain == "" {
+			var captain types.CrewAssignment
+			if !db.Where("merchant_id = ? AND product_id = ? AND start = ? AND role = ?",
+				merchantID, in.ProductID, in.Time, types.CrewCaptain).First(&captain).RecordNotFound() {
+				in.Captain = captain.Name
+			}
+		}
+
+		for idx := range in.Catches {
+			in.Catches[idx].ID = 0
+		}
+		in.Photos = nil
+
+		tx := db.Begin()
+		if in.ID != 0 {
+			tx.Where("report_id = ?", in.ID).Delete(&types.CatchEntry{})
+		}
+		if err := tx.Omit("Photos").Save(&in).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tx.Commit()
+
+		r, _ := loadCatchReport(db, merchantID, strconv.FormatUint(uint64(in.ID), 10))
+		recordChange(c, "catch_report", in.ID, old, r)
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+// DeleteCatchReport removes a catch report along with its photos
+func DeleteCatchReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, ok := loadCatchReport(db, c.Param("merchantid"), c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": types.ErrCatchNotFound.Error()})
+			return
+		}
+
+		for _, p := range r.Photos {
+			if err := photos.Delete(p.URL); err != nil {
+				log.Println("could not delete photo:", p.URL, err)
+			}
+		}
+		db.Where("report_id = ?", r.ID).Delete(&types.CatchPhoto{})
+		db.Where("report_id = ?", r.ID).Delete(&types.CatchEntry{})
+		db.Delete(r)
+		recordChange(c, "catch_report", r.ID, r, nil)
+		c.Status(http.StatusOK)
+	}
+}
+
+// UploadCatchPhoto stores a photo sent as the "photo" field of a multipart
+// form and adds it to a catch report with the form's "caption"
+func UploadCatchPhoto(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, ok := loadCatchReport(db, c.Param("merchantid"), c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": types.ErrCatchNotFound.Error()})
+			return
+		}
+
+		fh, err := c.FormFile("photo")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if fh.Size > maxPhotoSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "photos can be at most 10MB"})
+			return
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(f, head)
+		ext, ok := photoTypes[http.DetectContentType(head[:n])]
+		if !ok {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "photos must be jpeg, png, gif or webp"})
+			return
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		url, err := photos.Save(r.MerchantID, ext, f)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		p := types.CatchPhoto{ReportID: r.ID, URL: url, Caption: c.PostForm("caption")}
+		db.Create(&p)
+		recordChange(c, "catch_photo", p.ID, nil, &p)
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// DeleteCatchPhoto removes a photo from a catch report
+func DeleteCatchPhoto(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, ok := loadCatchReport(db, c.Param("merchantid"), c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": types.ErrCatchNotFound.Error()})
+			return
+		}
+
+		var p types.CatchPhoto
+		if db.Where("id = ? AND report_id = ?", c.Param("photo"), r.ID).First(&p).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "photo not found"})
+			return
+		}
+		if err := photos.Delete(p.URL); err != nil {
+			log.Println("could not delete photo:", p.URL, err)
+		}
+		db.Delete(&p)
+		recordChange(c, "catch_photo", p.ID, &p, nil)
+		c.Status(http.StatusOK)
+	}
+}
+
+// EmailCatchReport sends a catch report to everyone who bought tickets for
+// its trip, only once unless ?force=true
+func EmailCatchReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, ok := loadCatchReport(db, c.Param("merchantid"), c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": types.ErrCatchNotFound.Error()})
+			return
+		}
+		if r.EmailedAt != nil && c.Query("force") != "true" {
+			c.JSON(http.StatusConflict, gin.H{"error": types.ErrCatchEmailed.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", r.MerchantID)
+
+		sent := 0
+		for _, cust := range pricing.TripCustomers(db, &conf, r.ProductID, r.Time) {
+			if err := internal.SendCatchReportEmail(apiKey, c.Request.Host, &conf, r, cust.Name, cust.Email); err != nil {
+				log.Println("could not send catch report:", r.ID, cust.Email, err)
+				continue
+			}
+			sent++
+		}
+
+		now := time.Now()
+		db.Model(r).Update("emailed_at", &now)
+		c.JSON(http.StatusOK, gin.H{"sent": sent})
+	}
+}
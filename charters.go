@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func addCharterRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.POST("/charters", HoldCharter(db))
+	router.GET("/charters/:from/:to", checkJWT(), GetCharters(db))
+	router.PUT("/charters", checkJWT(), logActionMiddle(db), SaveCharter(db))
+}
+
+// HoldCharter holds a boat for a group and returns the cart item to check
+// out with, which has to be paid for before the hold runs out. It is public
+// so the number of holds per email and IP address is limited.
+func HoldCharter(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req pricing.CharterRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		req.IP = c.ClientIP()
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		ch, err := pricing.HoldCharter(db, &conf, &req)
+		switch err {
+		case nil:
+		case types.ErrCharterConflict:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case types.ErrCharterHolds:
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		cart, verr := pricing.ValidateCart(db, &conf, []pricing.CartItem{{Sku: ch.Sku(), Quantity: 1}})
+		if verr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": verr.Error(), "items": verr.Items})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"charter": ch, "item": cart[0]})
+	}
+}
+
+// GetCharters lists the charters starting between two dates
+func GetCharters(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := time.ParseInLocation("2006-01-02", c.Param("from"), timeloc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := time.ParseInLocation("2006-01-02", c.Param("to"), timeloc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var out []types.Charter
+		db.Order("start").Find(&out, "merchant_id = ? AND start >= ? AND start < ?",
+			c.Param("merchantid"), from, to.AddDate(0, 0, 1))
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// SaveCharter updates the group's details of a charter, or cancels it
+func SaveCharter(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in types.Charter
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var ch types.Charter
+		if db.Where("id = ? AND merchant_id = ?", in.ID, c.Param("merchantid")).First(&ch).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": types.ErrCharterNotFound.Error()})
+			return
+		}
+
+		old := ch
+		ch.LeaderName, ch.LeaderEmail, ch.LeaderPhone = in.LeaderName, in.LeaderEmail, in.LeaderPhone
+		ch.Headcount, ch.Notes = in.Headcount, in.Notes
+		if in.Status == types.CharterCancelled {
+			ch.Status = types.CharterCancelled
+		}
+
+		db.Save(&ch)
+		recordChange(c, "charter", ch.ID, &old, &ch)
+		c.JSON(http.StatusOK, ch)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/zeroshade/tmsapi/migrate"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: migrate [-dir path] <command> [args]
+
+Commands:
+  up [N]        apply all pending migrations, or only the next N
+  down [N]      revert the last N applied migrations (default 1), the
+                baseline migration can't be reverted
+  status        list migrations and when they were applied
+  create NAME   write a new empty up/down migration pair
+
+`)
+	flag.PrintDefaults()
+}
+
+func count(args []string, def int) int {
+	if len(args) < 2 {
+		return def
+	}
+
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n <= 0 {
+		log.Fatalf("invalid count %q", args[1])
+	}
+	return n
+}
+
+func main() {
+	dir := flag.String("dir", migrate.Dir(), "directory containing the migration files")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	if args[0] == "create" {
+		if len(args) < 2 {
+			log.Fatal("create requires a name")
+		}
+		up, down, err := migrate.Create(*dir, args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Created", up)
+		fmt.Println("Created", down)
+		return
+	}
+
+	URI := os.Getenv("DATABASE_URL")
+	if URI == "" {
+		log.Fatal("must set $DATABASE_URL")
+	}
+
+	db, err := gorm.Open("postgres", URI+"?timezone=America/New_York")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		done, err := migrate.Up(db.DB(), *dir, count(args, 0))
+		for _, m := range done {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(done) == 0 {
+			fmt.Println("No pending migrations")
+		}
+	case "down":
+		done, err := migrate.Down(db.DB(), *dir, count(args, 1))
+		for _, m := range done {
+			fmt.Printf("Reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		status, err := migrate.GetStatus(db.DB(), *dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
@@ -26,15 +26,6 @@ func main() {
 		log.Fatal(err)
 	}
 	defer db.Close()
-	db.Model(&tms.Schedule{}).Association("TimeArray")
-	db.Model(&tms.Schedule{}).Association("NotAvail")
-	db.Model(&tms.Payment{}).Association("Payer.PayerInfo")
-	db.Model(&tms.Item{}).AddForeignKey("transaction", "transactions(payment_id)", "CASCADE", "RESTRICT")
-	db.Model(&tms.Transaction{}).AddForeignKey("payment_id", "payments(id)", "CASCADE", "RESTRICT")
-	db.Table("transaction_related").AddForeignKey("transaction_payment_id", "payments(id)", "CASCADE", "RESTRICT")
-	db.Table("transaction_related").AddForeignKey("sale_id", "sales(id)", "CASCADE", "RESTRICT")
-	db.Model(&tms.PurchaseUnit{}).AddForeignKey("checkout_id", "checkout_orders(id)", "CASCADE", "RESTRICT")
-	db.Model(&tms.PurchaseItem{}).AddForeignKey("checkout_id", "checkout_orders(id)", "CASCADE", "RESTRICT")
 
 	var caps []tms.Capture
 	db.Find(&caps, "checkout_id = '' AND status = 'COMPLETED'")
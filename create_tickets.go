@@ -14,6 +14,7 @@ import (
 	"github.com/jung-kurt/gofpdf"
 	"github.com/skip2/go-qrcode"
 	"github.com/zeroshade/tmsapi/paypal"
+	"github.com/zeroshade/tmsapi/pricing"
 	"github.com/zeroshade/tmsapi/stripe"
 	"github.com/zeroshade/tmsapi/types"
 )
@@ -24,7 +25,7 @@ const spaceBetween = 15
 
 var skuRe = regexp.MustCompile(`(\d+)([A-Z]+)(\d{10})\d*`)
 
-func drawPass(f *gofpdf.Fpdf, item types.PassItem, passTitle string, boat *Boat, name, tkt, qrname string) {
+func drawPass(f *gofpdf.Fpdf, item types.PassItem, passTitle string, boat *Boat, label, name, addOns, tkt, qrname string) {
 	var opt gofpdf.ImageOptions
 	opt.ImageType = "png"
 
@@ -74,11 +75,21 @@ func drawPass(f *gofpdf.Fpdf, item types.PassItem, passTitle string, boat *Boat,
 	f.Ln(15)
 	f.SetX(left)
 	f.SetFont("Courier", "B", 14)
-	f.Cell(40, 7, "Purchased By:")
+	f.Cell(40, 7, label)
 	f.SetFont("Courier", "", 14)
 	f.Cell(50, 7, name)
 
-	f.Ln(20)
+	if addOns != "" {
+		f.Ln(7)
+		f.SetX(left)
+		f.SetFont("Courier", "B", 14)
+		f.Cell(40, 7, "Add-ons:")
+		f.SetFont("Courier", "", 12)
+		f.Cell(110, 7, addOns)
+		f.Ln(13)
+	} else {
+		f.Ln(20)
+	}
 	f.SetFont("Courier", "I", 8)
 	f.Cell(40, 8, qrname)
 
@@ -87,13 +98,20 @@ func drawPass(f *gofpdf.Fpdf, item types.PassItem, passTitle string, boat *Boat,
 	f.SetXY(0, starty+passHeight+spaceBetween)
 }
 
-func generatePdf(db *gorm.DB, items []types.PassItem, passTitle, name string, w io.Writer) {
+func generatePdf(db *gorm.DB, conf *types.MerchantConfig, items []types.PassItem, name string, w io.Writer) {
 	var opt gofpdf.ImageOptions
 	opt.ImageType = "png"
 
 	pdf := gofpdf.New("P", "mm", "Letter", ".")
 	pdf.SetTitle("Boarding Passes", false)
 
+	var passengers map[string]*types.Passenger
+	var addOns []pricing.AddOnSale
+	if len(items) > 0 {
+		passengers = orderPassengers(db, conf.ID, items[0].GetID())
+		addOns = pricing.OrderAddOns(db, conf, items[0].GetID())
+	}
+
 	for _, i := range items {
 		skuPieces := skuRe.FindAllStringSubmatch(i.GetSku(), -1)
 
@@ -107,12 +125,35 @@ func generatePdf(db *gorm.DB, items []types.PassItem, passTitle, name string, w
 		prod.Boat = &boat
 		tkt := strings.Title(strings.ToLower(skuPieces[0][2]))
 
+		// a charter gets a single pass for the whole group
+		purchaser := name
+		if info, ok := pricing.ParseCharterSku(i.GetSku()); ok {
+			var ch types.Charter
+			db.Find(&ch, "id = ?", info.Ref)
+			purchaser = fmt.Sprintf("%s (party of %d)", ch.LeaderName, ch.Headcount)
+		}
+
+		// the add-ons bought for the trip are listed on each of its passes
+		var extras []string
+		suffix := fmt.Sprintf("-%s", skuPieces[0][3])
+		for _, a := range addOns {
+			if strings.HasSuffix(a.Sku, suffix) && fmt.Sprint(a.ProductID) == pid {
+				extras = append(extras, fmt.Sprintf("%dx %s", a.Quantity, a.Name))
+			}
+		}
+
 		pdf.AddPage()
 		for n := uint(1); n <= i.GetQuantity(); n++ {
-			qrname := fmt.Sprintf("%s-%s-%d", i.GetID(), i.GetSku(), n)
+			qrname := types.PassCode(i.GetID(), i.GetSku(), int(n))
 			data, _ := qrcode.Encode(qrname, qrcode.High, 50)
 			pdf.RegisterImageOptionsReader(qrname, opt, bytes.NewReader(data))
-			drawPass(pdf, i, passTitle, prod.Boat, name, tkt, qrname)
+
+			// each pass is printed for its passenger once they're filled in
+			label, passName := "Purchased By:", purchaser
+			if p, ok := passengers[qrname]; ok && p.Name != "" {
+				label, passName = "Passenger:", p.Name
+			}
+			drawPass(pdf, i, conf.PassTitle, prod.Boat, label, passName, strings.Join(extras, ", "), tkt, qrname)
 		}
 	}
 	pdf.Output(w)
@@ -136,6 +177,6 @@ func GetBoardingPasses(db *gorm.DB) gin.HandlerFunc {
 		c.Header("Content-Type", "application/pdf")
 		c.Header("Content-Disposition", `attachment; filename="boardingpasses_`+c.Param("checkoutid")+`.pdf"`)
 		c.Status(http.StatusOK)
-		generatePdf(db, items, config.PassTitle, name, c.Writer)
+		generatePdf(db, &config, items, name, c.Writer)
 	}
 }
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/paypal"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/stripe"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func addCrewRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/crew/:from/:to", checkJWT(), GetCrew(db))
+	router.PUT("/crew", checkJWT(), logActionMiddle(db), SaveCrew(db))
+	router.DELETE("/crew/:id", checkJWT(), logActionMiddle(db), DeleteCrew(db))
+	router.GET("/mytrips", checkJWT(), GetMyTrips(db))
+	router.GET("/manifest/:timestamp", checkJWT(), GetManifest(db))
+	router.GET("/reports/crew/:from/:to", checkJWT(), GetCrewReport(db))
+}
+
+// GetCrew lists the crew assigned to departures between two dates
+func GetCrew(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := time.ParseInLocation("2006-01-02", c.Param("from"), timeloc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := time.ParseInLocation("2006-01-02", c.Param("to"), timeloc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, pricing.TripCrew(db, c.Param("merchantid"), from, to.AddDate(0, 0, 1)))
+	}
+}
+
+// SaveCrew assigns a user to a departure as a captain or deckhand, or
+// changes an existing assignment
+func SaveCrew(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in types.CrewAssignment
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var old *types.CrewAssignment
+		if in.ID != 0 {
+			old = &types.CrewAssignment{}
+			if db.Find(old, "id = ? AND merchant_id = ?", in.ID, c.Param("merchantid")).RecordNotFound() {
+				c.JSON(http.StatusNotFound, gin.H{"error": "crew assignment not found"})
+				return
+			}
+			in.CreatedAt = old.CreatedAt
+		}
+
+		if in.Name == "" || old == nil || old.UserID != in.UserID {
+			u := merchantUser(in.UserID, c.Param("merchantid"))
+			if u == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown user"})
+				return
+			}
+			in.Name = u.Name
+		}
+
+		switch err := pricing.AssignCrew(db, c.Param("merchantid"), &in); err {
+		case nil:
+		case types.ErrCrewConflict, types.ErrCrewCaptain:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		recordChange(c, "crew_assignment", in.ID, old, &in)
+		c.JSON(http.StatusOK, in)
+	}
+}
+
+// DeleteCrew takes a crew member off a departure
+func DeleteCrew(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var old types.CrewAssignment
+		if db.Find(&old, "id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid")).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "crew assignment not found"})
+			return
+		}
+
+		db.Delete(&old)
+		recordChange(c, "crew_assignment", old.ID, &old, nil)
+		c.Status(http.StatusOK)
+	}
+}
+
+// GetMyTrips lists the upcoming trips the logged in user is crewing
+func GetMyTrips(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, pricing.UpcomingTrips(db, c.Param("merchantid"), c.GetString("user_id"), time.Now()))
+	}
+}
+
+// GetManifest is the orders for the trips leaving at a time along with
+// the crew assigned to them and any of the trips without enough crew for
+// their boat, the passengers filled in for the orders, the add-ons they
+// bought and the trips' pools
+func GetManifest(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ts, err := strconv.ParseInt(c.Param("timestamp"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var config types.MerchantConfig
+		db.Find(&config, "id = ?", c.Param("merchantid"))
+
+		var handler PaymentHandler
+		switch config.PaymentType {
+		case "paypal":
+			handler = &paypal.Handler{}
+		case "stripe":
+			handler = &stripe.Handler{}
+		}
+
+		orders, err := handler.OrdersTimestamp(&config, db, c.Param("timestamp"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var passengers []types.Passenger
+		db.Preload("Signature").Scopes(TripTime(c.Param("timestamp"))).
+			Where("merchant_id = ?", config.ID).Order("order_id, sku, seat").Find(&passengers)
+
+		t := time.Unix(ts, 0).In(timeloc)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, timeloc)
+		short := make([]pricing.CrewShortage, 0)
+		for _, s := range pricing.ShortCrewed(db, config.ID, day, day) {
+			if s.Time.Equal(t) {
+				short = append(short, s)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"orders":     orders,
+			"crew":       pricing.TripCrew(db, config.ID, t, t.Add(time.Second)),
+			"crewShort":  short,
+			"passengers": passengers,
+			"addons":     pricing.TripAddOns(db, &config, t),
+			"pools":      pricing.PoolsBetween(db, config.ID, t, t.Add(time.Second)),
+		})
+	}
+}
+
+// GetCrewReport totals the hours each crew member worked between two dates
+// for payroll, as a CSV file when asked for ?format=csv
+func GetCrewReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := time.ParseInLocation("2006-01-02", c.Param("from"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := time.ParseInLocation("2006-01-02", c.Param("to"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		rows := pricing.CrewHoursBetween(db, c.Param("merchantid"), from, to.AddDate(0, 0, 1))
+		if c.Query("format") != "csv" {
+			c.JSON(http.StatusOK, rows)
+			return
+		}
+
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="crew-hours-%s-%s.csv"`, c.Param("from"), c.Param("to")))
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"user_id", "name", "role", "trips", "hours"})
+		for _, r := range rows {
+			w.Write([]string{r.UserID, r.Name, r.Role, strconv.Itoa(r.Trips), strconv.FormatFloat(r.Hours, 'f', 2, 64)})
+		}
+		w.Flush()
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func addFeeRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/fees", GetFeeRules(db))
+	router.PUT("/fees", checkJWT(), logActionMiddle(db), SaveFeeRules(db))
+	router.DELETE("/fees/:id", checkJWT(), logActionMiddle(db), DeleteFeeRule(db))
+	router.POST("/quote", QuoteCart(db))
+}
+
+// GetFeeRules returns the booking fees configured for the merchant
+func GetFeeRules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, pricing.LoadFeeRules(db, c.Param("merchantid")))
+	}
+}
+
+// SaveFeeRules creates or updates all of the fee rules in the request
+func SaveFeeRules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rules []types.FeeRule
+		if err := c.ShouldBindJSON(&rules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		for idx := range rules {
+			if err := rules[idx].Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			// an id has to be one of the merchant's own rules or saving it
+			// would overwrite another merchant's
+			if rules[idx].ID != 0 && db.Where("id = ? AND merchant_id = ?", rules[idx].ID, c.Param("merchantid")).
+				First(&types.FeeRule{}).RecordNotFound() {
+				c.JSON(http.StatusNotFound, gin.H{"error": "fee rule not found"})
+				return
+			}
+		}
+
+		for _, r := range rules {
+			r.MerchantID = c.Param("merchantid")
+
+			var old *types.FeeRule
+			if r.ID != 0 {
+				old = &types.FeeRule{}
+				db.Find(old, "id = ? AND merchant_id = ?", r.ID, r.MerchantID)
+			}
+
+			db.Save(&r)
+			recordChange(c, "fee_rule", r.ID, old, &r)
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+func DeleteFeeRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var old types.FeeRule
+		db.Find(&old, "id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid"))
+
+		db.Where("id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid")).Delete(types.FeeRule{})
+		recordChange(c, "fee_rule", c.Param("id"), &old, nil)
+		c.Status(http.StatusOK)
+	}
+}
+
+// QuoteCart prices a cart so the customer can see the fee breakdown before
+// checking out. The promo and email query parameters apply a promo code
+// and the voucher parameter pays for some or all of it with a voucher.
+// deposit=true quotes paying a deposit now and the balance later.
+func QuoteCart(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var cart []pricing.CartItem
+		if err := c.ShouldBindJSON(&cart); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		cart, verr := pricing.ValidateCart(db, &conf, cart)
+		if verr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": verr.Error(), "items": verr.Items})
+			return
+		}
+
+		promo, err := pricing.LoadPromo(db, conf.ID, c.Query("promo"), c.Query("email"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		voucher, err := pricing.LoadVoucher(db, conf.ID, c.Query("voucher"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, pricing.QuoteCart(db, &conf, cart, pricing.Options{
+			Promo:   promo,
+			Voucher: voucher,
+			Deposit: c.Query("deposit") == "true",
+		}))
+	}
+}
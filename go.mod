@@ -1,4 +1,5 @@
 // +heroku goVersion go1.14
+// +heroku install ./cmd/migrate .
 
 module github.com/zeroshade/tmsapi
 
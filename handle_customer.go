@@ -12,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 	"github.com/zeroshade/tmsapi/internal"
+	"github.com/zeroshade/tmsapi/pricing"
 	"github.com/zeroshade/tmsapi/types"
 
 	"github.com/sendgrid/rest"
@@ -58,7 +59,18 @@ func sendNotifyEmail(apiKey string, conf *types.MerchantConfig, order *types.Che
 	return nil
 }
 
-func SendClientMail(apiKey, host, email string, order *types.CheckoutOrder, conf *types.MerchantConfig) (*rest.Response, error) {
+// orderCalendar is the trips of a PayPal order to attach to its confirmation
+func orderCalendar(db *gorm.DB, conf *types.MerchantConfig, order *types.CheckoutOrder) *types.Calendar {
+	skus := make([]string, 0)
+	for _, pu := range order.PurchaseUnits {
+		for _, item := range pu.Items {
+			skus = append(skus, item.Sku)
+		}
+	}
+	return pricing.OrderCalendar(db, conf, order.ID, skus)
+}
+
+func SendClientMail(apiKey, host, email string, order *types.CheckoutOrder, conf *types.MerchantConfig, cal *types.Calendar) (*rest.Response, error) {
 	type TmplData struct {
 		Host          string
 		PurchaseUnits []types.PurchaseUnit
@@ -98,6 +110,7 @@ func SendClientMail(apiKey, host, email string, order *types.CheckoutOrder, conf
 	content := mail.NewContent("text/html", conf.EmailContent+tpl.String())
 
 	m := mail.NewV3MailInit(from, subject, to, content)
+	internal.AttachCalendar(m, cal)
 	request := sendgrid.GetRequest(apiKey, "/v3/mail/send", "https://api.sendgrid.com")
 	request.Method = "POST"
 	request.Body = mail.GetRequestBody(m)
@@ -194,7 +207,7 @@ func Resend(db *gorm.DB) gin.HandlerFunc {
 			db.Find(&conf)
 		}
 
-		response, err := SendClientMail(apiKey, c.Request.Host, r.Email, &order, &conf)
+		response, err := SendClientMail(apiKey, c.Request.Host, r.Email, &order, &conf, orderCalendar(db, &conf, &order))
 		if err != nil {
 			c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
 			return
@@ -263,7 +276,7 @@ func ConfirmAndSend(db *gorm.DB) gin.HandlerFunc {
 			db.Find(&conf)
 		}
 
-		response, err := SendClientMail(apiKey, c.Request.Host, order.Payer.Email, &order, &conf)
+		response, err := SendClientMail(apiKey, c.Request.Host, order.Payer.Email, &order, &conf, orderCalendar(db, &conf, &order))
 		if err != nil {
 			c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
 			return
@@ -2,13 +2,18 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 	"github.com/zeroshade/tmsapi/internal"
+	"github.com/zeroshade/tmsapi/pricing"
 	"github.com/zeroshade/tmsapi/types"
 )
 
@@ -40,6 +45,8 @@ func AddOrderToDB(cr *CaptureResponse, tx *gorm.DB) *types.CheckoutOrder {
 	order.PayerID = cr.Payer.ID
 	order.Status = cr.Status
 	order.PurchaseUnits = cr.PurchaseUnits
+	order.CreateTime = time.Now()
+	order.UpdateTime = order.CreateTime
 
 	tx.Create(&order)
 
@@ -58,6 +65,108 @@ func HashMerchantID(id string) int32 {
 	return ret
 }
 
+// merchantForPayee finds the merchant config for a PayPal payee, which may
+// be one of the merchant's sandbox accounts
+func merchantForPayee(db *gorm.DB, mid string) types.MerchantConfig {
+	var conf types.MerchantConfig
+	db.Find(&conf, "id = ?", mid)
+
+	if len(conf.ID) <= 0 {
+		db.Table("sandbox_infos").Select("id").Where("? = ANY (sandbox_ids)", mid).Scan(&conf)
+		db.Find(&conf)
+	}
+	return conf
+}
+
+// checkOrder validates an approved order against the catalog, and makes
+// sure the promo code and voucher can still be used by the payer, before
+// it gets captured. Orders created by the server must also still be what
+// was created. It returns what the order should be charged.
+func checkOrder(db *gorm.DB, client *internal.Client, orderID, promo, voucher string) (*pricing.Quote, pricing.Options, error) {
+	var opts pricing.Options
+
+	data, err := client.GetCheckoutOrder(orderID)
+	if err != nil {
+		return nil, opts, err
+	}
+
+	var r CaptureResponse
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, opts, err
+	}
+	if len(r.PurchaseUnits) == 0 {
+		return nil, opts, errors.New("order has no purchase units")
+	}
+
+	pu := r.PurchaseUnits[0]
+
+	var pending types.PendingOrder
+	if !db.Where("id = ?", orderID).First(&pending).RecordNotFound() {
+		if pending.CapturedAt != nil {
+			return nil, opts, errors.New("order has already been captured")
+		}
+		if pending.BalanceToken != "" {
+			return nil, opts, errors.New("order is for a balance payment")
+		}
+		if !pending.Matches(pu.Payee.MerchantID, pu.Amount.Value, pu.Items) {
+			return nil, opts, errors.New("order doesn't match the order that was created")
+		}
+		promo, voucher = pending.Promo, pending.Voucher
+		opts.Deposit = pending.Deposit
+	}
+
+	conf := merchantForPayee(db, pu.Payee.MerchantID)
+	// the use of a held promo code was already counted when it was held
+	if pending.PromoHold != 0 {
+		opts.Promo, err = pricing.LoadHeldPromo(db, conf.ID, pending.PromoHold, promo, r.Payer.Email)
+	} else {
+		opts.Promo, err = pricing.LoadPromo(db, conf.ID, promo, r.Payer.Email)
+	}
+	if err != nil {
+		return nil, opts, err
+	}
+	// a held voucher is quoted with the held credit still on it
+	if pending.VoucherHold != 0 {
+		opts.Voucher, err = pricing.LoadHeldVoucher(db, conf.ID, pending.VoucherHold)
+	} else {
+		opts.Voucher, err = pricing.LoadVoucher(db, conf.ID, voucher)
+	}
+	if err != nil {
+		return nil, opts, err
+	}
+
+	quote, verr := pricing.ValidateOrder(db, &conf, pu.Items, pu.Amount.Value, opts)
+	if verr != nil {
+		return nil, opts, verr
+	}
+	return quote, opts, nil
+}
+
+// issueOrderGiftCards creates and sends the gift cards bought with an order
+func issueOrderGiftCards(db *gorm.DB, conf *types.MerchantConfig, order *types.CheckoutOrder) {
+	amounts := make([]types.Money, 0)
+	for _, item := range order.PurchaseUnits[0].Items {
+		if item.Sku != pricing.GiftCardSku {
+			continue
+		}
+		for n := uint(0); n < item.Quantity; n++ {
+			amounts = append(amounts, item.Amount.Value)
+		}
+	}
+	if len(amounts) == 0 {
+		return
+	}
+
+	name := order.Payer.Name.GivenName + " " + order.Payer.Name.Surname
+	cards, err := pricing.IssueGiftCards(db, conf.ID, "paypal", order.ID, order.Payer.Email, name, amounts)
+	if err != nil {
+		log.Println("could not issue gift cards:", order.ID, err)
+	}
+	if err := internal.SendVoucherEmail(apiKey, conf, name, order.Payer.Email, cards); err != nil {
+		log.Println(err)
+	}
+}
+
 func CaptureOrder(db *gorm.DB) gin.HandlerFunc {
 	env := internal.SANDBOX
 	if strings.ToLower(os.Getenv("PAYPAL_ENV")) == "live" {
@@ -65,7 +174,9 @@ func CaptureOrder(db *gorm.DB) gin.HandlerFunc {
 	}
 
 	type CaptureReq struct {
-		OrderID string `json:"orderId"`
+		OrderID   string `json:"orderId"`
+		PromoCode string `json:"promoCode"`
+		Voucher   string `json:"voucher"`
 	}
 
 	return func(c *gin.Context) {
@@ -76,6 +187,16 @@ func CaptureOrder(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		paypalClient := internal.NewClient(env)
+
+		quote, opts, err := checkOrder(db, paypalClient, cr.OrderID, cr.PromoCode, cr.Voucher)
+		if verr, ok := err.(*pricing.ValidationError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": verr.Error(), "items": verr.Items})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		resp, err := paypalClient.CaptureOrder(cr.OrderID)
 		if err != nil {
 			c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
@@ -92,13 +213,94 @@ func CaptureOrder(db *gorm.DB) gin.HandlerFunc {
 
 			order := AddOrderToDB(&r, db)
 
-			var conf types.MerchantConfig
-			mid := order.PurchaseUnits[0].Payee.MerchantID
-			db.Find(&conf, "id = ?", mid)
+			now := time.Now()
+			db.Model(&types.PendingOrder{}).Where("id = ?", order.ID).Update("captured_at", &now)
+			captured := types.NewMoney(0, "")
+			for _, cp := range order.PurchaseUnits[0].Payments.Captures {
+				captured = captured.Add(cp.Amount.Value)
+			}
+			if captured.Cents != quote.Due.Cents {
+				// nothing is fulfilled, the payment goes back and the refund
+				// webhook gives back the seats
+				log.Println("captured amount doesn't match order:", order.ID, captured, quote.Due)
+				db.Model(&types.PendingOrder{}).Where("id = ?", order.ID).
+					Update("flagged", fmt.Sprintf("captured %s but the order came to %s", captured, quote.Due))
+				for _, cp := range order.PurchaseUnits[0].Payments.Captures {
+					if _, err := paypalClient.IssueRefund(cp.ID, order.PurchaseUnits[0].Payee.Email); err != nil {
+						log.Println("could not refund capture:", order.ID, cp.ID, err)
+					}
+				}
+				var pending types.PendingOrder
+				if !db.Where("id = ?", order.ID).First(&pending).RecordNotFound() {
+					if pending.VoucherHold != 0 {
+						pricing.ReleaseHold(db, pending.VoucherHold)
+					}
+					if pending.PromoHold != 0 {
+						pricing.ReleasePromo(db, pending.PromoHold)
+					}
+				}
+				c.JSON(http.StatusConflict, gin.H{"error": "the amount paid doesn't match the order, it has been refunded"})
+				return
+			}
+
+			conf := merchantForPayee(db, order.PurchaseUnits[0].Payee.MerchantID)
 
-			if len(conf.ID) <= 0 {
-				db.Table("sandbox_infos").Select("id").Where("? = ANY (sandbox_ids)", mid).Scan(&conf)
-				db.Find(&conf)
+			// only the fees on the order PayPal charged are recorded
+			fees := types.NewMoney(0, quote.FeeTotal.Currency)
+			for _, item := range order.PurchaseUnits[0].Items {
+				if item.Sku == pricing.FeeSku {
+					fees = fees.Add(item.Amount.Value.Mul(int64(item.Quantity)))
+				}
+			}
+
+			// a deposit order's commission is capped at what it paid, the
+			// rest is taken when the balance is paid
+			order.Fees, order.Tax, order.Commission = fees, quote.TaxTotal, quote.Commission.Min(quote.Due)
+			order.Discount, order.PromoCode = quote.Discount, quote.Promo
+			order.Credit, order.Voucher = quote.Credit, quote.Voucher
+			order.Balance = quote.Balance
+			db.Model(order).Updates(map[string]interface{}{
+				"fees": order.Fees, "tax": order.Tax, "commission": order.Commission,
+				"discount": order.Discount, "promo_code": order.PromoCode,
+				"credit": order.Credit, "voucher": order.Voucher, "balance": order.Balance,
+			})
+			var pending types.PendingOrder
+			db.Where("id = ?", order.ID).First(&pending)
+			if opts.Promo != nil && !quote.Discount.IsZero() {
+				if err := pricing.RedeemPromo(db, opts.Promo, pending.PromoHold, "paypal", order.ID, order.Payer.Email, quote.Discount); err != nil {
+					log.Println("could not redeem promo code:", opts.Promo.Code, order.ID, err)
+					db.Model(&pending).Update("flagged", "promo code "+opts.Promo.Code+" was over its limits: "+err.Error())
+				}
+			}
+			if opts.Voucher != nil {
+				if err := pricing.RedeemHold(db, opts.Voucher, pending.VoucherHold, quote.Credit, "paypal", order.ID); err != nil {
+					log.Println("could not redeem voucher:", opts.Voucher.Code, order.ID, err)
+					db.Model(&pending).Update("flagged", "voucher "+opts.Voucher.Code+" couldn't be redeemed: "+err.Error())
+				}
+			}
+			issueOrderGiftCards(db, &conf, order)
+			skus := make([]string, 0, len(order.PurchaseUnits[0].Items))
+			for _, item := range order.PurchaseUnits[0].Items {
+				skus = append(skus, item.Sku)
+			}
+			pricing.BookCharters(db, conf.ID, "paypal", order.ID, skus)
+			pricing.BookWaitlist(db, conf.ID, "paypal", order.ID, skus)
+			if b := pricing.BalanceFor(conf.ID, quote); b != nil {
+				b.Provider, b.OrderID = "paypal", order.ID
+				b.Email = order.Payer.Email
+				b.Name = order.Payer.Name.GivenName + " " + order.Payer.Name.Surname
+				b.PayURL = c.Request.Header.Get("x-calendar-origin")
+				if b, err = pricing.OpenBalance(db, b); err != nil {
+					log.Println("could not open balance:", order.ID, err)
+				} else if err := internal.SendBalanceEmail(apiKey, &conf, b, false); err != nil {
+					log.Println(err)
+				}
+			}
+			for _, line := range quote.Lines {
+				if !line.Tax.IsZero() {
+					db.Model(&types.PurchaseItem{}).Where("checkout_id = ? AND sku = ?", order.ID, line.Sku).
+						Update("tax_value", line.UnitTax)
+				}
 			}
 
 			if err := sendNotifyEmail(apiKey, &conf, order); err != nil {
@@ -111,7 +313,7 @@ func CaptureOrder(db *gorm.DB) gin.HandlerFunc {
 				t.Send(conf.NotifyNumber, "Tickets Purchased by "+order.Payer.Name.GivenName+" "+order.Payer.Name.Surname)
 			}
 
-			_, err := SendClientMail(apiKey, c.Request.Host, order.Payer.Email, order, &conf)
+			_, err := SendClientMail(apiKey, c.Request.Host, order.Payer.Email, order, &conf, orderCalendar(db, &conf, order))
 			if err != nil {
 				c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
 				return
@@ -129,7 +129,11 @@ func (a *Auth0Client) GetRole(role string) *Role {
 }
 
 func (a *Auth0Client) GetUserByID(userid string) *User {
-	res, _ := a.client.Get(Audience + "users/" + userid)
+	res, err := a.client.Get(Audience + "users/" + userid)
+	if err != nil {
+		log.Println("Failed to get user: ", err)
+		return nil
+	}
 	defer res.Body.Close()
 	dec := json.NewDecoder(res.Body)
 
@@ -161,6 +165,9 @@ func (a *Auth0Client) GetUsersByRole(role string) []*User {
 	ret := make([]*User, 0, len(users))
 	for _, i := range users {
 		user := a.GetUserByID(i.UserID)
+		if user == nil {
+			continue
+		}
 		if user.AppMetadata == nil {
 			user.AppMetadata = make(map[string]json.RawMessage)
 		}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// SendBalanceEmail emails a customer the link to pay the balance of their
+// booking, either when the deposit is paid or as a reminder.
+func SendBalanceEmail(apiKey string, conf *types.MerchantConfig, b *types.BalanceDue, reminder bool) error {
+	if b.Email == "" {
+		return nil
+	}
+
+	const tmpl = `
+	{{ if .Reminder }}This is a reminder that the{{ else }}Thank you for your deposit! The{{ end }}
+	balance of <b>${{ .Balance.Amount }}</b> for your booking with {{ .Merchant }}
+	{{ if eq .Balance.Status "overdue" }}was{{ else }}is{{ end }} due by {{ .Balance.DueDate.Format "January 2, 2006" }}.
+	<br /><br />
+	{{ with .Link }}<a href="{{ . }}">Pay your balance</a>{{ else }}Please contact us to pay your balance.{{ end }}`
+
+	t := template.Must(template.New("balance").Parse(tmpl))
+	var tpl bytes.Buffer
+	if err := t.Execute(&tpl, map[string]interface{}{
+		"Merchant": conf.EmailName,
+		"Balance":  b,
+		"Link":     b.Link(),
+		"Reminder": reminder,
+	}); err != nil {
+		return err
+	}
+
+	subject := "Your Balance Due"
+	if reminder {
+		subject = "Reminder: Your Balance Due"
+	}
+
+	from := mail.NewEmail(conf.EmailName, conf.EmailFrom)
+	to := mail.NewEmail(b.Name, b.Email)
+	m := mail.NewV3MailInit(from, subject, to, mail.NewContent("text/html", tpl.String()))
+	request := sendgrid.GetRequest(apiKey, "/v3/mail/send", "https://api.sendgrid.com")
+	request.Method = "POST"
+	request.Body = mail.GetRequestBody(m)
+	_, err := sendgrid.API(request)
+	return err
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// SendCatchReportEmail sends the catch report of a trip to one of the
+// customers who were on it, host is the server's public host which photos
+// stored on it are linked through.
+func SendCatchReportEmail(apiKey, host string, conf *types.MerchantConfig, r *types.CatchReport, name, email string) error {
+	if email == "" {
+		return nil
+	}
+
+	const tmpl = `
+	Thanks for fishing with {{ .Merchant }}! Here's what was caught on
+	<b>{{ .Report.Product }}</b> on {{ .Report.Time.Format "Monday, January 2" }}{{ with .Report.Captain }} with Captain {{ . }}{{ end }}.
+	<br /><br />
+	<table>
+	{{ range .Report.Catches }}<tr>
+		<td><b>{{ .Species }}</b></td><td>{{ .Count }}</td>
+		<td>{{ if .LargestLbs }}largest {{ .LargestLbs }} lbs{{ with .LargestBy }} by {{ . }}{{ end }}{{ end }}</td>
+	</tr>{{ end }}
+	</table>
+	{{ with .Report.Notes }}<p>{{ . }}</p>{{ end }}
+	{{ range .Report.Photos }}<p><img src="{{ absolute .URL }}" style="max-width: 600px" /><br />{{ .Caption }}</p>{{ end }}`
+
+	t := template.Must(template.New("catch").Funcs(template.FuncMap{
+		"absolute": func(url string) string { return AbsoluteURL(host, url) },
+	}).Parse(tmpl))
+	var tpl bytes.Buffer
+	if err := t.Execute(&tpl, map[string]interface{}{
+		"Merchant": conf.EmailName,
+		"Report":   r,
+	}); err != nil {
+		return err
+	}
+
+	from := mail.NewEmail(conf.EmailName, conf.EmailFrom)
+	to := mail.NewEmail(name, email)
+	m := mail.NewV3MailInit(from, "Catch Report: "+r.Product+" "+r.Time.Format("Jan 2"), to, mail.NewContent("text/html", tpl.String()))
+	request := sendgrid.GetRequest(apiKey, "/v3/mail/send", "https://api.sendgrid.com")
+	request.Method = "POST"
+	request.Body = mail.GetRequestBody(m)
+	_, err := sendgrid.API(request)
+	return err
+}
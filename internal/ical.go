@@ -0,0 +1,23 @@
+package internal
+
+import (
+	"encoding/base64"
+
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// AttachCalendar adds the trips of a calendar to an email as an .ics file,
+// nothing is attached if cal is nil
+func AttachCalendar(m *mail.SGMailV3, cal *types.Calendar) {
+	if cal == nil {
+		return
+	}
+
+	a := mail.NewAttachment()
+	a.SetContent(base64.StdEncoding.EncodeToString(cal.Bytes()))
+	a.SetType("text/calendar; method=PUBLISH")
+	a.SetFilename("trip.ics")
+	a.SetDisposition("attachment")
+	m.AddAttachment(a)
+}
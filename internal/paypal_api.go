@@ -213,3 +213,19 @@ func (c *Client) CaptureOrder(id string) (*http.Response, error) {
 	req.Header.Set("Content-Type", "application/json")
 	return c.SendWithAuth(req)
 }
+
+func (c *Client) CreateOrder(order interface{}) (*http.Response, error) {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", c.APIBase+"/v2/checkout/orders", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Prefer", "return=representation")
+	req.Header.Set("Content-Type", "application/json")
+	return c.SendWithAuth(req)
+}
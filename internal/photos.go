@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PhotoStore saves uploaded photos and returns the URL they're served from.
+// Object storage can be used by implementing it, LocalPhotos keeps them on
+// disk for the server to serve itself.
+type PhotoStore interface {
+	Save(merchantID, ext string, r io.Reader) (string, error)
+	Delete(url string) error
+}
+
+// LocalPhotos stores photos under Dir, which is served at BaseURL
+type LocalPhotos struct {
+	Dir     string
+	BaseURL string
+}
+
+// NewPhotoStore stores photos in $PHOTO_DIR (uploads by default), served
+// from $PHOTO_BASE_URL which should point at wherever that is exposed. The
+// default is this server's /uploads, which gives URLs relative to its host
+// that need AbsoluteURL anywhere off the site, like in emails.
+func NewPhotoStore() *LocalPhotos {
+	dir := os.Getenv("PHOTO_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+	base := os.Getenv("PHOTO_BASE_URL")
+	if base == "" {
+		base = "/uploads"
+	}
+	return &LocalPhotos{Dir: dir, BaseURL: strings.TrimSuffix(base, "/")}
+}
+
+// Save writes a photo under a random name in a directory for the merchant
+func (l *LocalPhotos) Save(merchantID, ext string, r io.Reader) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(buf) + ext
+	dir := filepath.Join(l.Dir, filepath.Base(merchantID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return "", err
+	}
+	return l.BaseURL + "/" + path.Join(filepath.Base(merchantID), name), nil
+}
+
+// Delete removes a photo saved by Save, anything else is left alone
+func (l *LocalPhotos) Delete(url string) error {
+	rel := strings.TrimPrefix(url, l.BaseURL+"/")
+	if rel == url || strings.Contains(rel, "..") {
+		return nil
+	}
+	err := os.Remove(filepath.Join(l.Dir, filepath.FromSlash(rel)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// AbsoluteURL makes a photo URL relative to this server absolute with its
+// public host, any other URL is returned as it is
+func AbsoluteURL(host, url string) string {
+	if !strings.HasPrefix(url, "/") || strings.HasPrefix(url, "//") {
+		return url
+	}
+	return "https://" + host + url
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"bytes"
+	"html/template"
+	"time"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// SendScheduleChangeEmail tells a customer that a trip they booked was
+// moved to a new time, or cancelled if newTime is nil.
+func SendScheduleChangeEmail(apiKey string, conf *types.MerchantConfig, name, email, product string, oldTime time.Time, newTime *time.Time) error {
+	if email == "" {
+		return nil
+	}
+
+	const tmpl = `
+	We've had to make a change to your trip on <b>{{ .Product }}</b> on
+	{{ .Old.Format "Monday, January 2 at 3:04 PM" }}.
+	<br /><br />
+	{{ with .New }}It now leaves at <b>{{ .Format "3:04 PM" }}</b> on {{ .Format "Monday, January 2" }}, your tickets
+	have been moved to the new time. The boarding passes you already have will still be accepted, or you
+	can download them again to have the new time printed on them.
+	{{ else }}Unfortunately this trip has been <b>cancelled</b>. We'll be in touch about moving you to
+	another trip or refunding your tickets.{{ end }}
+	<br /><br />
+	If you have any questions please reply to this email. We're sorry for the inconvenience.`
+
+	t := template.Must(template.New("schedule").Parse(tmpl))
+	var tpl bytes.Buffer
+	if err := t.Execute(&tpl, map[string]interface{}{
+		"Product": product,
+		"Old":     oldTime,
+		"New":     newTime,
+	}); err != nil {
+		return err
+	}
+
+	subject := "Your trip has been cancelled: "
+	if newTime != nil {
+		subject = "Your trip time has changed: "
+	}
+
+	from := mail.NewEmail(conf.EmailName, conf.EmailFrom)
+	to := mail.NewEmail(name, email)
+	m := mail.NewV3MailInit(from, subject+product+" "+oldTime.Format("Jan 2"), to, mail.NewContent("text/html", tpl.String()))
+	request := sendgrid.GetRequest(apiKey, "/v3/mail/send", "https://api.sendgrid.com")
+	request.Method = "POST"
+	request.Body = mail.GetRequestBody(m)
+	_, err := sendgrid.API(request)
+	return err
+}
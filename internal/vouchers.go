@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// SendVoucherEmail emails the codes for newly issued vouchers to the
+// customer.
+func SendVoucherEmail(apiKey string, conf *types.MerchantConfig, name, email string, vouchers []types.Voucher) error {
+	if email == "" || len(vouchers) == 0 {
+		return nil
+	}
+
+	const tmpl = `
+	Thank you! Here {{ if eq (len .Vouchers) 1 }}is your voucher{{ else }}are your vouchers{{ end }}
+	for {{ .Merchant }}:
+	<br /><br />
+	<ul>
+	{{ range .Vouchers -}}
+	<li><b>{{ .Code }}</b> worth ${{ .Amount }}{{ with .ExpiresAt }}, valid until {{ .Format "January 2, 2006" }}{{ end }}</li>
+	{{- end }}
+	</ul>
+	Enter the code at checkout to use it towards a booking.`
+
+	t := template.Must(template.New("voucher").Parse(tmpl))
+	var tpl bytes.Buffer
+	if err := t.Execute(&tpl, map[string]interface{}{
+		"Merchant": conf.EmailName,
+		"Vouchers": vouchers,
+	}); err != nil {
+		return err
+	}
+
+	from := mail.NewEmail(conf.EmailName, conf.EmailFrom)
+	to := mail.NewEmail(name, email)
+	m := mail.NewV3MailInit(from, "Your Voucher", to, mail.NewContent("text/html", tpl.String()))
+	request := sendgrid.GetRequest(apiKey, "/v3/mail/send", "https://api.sendgrid.com")
+	request.Method = "POST"
+	request.Body = mail.GetRequestBody(m)
+	_, err := sendgrid.API(request)
+	return err
+}
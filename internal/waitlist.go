@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// SendWaitlistEmail tells a customer on a waitlist that seats have opened
+// up for them and how long they are held.
+func SendWaitlistEmail(apiKey string, conf *types.MerchantConfig, w *types.WaitlistEntry, product string) error {
+	if w.Email == "" {
+		return nil
+	}
+
+	const tmpl = `
+	Good news! {{ .Entry.Party }} {{ if eq .Entry.Party 1 }}seat has{{ else }}seats have{{ end }} opened up on
+	<b>{{ .Product }}</b> on {{ .Entry.Time.Format "Monday, January 2 at 3:04 PM" }}.
+	<br /><br />
+	We're holding them for you until {{ .Entry.OfferUntil.Format "3:04 PM on January 2" }}, after that
+	they will be offered to the next person waiting.
+	<br /><br />
+	{{ with .Link }}<a href="{{ . }}">Book your seats</a>{{ else }}Please contact us to book your seats.{{ end }}`
+
+	t := template.Must(template.New("waitlist").Parse(tmpl))
+	var tpl bytes.Buffer
+	if err := t.Execute(&tpl, map[string]interface{}{
+		"Entry":   w,
+		"Product": product,
+		"Link":    w.Link(),
+	}); err != nil {
+		return err
+	}
+
+	from := mail.NewEmail(conf.EmailName, conf.EmailFrom)
+	to := mail.NewEmail(w.Name, w.Email)
+	m := mail.NewV3MailInit(from, "Seats are available for "+product, to, mail.NewContent("text/html", tpl.String()))
+	request := sendgrid.GetRequest(apiKey, "/v3/mail/send", "https://api.sendgrid.com")
+	request.Method = "POST"
+	request.Body = mail.GetRequestBody(m)
+	_, err := sendgrid.API(request)
+	return err
+}
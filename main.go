@@ -1,9 +1,7 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
@@ -13,11 +11,12 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/zeroshade/tmsapi/migrate"
+	"github.com/zeroshade/tmsapi/paypal"
 	"github.com/zeroshade/tmsapi/stripe"
 	"github.com/zeroshade/tmsapi/types"
 
 	"github.com/jinzhu/gorm"
-	"github.com/jinzhu/gorm/dialects/postgres"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 )
 
@@ -31,40 +30,6 @@ func init() {
 	}
 }
 
-func logActionMiddle(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userid, ok := c.Get("user_id")
-		if !ok {
-			return
-		}
-
-		var data []byte
-		if c.Request.Body != nil {
-			data, _ = ioutil.ReadAll(c.Request.Body)
-			c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(data))
-		}
-
-		l := types.LogAction{
-			MerchantID: c.Param("merchantid"),
-			UserID:     userid.(string),
-			Url:        c.Request.URL.Path,
-			Method:     c.Request.Method,
-			Payload:    postgres.Jsonb{data},
-		}
-
-		db.Create(&l)
-	}
-}
-
-func getLogActions(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var logs []types.LogAction
-		db.Order("created_at DESC").Find(&logs, "merchant_id = ?", c.Param("merchantid"))
-
-		c.JSON(http.StatusOK, logs)
-	}
-}
-
 func getStripeAcct(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var conf types.MerchantConfig
@@ -86,23 +51,13 @@ func main() {
 		log.Fatal(err)
 	}
 	defer db.Close()
-	db.AutoMigrate(&Product{}, &types.Schedule{}, &types.ScheduleTime{}, &TicketCategory{}, &Report{},
-		&types.Transaction{}, &types.Payment{}, &types.Sale{}, &types.PayerInfo{}, &types.WebHookEvent{}, &types.Item{}, &types.SandboxInfo{},
-		&types.CheckoutOrder{}, &types.Payer{}, &types.PurchaseItem{}, &types.PurchaseUnit{}, &types.Capture{}, &types.MerchantConfig{},
-		&ManualOverride{}, &types.Refund{}, &Boat{}, &types.LogAction{}, &stripe.PaymentIntent{}, &stripe.LineItem{})
-	db.Model(&types.Schedule{}).Association("TimeArray")
-	db.Model(&types.Schedule{}).Association("NotAvail")
-	db.Model(&types.Payment{}).Association("Payer.PayerInfo")
-	db.Model(&types.Item{}).AddForeignKey("transaction", "transactions(payment_id)", "CASCADE", "RESTRICT")
-	db.Model(&types.Transaction{}).AddForeignKey("payment_id", "payments(id)", "CASCADE", "RESTRICT")
-	db.Table("transaction_related").AddForeignKey("transaction_payment_id", "payments(id)", "CASCADE", "RESTRICT")
-	db.Table("transaction_related").AddForeignKey("sale_id", "sales(id)", "CASCADE", "RESTRICT")
-	db.Model(&types.PurchaseUnit{}).AddForeignKey("checkout_id", "checkout_orders(id)", "CASCADE", "RESTRICT")
-	db.Model(&types.PurchaseItem{}).AddForeignKey("checkout_id", "checkout_orders(id)", "CASCADE", "RESTRICT")
-
-	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS hstore").Error; err != nil {
+	pending, err := migrate.Pending(db.DB(), migrate.Dir())
+	if err != nil {
 		log.Fatal(err)
 	}
+	if len(pending) > 0 {
+		log.Fatalf("database has %d pending migrations, run `migrate up` first", len(pending))
+	}
 
 	// db.Exec("SET TIME ZONE 'America/New_York'")
 
@@ -114,6 +69,7 @@ func main() {
 	config := cors.DefaultConfig()
 	config.AllowHeaders = append(config.AllowHeaders, "Authorization", "x-calendar-origin")
 	config.AllowOrigins = []string{"*"}
+	config.ExposeHeaders = append(config.ExposeHeaders, "X-Total-Count")
 
 	router := gin.New()
 	router.Use(gin.Logger())
@@ -127,10 +83,29 @@ func main() {
 	addProductRoutes(merchant, db)
 	addUserRoutes(merchant, db)
 	addMerchantConfigRoutes(merchant, db)
+	addFeeRoutes(merchant, db)
+	addTaxRoutes(merchant, db)
+	addPromoRoutes(merchant, db)
+	addVoucherRoutes(merchant, db)
+	addPriceRuleRoutes(merchant, db)
+	addCharterRoutes(merchant, db)
+	addBalanceRoutes(merchant, db)
+	addCrewRoutes(merchant, db)
+	addWaitlistRoutes(merchant, db)
+	addPassengerRoutes(merchant, db)
+	addAddOnRoutes(merchant, db)
+	addCatchRoutes(merchant, db)
+	addPoolRoutes(merchant, db)
+	addSaleRoutes(merchant, db)
+	addScannerRoutes(merchant, db)
+	addCalendarRoutes(merchant, db)
+	addBlackoutRoutes(merchant, db)
 	stripe.AddStripeRoutes(merchant, getStripeAcct(db), db)
+	paypal.AddPaypalRoutes(merchant, db)
 	merchant.GET("/passes/:checkoutid", GetBoardingPasses(db))
 	merchant.GET("/logactions", checkJWT(), getLogActions(db))
 
+	router.Static("/uploads", photos.Dir)
 	router.POST("/stripehook", stripe.StripeWebhook(db))
 	router.POST("/paypal", HandlePaypalWebhook(db))
 	router.POST("/confirmed", ConfirmAndSend(db))
@@ -140,6 +115,13 @@ func main() {
 	router.GET("/transaction/:transaction", GetItems(db))
 	// router.POST("/sendrefund", RefundReq(db))
 
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	go runAuditPurge(purgeCtx, db)
+	go runBalanceReminders(purgeCtx, db)
+	go runWaitlistOffers(purgeCtx, db)
+	go runVoucherHolds(purgeCtx, db)
+
 	srv := &http.Server{
 		Addr:    ":" + port,
 		Handler: router,
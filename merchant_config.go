@@ -30,7 +30,15 @@ func UpdateMerchantConfig(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		conf.ID = c.Param("merchantid")
+
+		var old types.MerchantConfig
+		db.Find(&old, "id = ?", conf.ID)
+
 		db.Model(&conf).Updates(&conf)
+
+		var updated types.MerchantConfig
+		db.Find(&updated, "id = ?", conf.ID)
+		recordChange(c, "config", conf.ID, &old, &updated)
 		c.Status(http.StatusOK)
 	}
 }
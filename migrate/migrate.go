@@ -0,0 +1,293 @@
+// Package migrate applies the versioned SQL files in the migrations
+// directory to the database and keeps track of them in schema_migrations.
+//
+// Migration files are named NNNN_description.up.sql and
+// NNNN_description.down.sql and are applied in order of their version.
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDir is where the migration files live relative to the app root
+const DefaultDir = "migrations"
+
+// Baseline is the version of the migration which adopted the schema the app
+// already had in production, it is never reverted as that would drop tables
+// holding live data
+const Baseline = 1
+
+// ErrBaseline is returned by Down instead of reverting the baseline
+var ErrBaseline = errors.New("migrate: the baseline migration adopts the existing schema and can't be reverted")
+
+var fileRe = regexp.MustCompile(`^(\d+)_([\w-]+)\.(up|down)\.sql$`)
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status reports whether a migration has been applied and when
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Dir returns the migrations directory, $MIGRATIONS_DIR overrides the default
+func Dir() string {
+	if d := os.Getenv("MIGRATIONS_DIR"); d != "" {
+		return d
+	}
+	return DefaultDir
+}
+
+// Load reads all of the migrations found in dir sorted by version
+func Load(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, f := range files {
+		res := fileRe.FindStringSubmatch(f.Name())
+		if res == nil {
+			continue
+		}
+
+		version, _ := strconv.ParseUint(res[1], 10, 64)
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: res[2]}
+			byVersion[version] = m
+		} else if m.Name != res[2] {
+			return nil, fmt.Errorf("migrate: duplicate version %d (%s, %s)", version, m.Name, res[2])
+		}
+
+		if res[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	ret := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrate: version %d (%s) has no up migration", m.Version, m.Name)
+		}
+		ret = append(ret, *m)
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Version < ret[j].Version })
+	return ret, nil
+}
+
+func ensureTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamp with time zone NOT NULL DEFAULT now()
+	)`)
+	return err
+}
+
+func applied(db *sql.DB) (map[uint64]time.Time, error) {
+	ret := make(map[uint64]time.Time)
+
+	// nothing has been applied if the table hasn't been created yet, checking
+	// here rather than creating it keeps Pending and GetStatus read only
+	var exists bool
+	if err := db.QueryRow("SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return ret, nil
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v uint64
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		ret[v] = at
+	}
+	return ret, rows.Err()
+}
+
+// GetStatus lists every migration in dir along with when it was applied
+func GetStatus(db *sql.DB, dir string) ([]Status, error) {
+	migrations, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]Status, len(migrations))
+	for idx, m := range migrations {
+		ret[idx].Migration = m
+		if at, ok := done[m.Version]; ok {
+			at := at
+			ret[idx].AppliedAt = &at
+		}
+	}
+	return ret, nil
+}
+
+// Pending returns the migrations which haven't been applied yet
+func Pending(db *sql.DB, dir string) ([]Migration, error) {
+	status, err := GetStatus(db, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]Migration, 0)
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			ret = append(ret, s.Migration)
+		}
+	}
+	return ret, nil
+}
+
+func run(db *sql.DB, m Migration, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	script := m.Up
+	if !up {
+		script = m.Down
+	}
+
+	if _, err = tx.Exec(script); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migrate: %d_%s: %w", m.Version, m.Name, err)
+	}
+
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = $1", m.Version)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Up applies up to n pending migrations in order, n <= 0 applies all of them.
+// It returns the migrations which were applied.
+func Up(db *sql.DB, dir string, n int) ([]Migration, error) {
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+
+	pending, err := Pending(db, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if n > 0 && n < len(pending) {
+		pending = pending[:n]
+	}
+
+	for idx, m := range pending {
+		if err := run(db, m, true); err != nil {
+			return pending[:idx], err
+		}
+	}
+	return pending, nil
+}
+
+// Down reverts the last n applied migrations, newest first. It returns
+// ErrBaseline without reverting any of them if that would revert the
+// baseline.
+func Down(db *sql.DB, dir string, n int) ([]Migration, error) {
+	status, err := GetStatus(db, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	toRevert := make([]Migration, 0, n)
+	for idx := len(status) - 1; idx >= 0 && len(toRevert) < n; idx-- {
+		if status[idx].AppliedAt == nil {
+			continue
+		}
+		// refuse before reverting anything rather than stopping part way
+		if status[idx].Version <= Baseline {
+			return nil, ErrBaseline
+		}
+		toRevert = append(toRevert, status[idx].Migration)
+	}
+
+	for idx, m := range toRevert {
+		if m.Down == "" {
+			return toRevert[:idx], fmt.Errorf("migrate: %d_%s has no down migration", m.Version, m.Name)
+		}
+		if err := run(db, m, false); err != nil {
+			return toRevert[:idx], err
+		}
+	}
+	return toRevert, nil
+}
+
+// Create writes an empty up/down pair for a new migration using the next
+// available version number and returns the paths of the new files.
+func Create(dir, name string) (up, down string, err error) {
+	name = strings.Trim(regexp.MustCompile(`[^\w]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", fmt.Errorf("migrate: invalid migration name")
+	}
+
+	migrations, err := Load(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	next := uint64(1)
+	if len(migrations) > 0 {
+		next = migrations[len(migrations)-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", next, name))
+	up, down = base+".up.sql", base+".down.sql"
+	if err = ioutil.WriteFile(up, []byte("-- "+name+"\n"), 0644); err != nil {
+		return "", "", err
+	}
+	if err = ioutil.WriteFile(down, []byte("-- revert "+name+"\n"), 0644); err != nil {
+		return "", "", err
+	}
+	return up, down, nil
+}
@@ -0,0 +1,7 @@
+-- The baseline adopts the schema the app already had in production, reverting
+-- it would drop every table along with its data so it fails instead.
+DO $$
+BEGIN
+    RAISE EXCEPTION '0001_baseline adopts the existing schema and can''t be reverted';
+END
+$$;
@@ -0,0 +1,337 @@
+-- Baseline schema as previously created by gorm's AutoMigrate at startup.
+-- Everything here is idempotent so it can be applied to databases that were
+-- already migrated by older versions of the server.
+
+CREATE EXTENSION IF NOT EXISTS hstore;
+
+CREATE TABLE IF NOT EXISTS "products" (
+    "id" serial,
+    "merchant_id" varchar NOT NULL,
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "deleted_at" timestamp with time zone,
+    "name" text,
+    "desc" text,
+    "color" text,
+    "publish" boolean,
+    "show_tickets" boolean,
+    "fish" text,
+    "boat_id" integer DEFAULT 1,
+    PRIMARY KEY ("id", "merchant_id")
+);
+
+CREATE TABLE IF NOT EXISTS "schedules" (
+    "product_id" integer,
+    "id" serial,
+    "tickets_avail" integer,
+    "start" timestamp with time zone,
+    "end" timestamp with time zone,
+    "days" integer[],
+    "not_avail" text[],
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "schedule_times" (
+    "id" serial,
+    "schedule_id" integer,
+    "start_time" text,
+    "end_time" text,
+    "price" text,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "ticket_categories" (
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "deleted_at" timestamp with time zone,
+    "id" serial,
+    "merchant_id" text,
+    "name" text,
+    "categories" hstore,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS ticket_merchant ON "ticket_categories" (merchant_id);
+
+CREATE TABLE IF NOT EXISTS "reports" (
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "deleted_at" timestamp with time zone,
+    "id" serial,
+    "merchant_id" text,
+    "content" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS merchant ON "reports" (merchant_id);
+
+CREATE TABLE IF NOT EXISTS "payments" (
+    "update_time" timestamp with time zone,
+    "create_time" timestamp with time zone,
+    "id" text,
+    "state" text,
+    "intent" text,
+    "payment_method" text,
+    "status" text,
+    "payer_info_id" text,
+    "cart_id" text,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "transactions" (
+    "payment_id" text,
+    "total" money,
+    "payee_merchant_id" text,
+    "payee_email" text,
+    "desc" text,
+    "soft_desc" text,
+    PRIMARY KEY ("payment_id")
+);
+
+CREATE TABLE IF NOT EXISTS "sales" (
+    "update_time" timestamp with time zone,
+    "create_time" timestamp with time zone,
+    "id" text,
+    "total" money,
+    "payment_mode" text,
+    "transaction_fee" money,
+    "parent_payment" text,
+    "soft_desc" text,
+    "protect_eligible" text,
+    "state" text,
+    "invoice_num" text,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "transaction_related" (
+    "transaction_payment_id" text,
+    "sale_id" text,
+    PRIMARY KEY ("transaction_payment_id", "sale_id")
+);
+
+CREATE TABLE IF NOT EXISTS "payer_infos" (
+    "id" text,
+    "email" text,
+    "first_name" text,
+    "last_name" text,
+    "phone" text,
+    "country" text,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "webhook_logs" (
+    "id" text,
+    "create_time" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "resource_type" text,
+    "event_type" text,
+    "summary" text,
+    "status" text,
+    "event_version" numeric,
+    "raw_message" jsonb,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "items" (
+    "transaction" text,
+    "name" text,
+    "sku" text,
+    "price" money,
+    "currency" text,
+    "tax" money,
+    "qty" bigint,
+    PRIMARY KEY ("transaction", "sku")
+);
+
+CREATE TABLE IF NOT EXISTS "sandbox_infos" (
+    "id" text,
+    "sandbox_ids" text[],
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "checkout_orders" (
+    "update_time" timestamp with time zone,
+    "create_time" timestamp with time zone,
+    "id" text,
+    "intent" text,
+    "payer_id" text,
+    "status" text,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "payers" (
+    "id" text,
+    "given_name" text,
+    "surname" text,
+    "email" text,
+    "phone_number" text,
+    "alt_email" text,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "purchase_items" (
+    "checkout_id" text,
+    "sku" text,
+    "name" text,
+    "value" money,
+    "quantity" integer,
+    "description" text,
+    PRIMARY KEY ("checkout_id", "sku")
+);
+
+CREATE TABLE IF NOT EXISTS "purchase_units" (
+    "checkout_id" text,
+    "ref_id" text,
+    "value" money,
+    "item_value" money,
+    "payee_merchant_id" text,
+    "payee_email" text,
+    "description" text,
+    PRIMARY KEY ("checkout_id")
+);
+
+CREATE TABLE IF NOT EXISTS "captures" (
+    "update_time" timestamp with time zone,
+    "create_time" timestamp with time zone,
+    "id" text,
+    "checkout_id" text,
+    "status" text,
+    "value" money,
+    "gross_value" money,
+    "paypal_fee_value" money,
+    "net_value" money,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "merchant_configs" (
+    "id" text,
+    "pass_title" text,
+    "notify_number" text,
+    "email_from" text,
+    "email_name" text,
+    "email_content" text,
+    "send_sms" boolean DEFAULT false,
+    "terms_conds" text,
+    "sandbox_id" text,
+    "twilio_acct_s_id" text,
+    "twilio_acct_token" text,
+    "twilio_from_number" text,
+    "stripe_key" text,
+    "payment_type" text,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "manual_overrides" (
+    "product_id" serial,
+    "time" timestamp with time zone,
+    "cancelled" boolean,
+    "avail" integer,
+    PRIMARY KEY ("product_id", "time")
+);
+
+CREATE TABLE IF NOT EXISTS "refunds" (
+    "update_time" timestamp with time zone,
+    "create_time" timestamp with time zone,
+    "id" text,
+    "value" money,
+    "status" text,
+    "refund_net_value" money,
+    "refund_fee_value" money,
+    "refund_gross_value" money,
+    "refund_value" money,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "boats" (
+    "id" serial,
+    "name" text,
+    "color" text,
+    "merchant_id" varchar NOT NULL,
+    PRIMARY KEY ("id", "merchant_id")
+);
+
+CREATE TABLE IF NOT EXISTS "log_actions" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "deleted_at" timestamp with time zone,
+    "merchant_id" text,
+    "user_id" text,
+    "method" text,
+    "url" text,
+    "payload" jsonb,
+    PRIMARY KEY ("id")
+);
+-- audit columns which may be missing on databases migrated before they existed
+ALTER TABLE "log_actions" ADD COLUMN IF NOT EXISTS "user_name" text;
+ALTER TABLE "log_actions" ADD COLUMN IF NOT EXISTS "status" integer;
+ALTER TABLE "log_actions" ADD COLUMN IF NOT EXISTS "entity_type" text;
+ALTER TABLE "log_actions" ADD COLUMN IF NOT EXISTS "entity_id" text;
+ALTER TABLE "log_actions" ADD COLUMN IF NOT EXISTS "diff" jsonb;
+CREATE INDEX IF NOT EXISTS idx_log_actions_deleted_at ON "log_actions" (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_log_actions_merchant_id ON "log_actions" (merchant_id);
+CREATE INDEX IF NOT EXISTS idx_log_actions_user_id ON "log_actions" (user_id);
+CREATE INDEX IF NOT EXISTS log_entity ON "log_actions" (entity_type, entity_id);
+
+CREATE TABLE IF NOT EXISTS "payment_intents" (
+    "id" text,
+    "acct" text,
+    "created_at" timestamp with time zone,
+    "amount" money,
+    "email" text,
+    "name" text,
+    "status" text,
+    PRIMARY KEY ("id", "acct")
+);
+
+CREATE TABLE IF NOT EXISTS "line_items" (
+    "id" text,
+    "payment_id" text,
+    "acct" text,
+    "quantity" integer,
+    "sku" text,
+    "name" text,
+    "unit_price" money,
+    "amount" money,
+    PRIMARY KEY ("id", "payment_id")
+);
+
+DO $$
+BEGIN
+    ALTER TABLE "items" ADD CONSTRAINT items_transaction_transactions_payment_id_foreign
+        FOREIGN KEY ("transaction") REFERENCES transactions(payment_id) ON DELETE CASCADE ON UPDATE RESTRICT;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+    ALTER TABLE "transactions" ADD CONSTRAINT transactions_payment_id_payments_id_foreign
+        FOREIGN KEY (payment_id) REFERENCES payments(id) ON DELETE CASCADE ON UPDATE RESTRICT;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+    ALTER TABLE "transaction_related" ADD CONSTRAINT transaction_related_transaction_payment_id_payments_id_foreign
+        FOREIGN KEY (transaction_payment_id) REFERENCES payments(id) ON DELETE CASCADE ON UPDATE RESTRICT;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+    ALTER TABLE "transaction_related" ADD CONSTRAINT transaction_related_sale_id_sales_id_foreign
+        FOREIGN KEY (sale_id) REFERENCES sales(id) ON DELETE CASCADE ON UPDATE RESTRICT;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+    ALTER TABLE "purchase_units" ADD CONSTRAINT purchase_units_checkout_id_checkout_orders_id_foreign
+        FOREIGN KEY (checkout_id) REFERENCES checkout_orders(id) ON DELETE CASCADE ON UPDATE RESTRICT;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+    ALTER TABLE "purchase_items" ADD CONSTRAINT purchase_items_checkout_id_checkout_orders_id_foreign
+        FOREIGN KEY (checkout_id) REFERENCES checkout_orders(id) ON DELETE CASCADE ON UPDATE RESTRICT;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
@@ -0,0 +1,29 @@
+ALTER TABLE "transactions"
+    ALTER COLUMN "total" TYPE money USING ("total"::numeric / 100)::money;
+ALTER TABLE "sales"
+    ALTER COLUMN "total" TYPE money USING ("total"::numeric / 100)::money,
+    ALTER COLUMN "transaction_fee" TYPE money USING ("transaction_fee"::numeric / 100)::money;
+ALTER TABLE "items"
+    ALTER COLUMN "price" TYPE money USING ("price"::numeric / 100)::money,
+    ALTER COLUMN "tax" TYPE money USING ("tax"::numeric / 100)::money;
+ALTER TABLE "purchase_items"
+    ALTER COLUMN "value" TYPE money USING ("value"::numeric / 100)::money;
+ALTER TABLE "purchase_units"
+    ALTER COLUMN "value" TYPE money USING ("value"::numeric / 100)::money,
+    ALTER COLUMN "item_value" TYPE money USING ("item_value"::numeric / 100)::money;
+ALTER TABLE "captures"
+    ALTER COLUMN "value" TYPE money USING ("value"::numeric / 100)::money,
+    ALTER COLUMN "gross_value" TYPE money USING ("gross_value"::numeric / 100)::money,
+    ALTER COLUMN "paypal_fee_value" TYPE money USING ("paypal_fee_value"::numeric / 100)::money,
+    ALTER COLUMN "net_value" TYPE money USING ("net_value"::numeric / 100)::money;
+ALTER TABLE "refunds"
+    ALTER COLUMN "value" TYPE money USING ("value"::numeric / 100)::money,
+    ALTER COLUMN "refund_net_value" TYPE money USING ("refund_net_value"::numeric / 100)::money,
+    ALTER COLUMN "refund_fee_value" TYPE money USING ("refund_fee_value"::numeric / 100)::money,
+    ALTER COLUMN "refund_gross_value" TYPE money USING ("refund_gross_value"::numeric / 100)::money,
+    ALTER COLUMN "refund_value" TYPE money USING ("refund_value"::numeric / 100)::money;
+ALTER TABLE "payment_intents"
+    ALTER COLUMN "amount" TYPE money USING ("amount"::numeric / 100)::money;
+ALTER TABLE "line_items"
+    ALTER COLUMN "unit_price" TYPE money USING ("unit_price"::numeric / 100)::money,
+    ALTER COLUMN "amount" TYPE money USING ("amount"::numeric / 100)::money;
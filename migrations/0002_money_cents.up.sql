@@ -0,0 +1,31 @@
+-- Store amounts as integer cents instead of the locale dependent money type.
+
+ALTER TABLE "transactions"
+    ALTER COLUMN "total" TYPE bigint USING ROUND("total"::numeric * 100)::bigint;
+ALTER TABLE "sales"
+    ALTER COLUMN "total" TYPE bigint USING ROUND("total"::numeric * 100)::bigint,
+    ALTER COLUMN "transaction_fee" TYPE bigint USING ROUND("transaction_fee"::numeric * 100)::bigint;
+ALTER TABLE "items"
+    ALTER COLUMN "price" TYPE bigint USING ROUND("price"::numeric * 100)::bigint,
+    ALTER COLUMN "tax" TYPE bigint USING ROUND("tax"::numeric * 100)::bigint;
+ALTER TABLE "purchase_items"
+    ALTER COLUMN "value" TYPE bigint USING ROUND("value"::numeric * 100)::bigint;
+ALTER TABLE "purchase_units"
+    ALTER COLUMN "value" TYPE bigint USING ROUND("value"::numeric * 100)::bigint,
+    ALTER COLUMN "item_value" TYPE bigint USING ROUND("item_value"::numeric * 100)::bigint;
+ALTER TABLE "captures"
+    ALTER COLUMN "value" TYPE bigint USING ROUND("value"::numeric * 100)::bigint,
+    ALTER COLUMN "gross_value" TYPE bigint USING ROUND("gross_value"::numeric * 100)::bigint,
+    ALTER COLUMN "paypal_fee_value" TYPE bigint USING ROUND("paypal_fee_value"::numeric * 100)::bigint,
+    ALTER COLUMN "net_value" TYPE bigint USING ROUND("net_value"::numeric * 100)::bigint;
+ALTER TABLE "refunds"
+    ALTER COLUMN "value" TYPE bigint USING ROUND("value"::numeric * 100)::bigint,
+    ALTER COLUMN "refund_net_value" TYPE bigint USING ROUND("refund_net_value"::numeric * 100)::bigint,
+    ALTER COLUMN "refund_fee_value" TYPE bigint USING ROUND("refund_fee_value"::numeric * 100)::bigint,
+    ALTER COLUMN "refund_gross_value" TYPE bigint USING ROUND("refund_gross_value"::numeric * 100)::bigint,
+    ALTER COLUMN "refund_value" TYPE bigint USING ROUND("refund_value"::numeric * 100)::bigint;
+ALTER TABLE "payment_intents"
+    ALTER COLUMN "amount" TYPE bigint USING ROUND("amount"::numeric * 100)::bigint;
+ALTER TABLE "line_items"
+    ALTER COLUMN "unit_price" TYPE bigint USING ROUND("unit_price"::numeric * 100)::bigint,
+    ALTER COLUMN "amount" TYPE bigint USING ROUND("amount"::numeric * 100)::bigint;
@@ -0,0 +1,4 @@
+ALTER TABLE "checkout_orders" DROP COLUMN "fees", DROP COLUMN "commission";
+ALTER TABLE "payment_intents" DROP COLUMN "fees", DROP COLUMN "commission";
+ALTER TABLE "merchant_configs" DROP COLUMN "commission_bps";
+DROP TABLE IF EXISTS "fee_rules";
@@ -0,0 +1,27 @@
+CREATE TABLE "fee_rules" (
+    "id" serial,
+    "merchant_id" text,
+    "name" text,
+    "kind" text NOT NULL,
+    "amount" bigint NOT NULL DEFAULT 0,
+    "percent" bigint NOT NULL DEFAULT 0,
+    "step" bigint NOT NULL DEFAULT 0,
+    "tiers" jsonb NOT NULL DEFAULT '[]',
+    "cap" bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_fee_rules_merchant_id ON "fee_rules" (merchant_id);
+
+-- keep charging the fee that used to be hardcoded, $3 for every $50 of tickets
+INSERT INTO "fee_rules" (merchant_id, name, kind, amount, step)
+    SELECT id, 'Fees', 'step', 300, 5000 FROM "merchant_configs";
+
+ALTER TABLE "merchant_configs" ADD COLUMN "commission_bps" bigint NOT NULL DEFAULT 200;
+
+ALTER TABLE "payment_intents"
+    ADD COLUMN "fees" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "commission" bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE "checkout_orders"
+    ADD COLUMN "fees" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "commission" bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+ALTER TABLE "checkout_orders" DROP COLUMN "tax";
+ALTER TABLE "payment_intents" DROP COLUMN "tax";
+ALTER TABLE "purchase_units" DROP COLUMN "tax_value";
+ALTER TABLE "purchase_items" DROP COLUMN "tax_value";
+ALTER TABLE "line_items" DROP COLUMN "tax";
+DROP TABLE IF EXISTS "tax_rates";
@@ -0,0 +1,16 @@
+CREATE TABLE "tax_rates" (
+    "id" serial,
+    "merchant_id" text,
+    "name" text,
+    "rate" bigint NOT NULL DEFAULT 0,
+    "product_id" integer,
+    "ticket_category_id" integer REFERENCES "ticket_categories" (id) ON DELETE CASCADE,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_tax_rates_merchant_id ON "tax_rates" (merchant_id);
+
+ALTER TABLE "line_items" ADD COLUMN "tax" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "purchase_items" ADD COLUMN "tax_value" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "purchase_units" ADD COLUMN "tax_value" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "payment_intents" ADD COLUMN "tax" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "checkout_orders" ADD COLUMN "tax" bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+ALTER TABLE "checkout_orders" DROP COLUMN "discount", DROP COLUMN "promo_code";
+ALTER TABLE "payment_intents" DROP COLUMN "discount", DROP COLUMN "promo";
+ALTER TABLE "line_items" DROP COLUMN "discount";
+DROP TABLE IF EXISTS "promo_redemptions";
+DROP TABLE IF EXISTS "promo_codes";
@@ -0,0 +1,44 @@
+CREATE TABLE "promo_codes" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "merchant_id" text,
+    "code" text NOT NULL,
+    "description" text,
+    "kind" text NOT NULL,
+    "amount" bigint NOT NULL DEFAULT 0,
+    "percent" bigint NOT NULL DEFAULT 0,
+    "product_id" integer,
+    "ticket_category_id" integer REFERENCES "ticket_categories" (id) ON DELETE CASCADE,
+    "starts_at" timestamp with time zone,
+    "ends_at" timestamp with time zone,
+    "max_uses" integer NOT NULL DEFAULT 0,
+    "max_per_customer" integer NOT NULL DEFAULT 0,
+    "uses" integer NOT NULL DEFAULT 0,
+    "active" boolean NOT NULL DEFAULT true,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_promo_codes_merchant_id ON "promo_codes" (merchant_id);
+CREATE UNIQUE INDEX uix_promo_codes_merchant_code ON "promo_codes" (merchant_id, code);
+
+CREATE TABLE "promo_redemptions" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "promo_code_id" integer REFERENCES "promo_codes" (id) ON DELETE CASCADE,
+    "merchant_id" text,
+    "email" text,
+    "provider" text,
+    "order_id" text,
+    "discount" bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_promo_redemptions_promo_code_id ON "promo_redemptions" (promo_code_id);
+CREATE INDEX idx_promo_redemptions_merchant_id ON "promo_redemptions" (merchant_id);
+CREATE UNIQUE INDEX uix_promo_redemptions_order ON "promo_redemptions" (provider, order_id);
+
+ALTER TABLE "line_items" ADD COLUMN "discount" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "payment_intents"
+    ADD COLUMN "discount" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "promo" text;
+ALTER TABLE "checkout_orders"
+    ADD COLUMN "discount" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "promo_code" text;
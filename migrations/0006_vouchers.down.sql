@@ -0,0 +1,4 @@
+ALTER TABLE "checkout_orders" DROP COLUMN "credit", DROP COLUMN "voucher";
+ALTER TABLE "payment_intents" DROP COLUMN "credit", DROP COLUMN "voucher";
+DROP TABLE IF EXISTS "voucher_entries";
+DROP TABLE IF EXISTS "vouchers";
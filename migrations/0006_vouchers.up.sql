@@ -0,0 +1,40 @@
+CREATE TABLE "vouchers" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "merchant_id" text,
+    "code" text NOT NULL,
+    "kind" text NOT NULL,
+    "amount" bigint NOT NULL DEFAULT 0,
+    "balance" bigint NOT NULL DEFAULT 0 CHECK ("balance" >= 0),
+    "expires_at" timestamp with time zone,
+    "email" text,
+    "name" text,
+    "note" text,
+    "provider" text,
+    "order_id" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_vouchers_merchant_id ON "vouchers" (merchant_id);
+CREATE UNIQUE INDEX uix_vouchers_code ON "vouchers" (code);
+CREATE INDEX idx_vouchers_order ON "vouchers" (provider, order_id);
+
+CREATE TABLE "voucher_entries" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "voucher_id" integer REFERENCES "vouchers" (id) ON DELETE CASCADE,
+    "kind" text NOT NULL,
+    "amount" bigint NOT NULL DEFAULT 0,
+    "provider" text,
+    "order_id" text,
+    "user_id" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_voucher_entries_voucher_id ON "voucher_entries" (voucher_id);
+
+ALTER TABLE "payment_intents"
+    ADD COLUMN "credit" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "voucher" text;
+ALTER TABLE "checkout_orders"
+    ADD COLUMN "credit" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "voucher" text;
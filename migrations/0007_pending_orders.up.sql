@@ -0,0 +1,14 @@
+CREATE TABLE "pending_orders" (
+    "id" text,
+    "created_at" timestamp with time zone,
+    "merchant_id" text,
+    "payee" text,
+    "amount" bigint NOT NULL DEFAULT 0,
+    "items" hstore,
+    "promo" text,
+    "voucher" text,
+    "email" text,
+    "captured_at" timestamp with time zone,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_pending_orders_merchant_id ON "pending_orders" (merchant_id);
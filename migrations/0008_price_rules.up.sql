@@ -0,0 +1,21 @@
+CREATE TABLE "price_rules" (
+    "id" serial,
+    "merchant_id" text,
+    "product_id" integer,
+    "name" text,
+    "kind" text NOT NULL,
+    "priority" integer NOT NULL DEFAULT 0,
+    "active" boolean NOT NULL DEFAULT true,
+    "percent" bigint NOT NULL DEFAULT 0,
+    "amount" bigint NOT NULL DEFAULT 0,
+    "days" integer[],
+    "dates" text[],
+    "start_date" timestamp with time zone,
+    "end_date" timestamp with time zone,
+    "min_days" integer NOT NULL DEFAULT 0,
+    "max_hours" integer NOT NULL DEFAULT 0,
+    "min_percent" integer NOT NULL DEFAULT 0,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_price_rules_merchant_id ON "price_rules" (merchant_id);
+CREATE INDEX idx_price_rules_product_id ON "price_rules" (product_id);
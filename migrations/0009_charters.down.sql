@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS "charters";
+ALTER TABLE "products"
+    DROP COLUMN "kind",
+    DROP COLUMN "charter_price",
+    DROP COLUMN "charter_deposit",
+    DROP COLUMN "max_guests";
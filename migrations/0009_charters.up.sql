@@ -0,0 +1,30 @@
+ALTER TABLE "products"
+    ADD COLUMN "kind" text NOT NULL DEFAULT '',
+    ADD COLUMN "charter_price" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "charter_deposit" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "max_guests" integer NOT NULL DEFAULT 0;
+
+CREATE TABLE "charters" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "merchant_id" text,
+    "product_id" integer NOT NULL,
+    "boat_id" integer NOT NULL,
+    "start" timestamp with time zone NOT NULL,
+    "end" timestamp with time zone NOT NULL,
+    "status" text NOT NULL,
+    "hold_until" timestamp with time zone,
+    "leader_name" text,
+    "leader_email" text,
+    "leader_phone" text,
+    "headcount" integer NOT NULL DEFAULT 0,
+    "notes" text,
+    "price" bigint NOT NULL DEFAULT 0,
+    "deposit" bigint NOT NULL DEFAULT 0,
+    "provider" text,
+    "order_id" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_charters_merchant_id ON "charters" (merchant_id);
+CREATE INDEX idx_charters_boat_time ON "charters" (boat_id, start, "end");
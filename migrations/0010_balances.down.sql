@@ -0,0 +1,8 @@
+ALTER TABLE "pending_orders" DROP COLUMN "deposit", DROP COLUMN "balance_token";
+ALTER TABLE "checkout_orders" DROP COLUMN "balance";
+ALTER TABLE "payment_intents" DROP COLUMN "balance";
+ALTER TABLE "merchant_configs"
+    DROP COLUMN "deposit_bps",
+    DROP COLUMN "deposit_min_tickets",
+    DROP COLUMN "balance_days";
+DROP TABLE IF EXISTS "balance_dues";
@@ -0,0 +1,35 @@
+CREATE TABLE "balance_dues" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "merchant_id" text,
+    "token" text NOT NULL,
+    "provider" text,
+    "order_id" text,
+    "email" text,
+    "name" text,
+    "amount" bigint NOT NULL DEFAULT 0,
+    "commission" bigint NOT NULL DEFAULT 0,
+    "due_date" timestamp with time zone NOT NULL,
+    "pay_url" text,
+    "status" text NOT NULL,
+    "paid_at" timestamp with time zone,
+    "payment_id" text,
+    "reminded_at" timestamp with time zone,
+    "reminders" integer NOT NULL DEFAULT 0,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_balance_dues_merchant_id ON "balance_dues" (merchant_id);
+CREATE UNIQUE INDEX uix_balance_dues_token ON "balance_dues" (token);
+CREATE UNIQUE INDEX uix_balance_dues_order ON "balance_dues" (provider, order_id);
+CREATE INDEX idx_balance_dues_status_due ON "balance_dues" (status, due_date);
+
+ALTER TABLE "merchant_configs"
+    ADD COLUMN "deposit_bps" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "deposit_min_tickets" integer NOT NULL DEFAULT 0,
+    ADD COLUMN "balance_days" integer NOT NULL DEFAULT 7;
+ALTER TABLE "payment_intents" ADD COLUMN "balance" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "checkout_orders" ADD COLUMN "balance" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "pending_orders"
+    ADD COLUMN "deposit" boolean NOT NULL DEFAULT false,
+    ADD COLUMN "balance_token" text;
@@ -0,0 +1,4 @@
+ALTER TABLE "boats"
+    DROP COLUMN "capacity",
+    DROP COLUMN "crew_required",
+    DROP COLUMN "registration";
@@ -0,0 +1,4 @@
+ALTER TABLE "boats"
+    ADD COLUMN "capacity" integer NOT NULL DEFAULT 0,
+    ADD COLUMN "crew_required" integer NOT NULL DEFAULT 0,
+    ADD COLUMN "registration" text;
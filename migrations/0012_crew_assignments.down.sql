@@ -0,0 +1 @@
+DROP TABLE IF EXISTS "crew_assignments";
@@ -0,0 +1,18 @@
+CREATE TABLE "crew_assignments" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "merchant_id" text,
+    "user_id" text NOT NULL,
+    "name" text,
+    "role" text NOT NULL,
+    "product_id" integer NOT NULL,
+    "boat_id" integer NOT NULL DEFAULT 0,
+    "start" timestamp with time zone NOT NULL,
+    "end" timestamp with time zone NOT NULL,
+    "notes" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_crew_assignments_merchant_id ON "crew_assignments" (merchant_id);
+CREATE INDEX idx_crew_assignments_user_time ON "crew_assignments" (user_id, start, "end");
+CREATE INDEX idx_crew_assignments_trip ON "crew_assignments" (product_id, start);
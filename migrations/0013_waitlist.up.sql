@@ -0,0 +1,24 @@
+CREATE TABLE "waitlist_entries" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "merchant_id" text,
+    "product_id" integer NOT NULL,
+    "time" timestamp with time zone NOT NULL,
+    "party" integer NOT NULL,
+    "name" text,
+    "email" text,
+    "phone" text,
+    "position" integer NOT NULL DEFAULT 0,
+    "status" text NOT NULL,
+    "code" bigint NOT NULL DEFAULT 0,
+    "offered_at" timestamp with time zone,
+    "offer_until" timestamp with time zone,
+    "pay_url" text,
+    "provider" text,
+    "order_id" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_waitlist_entries_merchant_id ON "waitlist_entries" (merchant_id);
+CREATE INDEX idx_waitlist_entries_departure ON "waitlist_entries" (product_id, time, status);
+CREATE INDEX idx_waitlist_entries_code ON "waitlist_entries" (code);
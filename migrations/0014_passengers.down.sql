@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "waiver_signatures";
+DROP TABLE IF EXISTS "waivers";
+DROP TABLE IF EXISTS "passengers";
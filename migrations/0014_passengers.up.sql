@@ -0,0 +1,43 @@
+CREATE TABLE "passengers" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "merchant_id" text,
+    "order_id" text NOT NULL,
+    "sku" text NOT NULL,
+    "seat" integer NOT NULL,
+    "name" text,
+    "age_group" text,
+    "emergency_name" text,
+    "emergency_phone" text,
+    "checked_in_at" timestamp with time zone,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_passengers_merchant_id ON "passengers" (merchant_id);
+CREATE UNIQUE INDEX idx_passengers_seat ON "passengers" (order_id, sku, seat);
+
+CREATE TABLE "waivers" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "merchant_id" text,
+    "version" integer NOT NULL,
+    "title" text,
+    "body" text,
+    "active" boolean NOT NULL DEFAULT false,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX idx_waivers_version ON "waivers" (merchant_id, version);
+
+CREATE TABLE "waiver_signatures" (
+    "id" serial,
+    "merchant_id" text,
+    "passenger_id" integer NOT NULL,
+    "waiver_id" integer NOT NULL,
+    "version" integer NOT NULL,
+    "signature" text NOT NULL,
+    "signed_at" timestamp with time zone NOT NULL,
+    "ip" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_waiver_signatures_merchant_id ON "waiver_signatures" (merchant_id);
+CREATE INDEX idx_waiver_signatures_passenger_id ON "waiver_signatures" (passenger_id);
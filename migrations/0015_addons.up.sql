@@ -0,0 +1,16 @@
+CREATE TABLE "add_ons" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "deleted_at" timestamp with time zone,
+    "merchant_id" text,
+    "product_id" integer NOT NULL,
+    "name" text NOT NULL,
+    "desc" text,
+    "price" bigint NOT NULL DEFAULT 0,
+    "inventory" integer NOT NULL DEFAULT 0,
+    "publish" boolean NOT NULL DEFAULT false,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_add_ons_merchant_id ON "add_ons" (merchant_id);
+CREATE INDEX idx_add_ons_product_id ON "add_ons" (product_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "catch_photos";
+DROP TABLE IF EXISTS "catch_entries";
+DROP TABLE IF EXISTS "catch_reports";
@@ -0,0 +1,36 @@
+CREATE TABLE "catch_reports" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "merchant_id" text,
+    "product_id" integer NOT NULL,
+    "time" timestamp with time zone NOT NULL,
+    "user_id" text,
+    "captain" text,
+    "notes" text,
+    "published" boolean NOT NULL DEFAULT false,
+    "emailed_at" timestamp with time zone,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_catch_reports_merchant_id ON "catch_reports" (merchant_id);
+CREATE INDEX idx_catch_reports_time ON "catch_reports" (product_id, "time");
+
+CREATE TABLE "catch_entries" (
+    "id" serial,
+    "report_id" integer NOT NULL REFERENCES catch_reports(id) ON DELETE CASCADE,
+    "species" text NOT NULL,
+    "count" integer NOT NULL DEFAULT 0,
+    "largest_lbs" numeric,
+    "largest_by" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_catch_entries_report_id ON "catch_entries" (report_id);
+
+CREATE TABLE "catch_photos" (
+    "id" serial,
+    "report_id" integer NOT NULL REFERENCES catch_reports(id) ON DELETE CASCADE,
+    "url" text NOT NULL,
+    "caption" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_catch_photos_report_id ON "catch_photos" (report_id);
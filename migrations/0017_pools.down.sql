@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "pool_entries";
+DROP TABLE IF EXISTS "pools";
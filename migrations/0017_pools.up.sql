@@ -0,0 +1,33 @@
+CREATE TABLE "pools" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "merchant_id" text,
+    "product_id" integer NOT NULL,
+    "time" timestamp with time zone NOT NULL,
+    "name" text,
+    "entry_fee" bigint NOT NULL DEFAULT 0,
+    "house_bps" bigint NOT NULL DEFAULT 0,
+    "winner_id" integer,
+    "payout" bigint NOT NULL DEFAULT 0,
+    "paid_at" timestamp with time zone,
+    "paid_by" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_pools_merchant_id ON "pools" (merchant_id, "time");
+CREATE UNIQUE INDEX idx_pools_departure ON "pools" (product_id, "time");
+
+CREATE TABLE "pool_entries" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "pool_id" integer NOT NULL REFERENCES pools(id) ON DELETE CASCADE,
+    "passenger_id" integer NOT NULL,
+    "name" text,
+    "paid" bigint NOT NULL DEFAULT 0,
+    "method" text NOT NULL,
+    "weight_lbs" numeric NOT NULL DEFAULT 0,
+    "species" text,
+    "weighed_at" timestamp with time zone,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX idx_pool_entries_passenger ON "pool_entries" (pool_id, passenger_id);
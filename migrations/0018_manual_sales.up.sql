@@ -0,0 +1,19 @@
+CREATE TABLE "manual_sales" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "merchant_id" text,
+    "order_id" text NOT NULL,
+    "provider" text,
+    "channel" text NOT NULL,
+    "method" text NOT NULL,
+    "reference" text,
+    "amount" bigint NOT NULL DEFAULT 0,
+    "name" text,
+    "email" text,
+    "phone" text,
+    "notes" text,
+    "sold_by" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_manual_sales_merchant_id ON "manual_sales" (merchant_id, created_at);
+CREATE UNIQUE INDEX idx_manual_sales_order_id ON "manual_sales" (order_id);
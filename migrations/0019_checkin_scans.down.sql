@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "check_in_scans";
+ALTER TABLE "passengers" DROP COLUMN IF EXISTS "checked_in_device";
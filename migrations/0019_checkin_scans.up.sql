@@ -0,0 +1,17 @@
+ALTER TABLE "passengers" ADD COLUMN "checked_in_device" text;
+
+CREATE TABLE "check_in_scans" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "merchant_id" text,
+    "device_id" text NOT NULL,
+    "code" text NOT NULL,
+    "scanned_at" timestamp with time zone NOT NULL,
+    "status" text NOT NULL,
+    "passenger_id" integer,
+    "conflict_device" text,
+    "conflict_at" timestamp with time zone,
+    "warning" text,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX idx_check_in_scans_scan ON "check_in_scans" (merchant_id, device_id, code, scanned_at);
@@ -0,0 +1,12 @@
+CREATE TABLE "calendar_tokens" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "merchant_id" text,
+    "token" text NOT NULL,
+    "boat_id" integer NOT NULL DEFAULT 0,
+    "user_id" text,
+    "name" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_calendar_tokens_merchant_id ON "calendar_tokens" (merchant_id);
+CREATE UNIQUE INDEX idx_calendar_tokens_token ON "calendar_tokens" (token);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "extra_departures";
+DROP TABLE IF EXISTS "blackouts";
+ALTER TABLE "schedules" DROP COLUMN IF EXISTS "recur";
@@ -0,0 +1,30 @@
+ALTER TABLE "schedules" ADD COLUMN "recur" text;
+
+CREATE TABLE "blackouts" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "merchant_id" text,
+    "name" text NOT NULL,
+    "dates" text[],
+    "product_ids" integer[],
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_blackouts_merchant_id ON "blackouts" (merchant_id);
+CREATE INDEX idx_blackouts_product_ids ON "blackouts" USING GIN (product_ids);
+
+CREATE TABLE "extra_departures" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "updated_at" timestamp with time zone,
+    "merchant_id" text,
+    "product_id" integer NOT NULL,
+    "time" timestamp with time zone NOT NULL,
+    "end_time" text,
+    "price" text NOT NULL,
+    "tickets_avail" integer NOT NULL DEFAULT 0,
+    "notes" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_extra_departures_merchant_id ON "extra_departures" (merchant_id);
+CREATE UNIQUE INDEX idx_extra_departures_trip ON "extra_departures" (product_id, "time");
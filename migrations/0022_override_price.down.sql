@@ -0,0 +1 @@
+ALTER TABLE "manual_overrides" DROP COLUMN IF EXISTS "price";
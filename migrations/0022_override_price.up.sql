@@ -0,0 +1 @@
+ALTER TABLE "manual_overrides" ADD COLUMN "price" text NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE "pending_orders" DROP COLUMN IF EXISTS "flagged";
@@ -0,0 +1 @@
+ALTER TABLE "pending_orders" ADD COLUMN "flagged" text NOT NULL DEFAULT '';
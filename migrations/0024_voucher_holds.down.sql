@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_voucher_entries_holds;
+ALTER TABLE "pending_orders" DROP COLUMN IF EXISTS "voucher_hold";
@@ -0,0 +1,2 @@
+ALTER TABLE "pending_orders" ADD COLUMN "voucher_hold" integer NOT NULL DEFAULT 0;
+CREATE INDEX idx_voucher_entries_holds ON "voucher_entries" (created_at) WHERE kind = 'hold';
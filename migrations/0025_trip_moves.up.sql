@@ -0,0 +1,10 @@
+CREATE TABLE "trip_moves" (
+    "id" serial,
+    "created_at" timestamp with time zone,
+    "merchant_id" text,
+    "product_id" integer NOT NULL,
+    "from_time" timestamp with time zone NOT NULL,
+    "to_time" timestamp with time zone NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX idx_trip_moves_merchant_id ON "trip_moves" (merchant_id, product_id);
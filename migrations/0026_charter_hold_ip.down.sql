@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_charters_held;
+ALTER TABLE "charters" DROP COLUMN IF EXISTS "hold_ip";
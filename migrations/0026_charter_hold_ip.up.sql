@@ -0,0 +1,2 @@
+ALTER TABLE "charters" ADD COLUMN "hold_ip" text NOT NULL DEFAULT '';
+CREATE INDEX idx_charters_held ON "charters" (merchant_id, hold_until) WHERE status = 'held';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_promo_redemptions_holds;
+ALTER TABLE "pending_orders" DROP COLUMN IF EXISTS "promo_hold";
+DELETE FROM "promo_redemptions" WHERE pending;
+ALTER TABLE "promo_redemptions" DROP COLUMN IF EXISTS "pending";
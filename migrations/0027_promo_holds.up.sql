@@ -0,0 +1,3 @@
+ALTER TABLE "promo_redemptions" ADD COLUMN "pending" boolean NOT NULL DEFAULT false;
+ALTER TABLE "pending_orders" ADD COLUMN "promo_hold" integer NOT NULL DEFAULT 0;
+CREATE INDEX idx_promo_redemptions_holds ON "promo_redemptions" (created_at) WHERE pending;
@@ -50,6 +50,21 @@ func getUsers() gin.HandlerFunc {
 	}
 }
 
+// merchantUser looks up one of the merchant's users in Auth0, it is nil if
+// there is no such user or they belong to another merchant
+func merchantUser(userID, merchantID string) *internal.User {
+	u := auth0Client.GetUserByID(userID)
+	if u == nil || u.UserID == "" {
+		return nil
+	}
+
+	var mid string
+	if err := json.Unmarshal(u.AppMetadata["merchant_id"], &mid); err != nil || mid != merchantID {
+		return nil
+	}
+	return u
+}
+
 func createUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var u internal.User
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func addPassengerRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/waiver", GetWaiver(db))
+	router.PUT("/waiver", checkJWT(), logActionMiddle(db), SaveWaiver(db))
+	router.GET("/passengers/:checkoutid", GetPassengers(db))
+	router.PUT("/passengers/:checkoutid", SavePassengers(db))
+	router.POST("/passengers/:checkoutid/sign", SignWaiver(db))
+	router.POST("/checkin", checkJWT(), logActionMiddle(db), CheckIn(db))
+}
+
+// activeWaiver returns the merchant's latest waiver if passengers have to
+// sign it
+func activeWaiver(db *gorm.DB, merchantID string) *types.Waiver {
+	var w types.Waiver
+	if db.Where("merchant_id = ?", merchantID).Order("version desc").First(&w).RecordNotFound() || !w.Active {
+		return nil
+	}
+	return &w
+}
+
+// orderPassengers loads the passengers filled in for an order keyed by
+// their pass code
+func orderPassengers(db *gorm.DB, merchantID, orderID string) map[string]*types.Passenger {
+	var list []types.Passenger
+	db.Preload("Signature").Where("merchant_id = ? AND order_id = ?", merchantID, orderID).Find(&list)
+
+	out := make(map[string]*types.Passenger, len(list))
+	for idx := range list {
+		p := &list[idx]
+		out[types.PassCode(p.OrderID, p.Sku, p.Seat)] = p
+	}
+	return out
+}
+
+// GetWaiver returns the merchant's current waiver
+func GetWaiver(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var w types.Waiver
+		db.Where("merchant_id = ?", c.Param("merchantid")).Order("version desc").First(&w)
+		c.JSON(http.StatusOK, w)
+	}
+}
+
+// SaveWaiver saves the merchant's waiver, a change to its text becomes a new
+// version which passengers who haven't signed yet will sign
+func SaveWaiver(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in types.Waiver
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var old *types.Waiver
+		var cur types.Waiver
+		if !db.Where("merchant_id = ?", c.Param("merchantid")).Order("version desc").First(&cur).RecordNotFound() {
+			old = &cur
+		}
+
+		if old != nil && old.Title == in.Title && old.Body == in.Body {
+			db.Model(old).Update("active", in.Active)
+			updated := *old
+			updated.Active = in.Active
+			recordChange(c, "waiver", old.ID, old, &updated)
+			c.JSON(http.StatusOK, updated)
+			return
+		}
+
+		w := types.Waiver{
+			MerchantID: c.Param("merchantid"),
+			Version:    1,
+			Title:      in.Title,
+			Body:       in.Body,
+			Active:     in.Active,
+		}
+		if old != nil {
+			w.Version = old.Version + 1
+		}
+		db.Create(&w)
+		recordChange(c, "waiver", w.ID, old, &w)
+		c.JSON(http.StatusOK, w)
+	}
+}
+
+// GetPassengers lists a seat for every boarding pass of an order, with the
+// passenger details filled in so far, and the waiver they have to sign
+func GetPassengers(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		orderID := c.Param("checkoutid")
+		known := orderPassengers(db, conf.ID, orderID)
+
+		var out []types.Passenger
+		for sku, n := range pricing.OrderTickets(db, &conf, orderID) {
+			for seat := 1; seat <= n; seat++ {
+				if p, ok := known[types.PassCode(orderID, sku, seat)]; ok {
+					out = append(out, *p)
+				} else {
+					out = append(out, types.Passenger{OrderID: orderID, Sku: sku, Seat: seat})
+				}
+			}
+		}
+		sort.Slice(out, func(i, j int) bool {
+			if out[i].Sku != out[j].Sku {
+				return out[i].Sku < out[j].Sku
+			}
+			return out[i].Seat < out[j].Seat
+		})
+		c.JSON(http.StatusOK, gin.H{"passengers": out, "waiver": activeWaiver(db, conf.ID)})
+	}
+}
+
+// SavePassengers fills in the details of the passengers on an order. The
+// signature of anyone whose name changes is cleared as it no longer matches.
+func SavePassengers(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in []types.Passenger
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		orderID := c.Param("checkoutid")
+		seats := pricing.OrderTickets(db, &conf, orderID)
+		known := orderPassengers(db, conf.ID, orderID)
+
+		for _, p := range in {
+			if err := p.Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if p.Seat <= 0 || p.Seat > seats[p.Sku] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": types.ErrPassengerNotFound.Error()})
+				return
+			}
+			if old, ok := known[types.PassCode(orderID, p.Sku, p.Seat)]; ok && old.CheckedInAt != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": types.ErrPassengerCheckedIn.Error()})
+				return
+			}
+		}
+
+		out := make([]types.Passenger, 0, len(in))
+		for _, p := range in {
+			p.MerchantID, p.OrderID, p.CheckedInAt, p.CheckedInDevice, p.Signature = conf.ID, orderID, nil, "", nil
+			if old, ok := known[types.PassCode(orderID, p.Sku, p.Seat)]; ok {
+				p.ID, p.CreatedAt = old.ID, old.CreatedAt
+				if old.Signature != nil && (old.Name != p.Name || !p.Adult()) {
+					db.Delete(old.Signature)
+				} else {
+					p.Signature = old.Signature
+				}
+			}
+			db.Save(&p)
+			out = append(out, p)
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// SignWaiver records a passenger's typed signature of the current waiver
+// along with when it was signed and from where
+func SignWaiver(db *gorm.DB) gin.HandlerFunc {
+	type signReq struct {
+		Sku       string `json:"sku" binding:"required"`
+		Seat      int    `json:"seat" binding:"required"`
+		Signature string `json:"signature" binding:"required"`
+	}
+
+	return func(c *gin.Context) {
+		var req signReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		w := activeWaiver(db, c.Param("merchantid"))
+		if w == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "there is no waiver to sign"})
+			return
+		}
+
+		var p types.Passenger
+		if db.Preload("Signature").Where("merchant_id = ? AND order_id = ? AND sku = ? AND seat = ?",
+			c.Param("merchantid"), c.Param("checkoutid"), req.Sku, req.Seat).First(&p).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": types.ErrPassengerNotFound.Error()})
+			return
+		}
+		if !p.Adult() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": types.ErrWaiverNotAdult.Error()})
+			return
+		}
+		if !p.Matches(req.Signature) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": types.ErrWaiverSignature.Error()})
+			return
+		}
+
+		if p.Signature != nil {
+			db.Delete(p.Signature)
+		}
+		sig := types.WaiverSignature{
+			MerchantID:  p.MerchantID,
+			PassengerID: p.ID,
+			WaiverID:    w.ID,
+			Version:     w.Version,
+			Signature:   req.Signature,
+			SignedAt:    time.Now(),
+			IP:          c.ClientIP(),
+		}
+		db.Create(&sig)
+		p.Signature = &sig
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// CheckIn checks in the passenger of a scanned boarding pass, refusing
+// adults who haven't signed the latest waiver when the merchant has one. The
+// scanner can say which device it is.
+func CheckIn(db *gorm.DB) gin.HandlerFunc {
+	type checkInReq struct {
+		Code   string `json:"code" binding:"required"`
+		Device string `json:"device"`
+	}
+
+	return func(c *gin.Context) {
+		var req checkInReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		orderID, sku, seat, ok := pricing.ResolvePassCode(db, &conf, req.Code)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": types.ErrPassengerNotFound.Error()})
+			return
+		}
+
+		p := orderPassengers(db, conf.ID, orderID)[types.PassCode(orderID, sku, seat)]
+		if p == nil {
+			p = &types.Passenger{MerchantID: conf.ID, OrderID: orderID, Sku: sku, Seat: seat}
+		}
+		if p.CheckedInAt != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": types.ErrPassengerCheckedIn.Error(), "passenger": p})
+			return
+		}
+		if !p.CanBoard(activeWaiver(db, conf.ID)) {
+			c.JSON(http.StatusConflict, gin.H{"error": types.ErrWaiverUnsigned.Error(), "passenger": p})
+			return
+		}
+
+		old := *p
+		now := time.Now()
+		p.CheckedInAt, p.CheckedInDevice = &now, req.Device
+		if p.ID == 0 {
+			db.Create(p)
+		} else {
+			db.Model(p).Updates(map[string]interface{}{"checked_in_at": p.CheckedInAt, "checked_in_device": p.CheckedInDevice})
+		}
+		recordChange(c, "passenger", p.ID, &old, p)
+		c.JSON(http.StatusOK, p)
+	}
+}
@@ -6,10 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"regexp"
-	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
@@ -129,15 +126,14 @@ func HandlePaypalWebhook(db *gorm.DB) gin.HandlerFunc {
 					var items []types.PurchaseItem
 					db.Find(&items, "checkout_id = ?", capture.CheckoutID)
 
-					re := regexp.MustCompile(`(\d+)[A-Z]+(\d{10})`)
+					// fees, gift cards, balances and add-ons aren't seats
 					for _, i := range items {
-						res := re.FindStringSubmatch(i.Sku)
-						pid, _ := strconv.Atoi(res[1])
-						timestamp, _ := strconv.ParseInt(res[2], 10, 64)
+						info, ok := types.ParseSku(i.Sku)
+						if !ok {
+							continue
+						}
 
-						tm := time.Unix(timestamp, 0).In(timeloc)
-
-						db.Model(ManualOverride{}).Where("product_id = ? AND time = ?", pid, tm).
+						db.Model(ManualOverride{}).Where("product_id = ? AND time = ?", info.ProductID, info.Time).
 							UpdateColumn("avail", gorm.Expr("avail + ?", i.Quantity))
 					}
 				}
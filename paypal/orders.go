@@ -0,0 +1,317 @@
+package paypal
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/zeroshade/tmsapi/internal"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func AddPaypalRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.POST("/paypal/orders", CreateOrder(db))
+	router.POST("/paypal/balances/:token", CreateBalanceOrder(db))
+}
+
+type orderAmount struct {
+	CurrencyCode string      `json:"currency_code"`
+	Value        types.Money `json:"value"`
+}
+
+type orderItem struct {
+	Name        string      `json:"name"`
+	Sku         string      `json:"sku"`
+	Description string      `json:"description,omitempty"`
+	UnitAmount  orderAmount `json:"unit_amount"`
+	Tax         orderAmount `json:"tax"`
+	Quantity    string      `json:"quantity"`
+}
+
+type orderUnit struct {
+	ReferenceID string `json:"reference_id"`
+	Description string `json:"description"`
+	Payee       struct {
+		MerchantID string `json:"merchant_id"`
+	} `json:"payee"`
+	Amount struct {
+		orderAmount
+		Breakdown struct {
+			ItemTotal orderAmount `json:"item_total"`
+			TaxTotal  orderAmount `json:"tax_total"`
+			Discount  orderAmount `json:"discount"`
+		} `json:"breakdown"`
+	} `json:"amount"`
+	Items []orderItem `json:"items"`
+}
+
+type orderRequest struct {
+	Intent        string      `json:"intent"`
+	PurchaseUnits []orderUnit `json:"purchase_units"`
+}
+
+func newAmount(m types.Money) orderAmount {
+	return orderAmount{CurrencyCode: m.CurrencyCode(), Value: m}
+}
+
+// payeeID returns the PayPal merchant id orders should be paid to, which is
+// the merchant's first sandbox account when running against the sandbox.
+func payeeID(db *gorm.DB, conf *types.MerchantConfig, env internal.Env) string {
+	if env == internal.SANDBOX {
+		si := types.SandboxInfo{ID: conf.ID}
+		db.Find(&si)
+		if len(si.SandboxIDs) > 0 {
+			return si.SandboxIDs[0]
+		}
+	}
+	return conf.ID
+}
+
+// buildOrder turns a quote into a v2 checkout order. Fees are sent as their
+// own items, and the promo discount, voucher credit and any balance left
+// for later are all taken off as the order's discount, so the total comes
+// to what is due.
+func buildOrder(quote *pricing.Quote, payee string) *orderRequest {
+	req := &orderRequest{Intent: "CAPTURE", PurchaseUnits: make([]orderUnit, 1)}
+
+	pu := &req.PurchaseUnits[0]
+	pu.ReferenceID = "default"
+	pu.Description = "Ticket Purchase"
+	pu.Payee.MerchantID = payee
+
+	zero := types.NewMoney(0, "")
+	for _, line := range quote.Lines {
+		pu.Items = append(pu.Items, orderItem{
+			Name:        line.Name,
+			Sku:         line.Sku,
+			Description: line.Desc,
+			UnitAmount:  newAmount(line.Unit),
+			Tax:         newAmount(line.UnitTax),
+			Quantity:    strconv.FormatInt(line.Quantity, 10),
+		})
+	}
+	for _, fee := range quote.Fees {
+		pu.Items = append(pu.Items, orderItem{
+			Name:       fee.Name,
+			Sku:        pricing.FeeSku,
+			UnitAmount: newAmount(fee.Amount),
+			Tax:        newAmount(zero),
+			Quantity:   "1",
+		})
+	}
+
+	pu.Amount.orderAmount = newAmount(quote.Due)
+	pu.Amount.Breakdown.ItemTotal = newAmount(quote.Subtotal.Add(quote.FeeTotal))
+	pu.Amount.Breakdown.TaxTotal = newAmount(quote.TaxTotal)
+	pu.Amount.Breakdown.Discount = newAmount(quote.Discount.Add(quote.Credit).Add(quote.Balance))
+	return req
+}
+
+// CreateOrder builds a PayPal order from a validated cart, the same way
+// stripe.CreateSession does, and returns its id for the PayPal JS SDK.
+func CreateOrder(db *gorm.DB) gin.HandlerFunc {
+	env := internal.SANDBOX
+	if strings.ToLower(os.Getenv("PAYPAL_ENV")) == "live" {
+		env = internal.LIVE
+	}
+
+	return func(c *gin.Context) {
+		var cart []pricing.CartItem
+		if err := c.ShouldBindJSON(&cart); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		cart, verr := pricing.ValidateCart(db, &conf, cart)
+		if verr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": verr.Error(), "items": verr.Items})
+			return
+		}
+
+		var (
+			opts = pricing.Options{Deposit: c.Query("deposit") == "true"}
+			err  error
+		)
+		email := c.Query("email")
+		if opts.Promo, err = pricing.LoadPromo(db, conf.ID, c.Query("promo"), email); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if opts.Voucher, err = pricing.LoadVoucher(db, conf.ID, c.Query("voucher")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		quote := pricing.QuoteCart(db, &conf, cart, opts)
+		if quote.Due.Cents <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nothing left to pay, check out with the voucher instead"})
+			return
+		}
+
+		// the credit and the promo code's use are held before PayPal has
+		// the order so two checkouts can't both spend them
+		var (
+			hold      *types.VoucherEntry
+			promoHold *types.PromoRedemption
+		)
+		release := func() {
+			if hold != nil {
+				pricing.ReleaseHold(db, hold.ID)
+			}
+			if promoHold != nil {
+				pricing.ReleasePromo(db, promoHold.ID)
+			}
+		}
+		if opts.Promo != nil && !quote.Discount.IsZero() {
+			if promoHold, err = pricing.HoldPromo(db, opts.Promo, email); err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if opts.Voucher != nil {
+			if hold, err = pricing.HoldVoucher(db, opts.Voucher, quote.Credit); err != nil {
+				release()
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		payee := payeeID(db, &conf, env)
+		id, ok := submitOrder(c, env, buildOrder(quote, payee))
+		if !ok {
+			release()
+			return
+		}
+
+		qtys := make(map[string]int64)
+		for _, line := range quote.Lines {
+			qtys[line.Sku] += line.Quantity
+		}
+		items := make(postgres.Hstore)
+		for sku, qty := range qtys {
+			q := strconv.FormatInt(qty, 10)
+			items[sku] = &q
+		}
+
+		pending := types.PendingOrder{
+			ID:         id,
+			MerchantID: conf.ID,
+			Payee:      payee,
+			Amount:     quote.Due,
+			Items:      items,
+			Promo:      quote.Promo,
+			Voucher:    quote.Voucher,
+			Email:      email,
+			Deposit:    !quote.Balance.IsZero(),
+		}
+		if hold != nil {
+			pending.VoucherHold = hold.ID
+		}
+		if promoHold != nil {
+			pending.PromoHold = promoHold.ID
+		}
+		db.Create(&pending)
+
+		c.JSON(http.StatusOK, gin.H{"id": id, "quote": quote})
+	}
+}
+
+// submitOrder creates an order with PayPal, writing PayPal's response if it
+// fails.
+func submitOrder(c *gin.Context, env internal.Env, order *orderRequest) (string, bool) {
+	resp, err := internal.NewClient(env).CreateOrder(order)
+	if err != nil {
+		c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
+		return "", false
+	}
+	defer resp.Body.Close()
+
+	var created struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var f interface{}
+		json.NewDecoder(resp.Body).Decode(&f)
+		c.JSON(resp.StatusCode, f)
+		return "", false
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return created.ID, true
+}
+
+// CreateBalanceOrder creates a PayPal order for paying off the balance of a
+// booking made with a deposit, which is captured by the balance's capture
+// endpoint.
+func CreateBalanceOrder(db *gorm.DB) gin.HandlerFunc {
+	env := internal.SANDBOX
+	if strings.ToLower(os.Getenv("PAYPAL_ENV")) == "live" {
+		env = internal.LIVE
+	}
+
+	return func(c *gin.Context) {
+		b, err := pricing.LoadBalance(db, c.Param("merchantid"), c.Param("token"))
+		switch err {
+		case nil:
+		case types.ErrBalanceNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", b.MerchantID)
+
+		zero := types.NewMoney(0, b.Amount.Currency)
+		payee := payeeID(db, &conf, env)
+		req := &orderRequest{Intent: "CAPTURE", PurchaseUnits: make([]orderUnit, 1)}
+		pu := &req.PurchaseUnits[0]
+		pu.ReferenceID = "default"
+		pu.Description = "Balance Payment"
+		pu.Payee.MerchantID = payee
+		pu.Items = []orderItem{{
+			Name:        "Balance Due",
+			Sku:         pricing.BalanceSku,
+			Description: "Balance for order " + b.OrderID,
+			UnitAmount:  newAmount(b.Amount),
+			Tax:         newAmount(zero),
+			Quantity:    "1",
+		}}
+		pu.Amount.orderAmount = newAmount(b.Amount)
+		pu.Amount.Breakdown.ItemTotal = newAmount(b.Amount)
+		pu.Amount.Breakdown.TaxTotal = newAmount(zero)
+		pu.Amount.Breakdown.Discount = newAmount(zero)
+
+		id, ok := submitOrder(c, env, req)
+		if !ok {
+			return
+		}
+
+		one := "1"
+		db.Create(&types.PendingOrder{
+			ID:           id,
+			MerchantID:   conf.ID,
+			Payee:        payee,
+			Amount:       b.Amount,
+			Items:        postgres.Hstore{pricing.BalanceSku: &one},
+			Email:        b.Email,
+			BalanceToken: b.Token,
+		})
+
+		c.JSON(http.StatusOK, gin.H{"id": id, "balance": b})
+	}
+}
@@ -18,17 +18,17 @@ type Handler struct{}
 
 func (h Handler) OrdersTimestamp(config *types.MerchantConfig, db *gorm.DB, timestamp string) (interface{}, error) {
 	type Ret struct {
-		Name        string `json:"name"`
-		Description string `json:"desc"`
-		Value       string `json:"value"`
-		Payer       string `json:"payer"`
-		PayerID     string `json:"payerId"`
-		Email       string `json:"email"`
-		PhoneNumber string `json:"phone"`
-		Quantity    uint   `json:"qty"`
-		Coid        string `json:"coid"`
-		Sku         string `json:"sku"`
-		Status      string `json:"status"`
+		Name        string      `json:"name"`
+		Description string      `json:"desc"`
+		Value       types.Money `json:"value"`
+		Payer       string      `json:"payer"`
+		PayerID     string      `json:"payerId"`
+		Email       string      `json:"email"`
+		PhoneNumber string      `json:"phone"`
+		Quantity    uint        `json:"qty"`
+		Coid        string      `json:"coid"`
+		Sku         string      `json:"sku"`
+		Status      string      `json:"status"`
 	}
 
 	var sids pq.StringArray
@@ -90,7 +90,7 @@ func (h Handler) GetPassItems(conf *types.MerchantConfig, db *gorm.DB, id string
 	var email string
 	var payerId string
 
-	db.Where("checkout_id = ?", id).
+	db.Where("checkout_id = ? AND sku ~ '^\\d+[A-Z]+\\d{10}'", id).
 		Select([]string{"checkout_id", "sku", "name", "value", "quantity",
 			`COALESCE(NULLIF(description, ''), SUBSTRING(name from '\w* Ticket, [^,]*, (.*)')) as description`}).
 		Find(&items)
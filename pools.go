@@ -0,0 +1,240 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func addPoolRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/pools/:pid/:timestamp", checkJWT(), GetPool(db))
+	router.PUT("/pools", checkJWT(), logActionMiddle(db), SavePool(db))
+	router.POST("/pools/:id/entries", checkJWT(), logActionMiddle(db), EnterPool(db))
+	router.DELETE("/pools/:id/entries/:entry", checkJWT(), logActionMiddle(db), DeletePoolEntry(db))
+	router.PUT("/pools/:id/weighin", checkJWT(), logActionMiddle(db), WeighIn(db))
+	router.POST("/pools/:id/payout", checkJWT(), logActionMiddle(db), PayoutPool(db))
+}
+
+// poolError responds with the status for an error from running a pool
+func poolError(c *gin.Context, err error) {
+	switch err {
+	case types.ErrPoolNotFound, types.ErrPassengerNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case types.ErrPoolEntered, types.ErrPoolSettled:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// GetPool returns the pool of the departure of a product with its entries
+// and totals
+func GetPool(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ts, err := strconv.ParseInt(c.Param("timestamp"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var id uint
+		row := db.Model(&types.Pool{}).Select("id").
+			Where("merchant_id = ? AND product_id = ? AND time = ?", c.Param("merchantid"), c.Param("pid"), time.Unix(ts, 0)).Row()
+		if row.Scan(&id) != nil {
+			poolError(c, types.ErrPoolNotFound)
+			return
+		}
+
+		p, err := pricing.LoadPool(db, c.Param("merchantid"), id)
+		if err != nil {
+			poolError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"pool": p, "summary": p.Summary()})
+	}
+}
+
+// SavePool opens the pool of a departure or changes its entry fee and the
+// house's share until it has been paid out
+func SavePool(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in types.Pool
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := in.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		merchantID := c.Param("merchantid")
+		var prod Product
+		if db.Find(&prod, "id = ? AND merchant_id = ?", in.ProductID, merchantID).RecordNotFound() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "product not found"})
+			return
+		}
+
+		var old *types.Pool
+		if in.ID != 0 {
+			var err error
+			if old, err = pricing.LoadPool(db, merchantID, in.ID); err != nil {
+				poolError(c, err)
+				return
+			}
+			if old.PaidAt != nil {
+				poolError(c, types.ErrPoolSettled)
+				return
+			}
+			in.CreatedAt = old.CreatedAt
+		}
+
+		in.MerchantID = merchantID
+		in.Time = in.Time.In(timeloc)
+		in.WinnerID, in.Payout, in.PaidAt, in.PaidBy = nil, types.Money{}, nil, ""
+		if in.Name == "" {
+			in.Name = "Biggest fish"
+		}
+		in.Entries = nil
+
+		if err := db.Omit("Entries").Save(&in).Error; err != nil {
+			// one pool per departure is enforced by a unique index
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" &&
+				pqErr.Constraint == "idx_pools_departure" {
+				c.JSON(http.StatusConflict, gin.H{"error": "this trip already has a pool"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		p, _ := pricing.LoadPool(db, merchantID, in.ID)
+		recordChange(c, "pool", in.ID, old, p)
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// EnterPool buys a checked in passenger into a pool
+func EnterPool(db *gorm.DB) gin.HandlerFunc {
+	type entryReq struct {
+		PassengerID uint   `json:"passengerId" binding:"required"`
+		Method      string `json:"method" binding:"required"`
+	}
+
+	return func(c *gin.Context) {
+		var req entryReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		p, err := pricing.LoadPool(db, c.Param("merchantid"), c.Param("id"))
+		if err != nil {
+			poolError(c, err)
+			return
+		}
+
+		e, err := pricing.EnterPool(db, p, req.PassengerID, req.Method)
+		if err != nil {
+			poolError(c, err)
+			return
+		}
+		recordChange(c, "pool_entry", e.ID, nil, e)
+		c.JSON(http.StatusOK, e)
+	}
+}
+
+// DeletePoolEntry refunds a passenger's buy in before the pool is paid out
+func DeletePoolEntry(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := pricing.LoadPool(db, c.Param("merchantid"), c.Param("id"))
+		if err != nil {
+			poolError(c, err)
+			return
+		}
+		if p.PaidAt != nil {
+			poolError(c, types.ErrPoolSettled)
+			return
+		}
+
+		var e types.PoolEntry
+		if db.Where("id = ? AND pool_id = ?", c.Param("entry"), p.ID).First(&e).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "pool entry not found"})
+			return
+		}
+		db.Delete(&e)
+		recordChange(c, "pool_entry", e.ID, &e, nil)
+		c.Status(http.StatusOK)
+	}
+}
+
+// WeighIn records the fish an entry weighed in, weighing again replaces it
+func WeighIn(db *gorm.DB) gin.HandlerFunc {
+	type weighReq struct {
+		EntryID   uint    `json:"entryId" binding:"required"`
+		WeightLbs float64 `json:"weightLbs"`
+		Species   string  `json:"species"`
+	}
+
+	return func(c *gin.Context) {
+		var req weighReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.WeightLbs < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "weight can't be negative"})
+			return
+		}
+
+		p, err := pricing.LoadPool(db, c.Param("merchantid"), c.Param("id"))
+		if err != nil {
+			poolError(c, err)
+			return
+		}
+		if p.PaidAt != nil {
+			poolError(c, types.ErrPoolSettled)
+			return
+		}
+
+		var e types.PoolEntry
+		if db.Where("id = ? AND pool_id = ?", req.EntryID, p.ID).First(&e).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "pool entry not found"})
+			return
+		}
+
+		old := e
+		now := time.Now()
+		e.WeightLbs, e.Species, e.WeighedAt = req.WeightLbs, req.Species, &now
+		db.Save(&e)
+		recordChange(c, "pool_entry", e.ID, &old, &e)
+
+		p, _ = pricing.LoadPool(db, p.MerchantID, p.ID)
+		c.JSON(http.StatusOK, gin.H{"pool": p, "summary": p.Summary()})
+	}
+}
+
+// PayoutPool pays the pool to the heaviest fish weighed in
+func PayoutPool(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := pricing.LoadPool(db, c.Param("merchantid"), c.Param("id"))
+		if err != nil {
+			poolError(c, err)
+			return
+		}
+
+		old := *p
+		if err := pricing.SettlePool(db, p, c.GetString("user_id")); err != nil {
+			poolError(c, err)
+			return
+		}
+		recordChange(c, "pool", p.ID, &old, p)
+		c.JSON(http.StatusOK, gin.H{"pool": p, "summary": p.Summary()})
+	}
+}
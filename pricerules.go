@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// maxPriceRange is the longest range of dates prices are worked out for
+const maxPriceRange = 92 * 24 * time.Hour
+
+func addPriceRuleRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/pricerules", checkJWT(), GetPriceRules(db))
+	router.PUT("/pricerules", checkJWT(), logActionMiddle(db), SavePriceRules(db))
+	router.DELETE("/pricerules/:id", checkJWT(), logActionMiddle(db), DeletePriceRule(db))
+	router.POST("/pricerules/preview/:from/:to", checkJWT(), PreviewPrices(db))
+	router.GET("/prices/:from/:to", GetTripPrices(db))
+}
+
+// GetPriceRules returns the merchant's dynamic pricing rules, only those
+// for one product and the merchant wide ones if ?product= is given
+func GetPriceRules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules := pricing.LoadPriceRules(db, c.Param("merchantid"))
+		if pid := c.Query("product"); pid != "" {
+			out := make([]types.PriceRule, 0, len(rules))
+			for _, r := range rules {
+				if r.ProductID == nil || strconv.FormatUint(uint64(*r.ProductID), 10) == pid {
+					out = append(out, r)
+				}
+			}
+			rules = out
+		}
+		c.JSON(http.StatusOK, rules)
+	}
+}
+
+// SavePriceRules creates or updates all of the price rules in the request
+func SavePriceRules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rules []types.PriceRule
+		if err := c.ShouldBindJSON(&rules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		for idx := range rules {
+			if err := rules[idx].Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			// an id has to be one of the merchant's own rules or saving it
+			// would overwrite another merchant's
+			if rules[idx].ID != 0 && db.Where("id = ? AND merchant_id = ?", rules[idx].ID, c.Param("merchantid")).
+				First(&types.PriceRule{}).RecordNotFound() {
+				c.JSON(http.StatusNotFound, gin.H{"error": "price rule not found"})
+				return
+			}
+		}
+
+		for _, r := range rules {
+			r.MerchantID = c.Param("merchantid")
+
+			var old *types.PriceRule
+			if r.ID != 0 {
+				old = &types.PriceRule{}
+				db.Find(old, "id = ? AND merchant_id = ?", r.ID, r.MerchantID)
+			}
+
+			db.Save(&r)
+			recordChange(c, "price_rule", r.ID, old, &r)
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+func DeletePriceRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var old types.PriceRule
+		db.Find(&old, "id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid"))
+
+		db.Where("id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid")).Delete(types.PriceRule{})
+		recordChange(c, "price_rule", c.Param("id"), &old, nil)
+		c.Status(http.StatusOK)
+	}
+}
+
+// tripRange reads the :from/:to dates and optional ?product= of a request
+// and lists the departures in it
+func tripRange(c *gin.Context, db *gorm.DB) ([]pricing.Departure, error) {
+	from, err := time.ParseInLocation("2006-01-02", c.Param("from"), timeloc)
+	if err != nil {
+		return nil, err
+	}
+	to, err := time.ParseInLocation("2006-01-02", c.Param("to"), timeloc)
+	if err != nil {
+		return nil, err
+	}
+	if to.Before(from) || to.Sub(from) > maxPriceRange {
+		return nil, errors.New("date range must be in order and at most 92 days")
+	}
+
+	var pid uint64
+	if p := c.Query("product"); p != "" {
+		if pid, err = strconv.ParseUint(p, 10, 32); err != nil {
+			return nil, err
+		}
+	}
+	return pricing.Departures(db, c.Param("merchantid"), uint(pid), from, to), nil
+}
+
+// GetTripPrices returns the seats left and current ticket prices of every
+// departure between two dates, for the booking calendar.
+func GetTripPrices(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deps, err := tripRange(c, db)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+		c.JSON(http.StatusOK, pricing.PriceTrips(db, &conf, pricing.LoadPriceRules(db, conf.ID), deps))
+	}
+}
+
+// PreviewPrices shows what ticket prices would be over a range of dates
+// with the price rules in the request, so they can be tried out before
+// they are saved.
+func PreviewPrices(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rules []types.PriceRule
+		if err := c.ShouldBindJSON(&rules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for idx := range rules {
+			if err := rules[idx].Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority < rules[j].Priority })
+
+		deps, err := tripRange(c, db)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+		c.JSON(http.StatusOK, pricing.PriceTrips(db, &conf, rules, deps))
+	}
+}
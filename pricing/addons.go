@@ -0,0 +1,157 @@
+package pricing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// addOnLine is every unit of one add-on for one departure in a cart
+type addOnLine struct {
+	first     int
+	qty       int
+	name      string
+	inventory int
+	trip      string
+}
+
+// AddOnSale is a line of an order that bought an add-on
+type AddOnSale struct {
+	OrderID   string      `json:"orderId"`
+	Provider  string      `json:"provider"`
+	Sku       string      `json:"sku"`
+	ProductID uint        `json:"productId"`
+	Name      string      `json:"name"`
+	Quantity  int         `json:"quantity"`
+	Amount    types.Money `json:"amount"`
+}
+
+// AddOnTotals is how many of an add-on were sold by a provider in a period
+type AddOnTotals struct {
+	Name     string      `json:"name"`
+	Provider string      `json:"provider"`
+	Quantity int         `json:"quantity"`
+	Amount   types.Money `json:"amount"`
+}
+
+// addOnSalesSQL selects the add-on lines of paid Stripe and PayPal orders
+const addOnSalesSQL = `SELECT li.payment_id AS order_id, 'stripe' AS provider, li.sku, li.name,
+		li.quantity, li.amount, pi.created_at AS sold_at
+	FROM line_items AS li JOIN payment_intents AS pi ON pi.id = li.payment_id AND pi.acct = li.acct
+	WHERE li.acct = ? AND pi.status = 'succeeded' AND li.sku LIKE 'ADDON-%'
+	UNION ALL
+	SELECT it.checkout_id AS order_id, 'paypal' AS provider, it.sku, it.name,
+		it.quantity, it.value * it.quantity AS amount, co.create_time AS sold_at
+	FROM purchase_items AS it
+		JOIN checkout_orders AS co ON co.id = it.checkout_id
+		JOIN purchase_units AS pu ON pu.checkout_id = co.id
+	WHERE pu.payee_merchant_id = ? AND co.status != 'REFUNDED' AND it.sku LIKE 'ADDON-%'`
+
+func addOnSales(db *gorm.DB, conf *types.MerchantConfig, filter string, args ...interface{}) []AddOnSale {
+	var out []AddOnSale
+	// the sku only has the add-on's id, its product says which trip it is for
+	db.Raw(`SELECT order_id, provider, sku, a.product_id, s.name, quantity, amount FROM (`+addOnSalesSQL+`) AS s
+		LEFT JOIN add_ons AS a ON a.id = CAST(SUBSTRING(sku FROM '^ADDON-(\d+)-\d+$') AS integer)
+		WHERE `+filter+" ORDER BY order_id, sku", append([]interface{}{conf.StripeKey, conf.ID}, args...)...).Scan(&out)
+	return out
+}
+
+// OrderAddOns returns the add-ons bought by an order
+func OrderAddOns(db *gorm.DB, conf *types.MerchantConfig, orderID string) []AddOnSale {
+	return addOnSales(db, conf, "order_id = ?", orderID)
+}
+
+// TripAddOns returns the add-ons bought for the departures leaving at t
+func TripAddOns(db *gorm.DB, conf *types.MerchantConfig, t time.Time) []AddOnSale {
+	return addOnSales(db, conf, "sku LIKE ?", fmt.Sprintf("%%-%d", t.Unix()))
+}
+
+// AddOnSalesBetween totals the add-ons sold between from and to by name and
+// provider
+func AddOnSalesBetween(db *gorm.DB, conf *types.MerchantConfig, from, to time.Time) []AddOnTotals {
+	var out []AddOnTotals
+	db.Raw(`SELECT name, provider, SUM(quantity) AS quantity, SUM(amount) AS amount
+		FROM (`+addOnSalesSQL+`) AS s WHERE sold_at >= ? AND sold_at < ?
+		GROUP BY name, provider ORDER BY name, provider`,
+		conf.StripeKey, conf.ID, from, to).Scan(&out)
+	return out
+}
+
+// addOnsSold counts how many of an add-on have been sold for a departure
+func addOnsSold(db *gorm.DB, conf *types.MerchantConfig, sku string) int {
+	stripeSold, paypalSold := soldSeats(db, conf, "^"+sku+"$")
+	return stripeSold + paypalSold
+}
+
+// validateAddOn checks an add-on in a cart is sold for a departure that is
+// running and fills in what is charged for it
+func validateAddOn(db *gorm.DB, conf *types.MerchantConfig, verr *ValidationError, idx int, item *CartItem, addOns map[string]*addOnLine) bool {
+	id, t, ok := types.ParseAddOnSku(item.Sku)
+	if !ok {
+		verr.add(idx, item.Sku, ErrInvalidSku, "not a valid add-on")
+		return false
+	}
+	if item.Quantity <= 0 {
+		verr.add(idx, item.Sku, ErrInvalidQuantity, "quantity must be positive")
+		return false
+	}
+
+	var a types.AddOn
+	if db.Where("id = ? AND merchant_id = ? AND publish", id, conf.ID).First(&a).RecordNotFound() {
+		verr.add(idx, item.Sku, ErrUnknownProduct, "add-on %d doesn't exist", id)
+		return false
+	}
+	if t.Before(time.Now()) {
+		verr.add(idx, item.Sku, ErrDeparted, "%s is for a trip that has already departed", a.Name)
+		return false
+	}
+
+	info := types.SkuInfo{ProductID: a.ProductID, Time: t}
+	sched, st := findScheduleTime(db, info)
+	if st == nil || !scheduledOn(sched, t) {
+		verr.add(idx, item.Sku, ErrNotScheduled, "%s isn't available at %s", a.Name, t.Format("Jan 2, 2006 3:04 PM"))
+		return false
+	}
+
+	if l, ok := addOns[item.Sku]; ok {
+		l.qty += item.Quantity
+	} else {
+		addOns[item.Sku] = &addOnLine{first: idx, qty: item.Quantity, name: a.Name, inventory: a.Inventory,
+			trip: fmt.Sprintf("%d@%d", a.ProductID, t.Unix())}
+	}
+
+	item.Name = a.Name
+	item.Desc = t.Format("Mon Jan 2, 2006 3:04 PM")
+	item.UnitAmount = types.Amount{Value: a.Price, CurrencyCode: a.Price.CurrencyCode()}
+	return true
+}
+
+// AvailableAddOn is an add-on that can be bought for a departure, Left is
+// -1 when it isn't limited
+type AvailableAddOn struct {
+	types.AddOn
+	Sku  string `json:"sku"`
+	Left int    `json:"left"`
+}
+
+// DepartureAddOns lists the published add-ons of a product with the sku to
+// buy them for the departure at t and how many are left
+func DepartureAddOns(db *gorm.DB, conf *types.MerchantConfig, productID uint, t time.Time) []AvailableAddOn {
+	var list []types.AddOn
+	db.Where("merchant_id = ? AND product_id = ? AND publish", conf.ID, productID).Order("name").Find(&list)
+
+	out := make([]AvailableAddOn, 0, len(list))
+	for _, a := range list {
+		avail := AvailableAddOn{AddOn: a, Sku: types.AddOnSku(a.ID, t), Left: -1}
+		if a.Inventory > 0 {
+			avail.Left = a.Inventory - addOnsSold(db, conf, avail.Sku)
+			if avail.Left < 0 {
+				avail.Left = 0
+			}
+		}
+		out = append(out, avail)
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package pricing
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// ReminderWindow is how long before the due date balance reminders start
+const ReminderWindow = 3 * 24 * time.Hour
+
+// reminderGap is the least time between two reminders for one balance
+const reminderGap = 48 * time.Hour
+
+// MaxReminders is how many reminders are sent before giving up
+const MaxReminders = 4
+
+// OpenBalance records the balance left on an order booked with a deposit.
+// It only creates one per order, so webhooks being retried are harmless.
+func OpenBalance(db *gorm.DB, b *types.BalanceDue) (*types.BalanceDue, error) {
+	var existing types.BalanceDue
+	if !db.Where("provider = ? AND order_id = ?", b.Provider, b.OrderID).First(&existing).RecordNotFound() {
+		return &existing, nil
+	}
+
+	token, err := types.NewBalanceToken()
+	if err != nil {
+		return nil, err
+	}
+	b.Token = token
+	b.Status = types.BalanceOpen
+	if err := db.Create(b).Error; err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// LoadBalance looks up a balance by the token in its payment link and
+// checks it can still be paid.
+func LoadBalance(db *gorm.DB, merchantID, token string) (*types.BalanceDue, error) {
+	var b types.BalanceDue
+	if token == "" || db.Where("merchant_id = ? AND token = ?", merchantID, token).First(&b).RecordNotFound() {
+		return nil, types.ErrBalanceNotFound
+	}
+	if !b.Payable() {
+		return &b, types.ErrBalanceClosed
+	}
+	return &b, nil
+}
+
+// PayBalance marks a balance as paid by a payment, it does nothing if it
+// was already paid by the same payment.
+func PayBalance(db *gorm.DB, b *types.BalanceDue, paymentID string) error {
+	now := time.Now()
+	res := db.Model(&types.BalanceDue{}).
+		Where("id = ? AND status IN (?)", b.ID, []string{types.BalanceOpen, types.BalanceOverdue}).
+		Updates(map[string]interface{}{"status": types.BalancePaid, "paid_at": &now, "payment_id": paymentID})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 && b.PaymentID != paymentID {
+		return types.ErrBalanceClosed
+	}
+
+	b.Status, b.PaidAt, b.PaymentID = types.BalancePaid, &now, paymentID
+	return nil
+}
+
+// MarkOverdue moves every open balance past its due date to overdue
+func MarkOverdue(db *gorm.DB, now time.Time) int64 {
+	return db.Model(&types.BalanceDue{}).
+		Where("status = ? AND due_date < ?", types.BalanceOpen, now).
+		Update("status", types.BalanceOverdue).RowsAffected
+}
+
+// BalancesToRemind returns the unpaid balances that are due soon or overdue
+// and haven't been reminded about recently.
+func BalancesToRemind(db *gorm.DB, now time.Time) []types.BalanceDue {
+	var out []types.BalanceDue
+	db.Where("status IN (?) AND due_date <= ? AND reminders < ? AND (reminded_at IS NULL OR reminded_at < ?)",
+		[]string{types.BalanceOpen, types.BalanceOverdue}, now.Add(ReminderWindow), MaxReminders, now.Add(-reminderGap)).
+		Order("due_date").Find(&out)
+	return out
+}
+
+// Reminded records that a reminder was sent for a balance
+func Reminded(db *gorm.DB, b *types.BalanceDue, now time.Time) {
+	db.Model(b).Updates(map[string]interface{}{"reminded_at": &now, "reminders": b.Reminders + 1})
+}
+
+// BalanceFor is the balance left by a quote paid with a deposit, or nil if
+// it was paid in full
+func BalanceFor(merchantID string, quote *Quote) *types.BalanceDue {
+	if quote.Balance.Cents <= 0 || quote.BalanceDue == nil {
+		return nil
+	}
+	return &types.BalanceDue{
+		MerchantID: merchantID,
+		Amount:     quote.Balance,
+		Commission: quote.BalanceCommission,
+		DueDate:    *quote.BalanceDue,
+	}
+}
@@ -0,0 +1,149 @@
+package pricing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// boatSeatsLeft returns how many seats are left on a boat for a departure
+// across every product using it, false if the boat's capacity isn't set.
+func boatSeatsLeft(db *gorm.DB, conf *types.MerchantConfig, boatID uint, t time.Time) (int, bool) {
+	var boat struct{ Capacity int }
+	db.Table("boats").Select("capacity").Where("id = ? AND merchant_id = ?", boatID, conf.ID).Scan(&boat)
+	if boat.Capacity <= 0 {
+		return 0, false
+	}
+
+	var prods []struct{ ID uint }
+	db.Table("products").Select("id").
+		Where("merchant_id = ? AND boat_id = ? AND deleted_at IS NULL", conf.ID, boatID).Scan(&prods)
+	if len(prods) == 0 {
+		return boat.Capacity, true
+	}
+
+	ids := make([]string, 0, len(prods))
+	for _, p := range prods {
+		ids = append(ids, fmt.Sprint(p.ID))
+	}
+	stripeSold, paypalSold := soldSeats(db, conf, fmt.Sprintf("^(%s)[A-Z]+%d", strings.Join(ids, "|"), t.Unix()))
+	return boat.Capacity - stripeSold - paypalSold, true
+}
+
+// Conflict is a trip of another product that uses the same boat at the
+// same time as a product's schedule, between the From and To dates
+type Conflict struct {
+	ProductID  uint   `json:"productId"`
+	Product    string `json:"product"`
+	ScheduleID uint   `json:"scheduleId"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Time       string `json:"time"`
+	OtherTime  string `json:"otherTime"`
+}
+
+// clockRange is the start and end of a schedule time in minutes after
+// midnight, trips ending after midnight run past 24 hours
+func clockRange(st *types.ScheduleTime) (int, int, bool) {
+	h, m, ok := parseClock(st.StartTime)
+	if !ok {
+		return 0, 0, false
+	}
+	start := h*60 + m
+
+	end := start
+	if h, m, ok := parseClock(st.EndTime); ok {
+		end = h*60 + m
+		if end < start {
+			end += 24 * 60
+		}
+	}
+	return start, end, true
+}
+
+// sharedDays reports whether two schedules can run on the same weekday,
+// schedules without any days run every day
+func sharedDays(a, b *types.Schedule) bool {
+	if len(a.Days) == 0 || len(b.Days) == 0 {
+		return true
+	}
+	for _, x := range a.Days {
+		for _, y := range b.Days {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ScheduleConflicts finds where the schedules of an open boat product would
+// put a boat out on two different products' trips at once.
+func ScheduleConflicts(db *gorm.DB, merchantID string, productID, boatID uint, scheds []types.Schedule) []Conflict {
+	var others []catalogProduct
+	db.Table("products").Select(productColumns).
+		Where("merchant_id = ? AND boat_id = ? AND id != ? AND deleted_at IS NULL", merchantID, boatID, productID).
+		Scan(&others)
+
+	out := make([]Conflict, 0)
+	for _, o := range others {
+		// charters take the boat from open trips when they're booked
+		if o.Kind == types.ProductCharter {
+			continue
+		}
+
+		var theirs []types.Schedule
+		db.Preload("TimeArray").Where("product_id = ?", o.ID).Find(&theirs)
+
+		for sidx := range scheds {
+			mine := &scheds[sidx]
+			for oidx := range theirs {
+				other := &theirs[oidx]
+				if mine.Start.After(other.End) || other.Start.After(mine.End) || !sharedDays(mine, other) {
+					continue
+				}
+
+				for tidx := range mine.TimeArray {
+					ms, me, ok := clockRange(&mine.TimeArray[tidx])
+					if !ok {
+						continue
+					}
+					for ttidx := range other.TimeArray {
+						ts, te, ok := clockRange(&other.TimeArray[ttidx])
+						if !ok || (ms != ts && (ms >= te || ts >= me)) {
+							continue
+						}
+
+						out = append(out, Conflict{
+							ProductID:  o.ID,
+							Product:    o.Name,
+							ScheduleID: other.ID,
+							From:       maxTime(mine.Start, other.Start).Format("2006-01-02"),
+							To:         minTime(mine.End, other.End).Format("2006-01-02"),
+							Time:       mine.TimeArray[tidx].StartTime,
+							OtherTime:  other.TimeArray[ttidx].StartTime,
+						})
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,119 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in   string
+		h, m int
+		ok   bool
+	}{
+		{"08:00", 8, 0, true},
+		{"17:30:00", 17, 30, true},
+		{"5:30 PM", 17, 30, true},
+		{" 6:15am ", 6, 15, true},
+		{"12:00 AM", 0, 0, true},
+		{"", 0, 0, false},
+		{"noon", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		h, m, ok := parseClock(tt.in)
+		if h != tt.h || m != tt.m || ok != tt.ok {
+			t.Errorf("parseClock(%q) = %d, %d, %v, want %d, %d, %v", tt.in, h, m, ok, tt.h, tt.m, tt.ok)
+		}
+	}
+}
+
+func TestClockRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end string
+		from, to   int
+		ok         bool
+	}{
+		{"morning trip", "07:00", "11:30", 7 * 60, 11*60 + 30, true},
+		{"no end time", "07:00", "", 7 * 60, 7 * 60, true},
+		{"overnight", "22:00", "02:00", 22 * 60, 26 * 60, true},
+		{"12 hour clock", "1:00 PM", "5:00 PM", 13 * 60, 17 * 60, true},
+		{"bad start", "soon", "11:00", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, ok := clockRange(&types.ScheduleTime{StartTime: tt.start, EndTime: tt.end})
+			if from != tt.from || to != tt.to || ok != tt.ok {
+				t.Errorf("clockRange() = %d, %d, %v, want %d, %d, %v", from, to, ok, tt.from, tt.to, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSharedDays(t *testing.T) {
+	weekends := &types.Schedule{Days: pq.Int64Array{0, 6}}
+	weekdays := &types.Schedule{Days: pq.Int64Array{1, 2, 3, 4, 5}}
+	fridays := &types.Schedule{Days: pq.Int64Array{5}}
+	everyDay := &types.Schedule{}
+
+	tests := []struct {
+		name string
+		a, b *types.Schedule
+		want bool
+	}{
+		{"weekends and weekdays", weekends, weekdays, false},
+		{"weekdays and fridays", weekdays, fridays, true},
+		{"every day and weekends", everyDay, weekends, true},
+		{"weekends and every day", weekends, everyDay, true},
+		{"both every day", everyDay, everyDay, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sharedDays(tt.a, tt.b); got != tt.want {
+				t.Errorf("sharedDays() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2030, time.July, 4, h, m, 0, 0, loc) }
+
+	tests := []struct {
+		name                     string
+		start, end, ostart, oend time.Time
+		want                     bool
+	}{
+		{"inside", at(9, 0), at(10, 0), at(8, 0), at(12, 0), true},
+		{"across the start", at(7, 0), at(9, 0), at(8, 0), at(12, 0), true},
+		{"back to back", at(12, 0), at(14, 0), at(8, 0), at(12, 0), false},
+		{"before", at(5, 0), at(7, 0), at(8, 0), at(12, 0), false},
+		{"same start without an end", at(8, 0), at(8, 0), at(8, 0), at(8, 0), true},
+		{"no end inside", at(9, 0), at(9, 0), at(8, 0), at(12, 0), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overlaps(tt.start, tt.end, tt.ostart, tt.oend); got != tt.want {
+				t.Errorf("overlaps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTripEnd(t *testing.T) {
+	start := time.Date(2030, time.July, 4, 22, 0, 0, 0, loc)
+
+	if got := tripEnd(start, &types.ScheduleTime{EndTime: "02:00"}); !got.Equal(start.Add(4 * time.Hour)) {
+		t.Errorf("overnight tripEnd() = %s, want %s", got, start.Add(4*time.Hour))
+	}
+	if got := tripEnd(start, &types.ScheduleTime{}); !got.Equal(start) {
+		t.Errorf("tripEnd() without an end time = %s, want %s", got, start)
+	}
+}
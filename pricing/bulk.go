@@ -0,0 +1,210 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// BulkDays is the longest date range a bulk change can cover
+const BulkDays = 366
+
+var (
+	ErrBulkNothing  = errors.New("a bulk change needs a capacity, cancellation or price")
+	ErrBulkRange    = errors.New("from and to must be dates no more than a year apart")
+	ErrBulkCapacity = errors.New("capacity can't be negative")
+	ErrBulkTime     = errors.New("times must be start times such as 08:00")
+	ErrBulkPrice    = errors.New("price must be one of the merchant's ticket categories")
+)
+
+// BulkFilter picks the open trips a bulk change applies to. From and To
+// are dates (YYYY-MM-DD), the rest narrow them down when they're set: Days
+// are weekdays (0 is Sunday) and Times are start times.
+type BulkFilter struct {
+	ProductIDs []uint   `json:"productIds"`
+	BoatID     uint     `json:"boatId"`
+	From       string   `json:"from" binding:"required"`
+	To         string   `json:"to" binding:"required"`
+	Days       []int    `json:"days"`
+	Times      []string `json:"times"`
+}
+
+// BulkChange is a change to every departure matching its filter, fields
+// left out keep what each departure has now. Price is the id of the ticket
+// category to charge, "" goes back to the schedule's.
+type BulkChange struct {
+	Filter    BulkFilter `json:"filter" binding:"required"`
+	Capacity  *int       `json:"capacity"`
+	Cancelled *bool      `json:"cancelled"`
+	Price     *string    `json:"price"`
+}
+
+// BulkTrip is a departure a bulk change applies to, as it is now and as
+// it will be. Impacted is how many of the tickets sold for it the change
+// affects, all of them if it cancels the trip or those over the new
+// capacity.
+type BulkTrip struct {
+	ProductID    uint      `json:"productId"`
+	Product      string    `json:"product"`
+	Time         time.Time `json:"time"`
+	Sold         int       `json:"sold"`
+	Capacity     int       `json:"capacity"`
+	Cancelled    bool      `json:"cancelled"`
+	Price        string    `json:"price"`
+	NewCapacity  int       `json:"newCapacity"`
+	NewCancelled bool      `json:"newCancelled"`
+	NewPrice     string    `json:"newPrice"`
+	Impacted     int       `json:"impacted"`
+
+	// Avail and PriceID are what the trip's manual override should have,
+	// PayPal orders take their seats off its avail so it is the capacity
+	// less those
+	Avail   int    `json:"-"`
+	PriceID string `json:"-"`
+}
+
+// Reopened reports whether the change frees up seats on the trip
+func (b *BulkTrip) Reopened() bool {
+	return !b.NewCancelled && (b.Cancelled || b.NewCapacity > b.Capacity)
+}
+
+type tripOverride struct {
+	Cancelled bool
+	Avail     int
+	Price     string
+}
+
+// overridePrices returns the ticket categories of the departures between
+// from and to which had theirs changed with a manual override
+func overridePrices(db *gorm.DB, from, to time.Time) map[string]string {
+	var rows []struct {
+		ProductID uint
+		Time      time.Time
+		Price     string
+	}
+	db.Table("manual_overrides").Select("product_id, time, price").
+		Where("price <> '' AND time >= ? AND time < ?", from, to).Scan(&rows)
+
+	out := make(map[string]string, len(rows))
+	for _, r := range rows {
+		out[tripKey(r.ProductID, r.Time)] = r.Price
+	}
+	return out
+}
+
+func (f *BulkFilter) match(d *Departure, times map[int]bool) bool {
+	if d.Charter || (f.BoatID != 0 && d.BoatID != f.BoatID) {
+		return false
+	}
+	if len(f.ProductIDs) > 0 {
+		found := false
+		for _, id := range f.ProductIDs {
+			found = found || id == d.ProductID
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Days) > 0 {
+		found := false
+		for _, wd := range f.Days {
+			found = found || time.Weekday(wd) == d.Time.Weekday()
+		}
+		if !found {
+			return false
+		}
+	}
+	return len(times) == 0 || times[d.Time.Hour()*60+d.Time.Minute()]
+}
+
+// PlanBulk works out which departures a bulk change applies to and what it
+// does to each of them, without changing anything
+func PlanBulk(db *gorm.DB, conf *types.MerchantConfig, change *BulkChange) ([]BulkTrip, error) {
+	if change.Capacity == nil && change.Cancelled == nil && change.Price == nil {
+		return nil, ErrBulkNothing
+	}
+	if change.Capacity != nil && *change.Capacity < 0 {
+		return nil, ErrBulkCapacity
+	}
+	if change.Price != nil && *change.Price != "" {
+		var count int
+		db.Table("ticket_categories").
+			Where("id = ? AND merchant_id = ? AND deleted_at IS NULL", *change.Price, conf.ID).Count(&count)
+		if count == 0 {
+			return nil, ErrBulkPrice
+		}
+	}
+
+	f := &change.Filter
+	from, err := time.ParseInLocation("2006-01-02", f.From, loc)
+	if err != nil {
+		return nil, ErrBulkRange
+	}
+	to, err := time.ParseInLocation("2006-01-02", f.To, loc)
+	if err != nil || to.Before(from) || to.After(from.AddDate(0, 0, BulkDays)) {
+		return nil, ErrBulkRange
+	}
+
+	times := make(map[int]bool, len(f.Times))
+	for _, s := range f.Times {
+		h, m, ok := parseClock(s)
+		if !ok {
+			return nil, ErrBulkTime
+		}
+		times[h*60+m] = true
+	}
+
+	out := make([]BulkTrip, 0)
+	for _, d := range Departures(db, conf.ID, 0, from, to) {
+		if !f.match(&d, times) {
+			continue
+		}
+
+		stripeSold, paypalSold := soldSeats(db, conf, fmt.Sprintf("^%d[A-Z]+%d", d.ProductID, d.Time.Unix()))
+		b := BulkTrip{
+			ProductID: d.ProductID,
+			Product:   d.Product,
+			Time:      d.Time,
+			Sold:      stripeSold + paypalSold,
+			Capacity:  int(d.Schedule.TicketsAvail),
+			Price:     d.Category,
+		}
+
+		var over tripOverride
+		if !db.Table("manual_overrides").Select("cancelled, avail, price").
+			Where("product_id = ? AND time = ?", d.ProductID, d.Time).Scan(&over).RecordNotFound() {
+			b.Capacity, b.Cancelled = over.Avail+paypalSold, over.Cancelled
+		}
+
+		b.NewCapacity, b.NewCancelled, b.NewPrice, b.PriceID = b.Capacity, b.Cancelled, b.Price, over.Price
+		if change.Capacity != nil {
+			b.NewCapacity = *change.Capacity
+		}
+		if change.Cancelled != nil {
+			b.NewCancelled = *change.Cancelled
+		}
+		if change.Price != nil {
+			b.NewPrice, b.PriceID = *change.Price, *change.Price
+			if b.NewPrice == "" {
+				for _, st := range d.Schedule.TimeArray {
+					if h, m, ok := parseClock(st.StartTime); ok && h == d.Time.Hour() && m == d.Time.Minute() {
+						b.NewPrice = st.Price
+					}
+				}
+			}
+		}
+		b.Avail = b.NewCapacity - paypalSold
+
+		switch {
+		case b.NewCancelled && !b.Cancelled:
+			b.Impacted = b.Sold
+		case !b.NewCancelled && b.Sold > b.NewCapacity:
+			b.Impacted = b.Sold - b.NewCapacity
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
@@ -0,0 +1,147 @@
+package pricing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// CalendarDays is how far ahead calendar feeds list trips
+const CalendarDays = 90
+
+func tripKey(productID uint, t time.Time) string {
+	return fmt.Sprintf("%d-%d", productID, t.Unix())
+}
+
+// cancelledTrips returns the departures between from and to which were
+// cancelled with a manual override
+func cancelledTrips(db *gorm.DB, from, to time.Time) map[string]bool {
+	var rows []struct {
+		ProductID uint
+		Time      time.Time
+	}
+	db.Table("manual_overrides").Select("product_id, time").
+		Where("cancelled AND time >= ? AND time <= ?", from, to).Scan(&rows)
+
+	out := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		out[tripKey(r.ProductID, r.Time)] = true
+	}
+	return out
+}
+
+func boatNames(db *gorm.DB, merchantID string) map[uint]string {
+	var rows []struct {
+		ID   uint
+		Name string
+	}
+	db.Table("boats").Select("id, name").Where("merchant_id = ?", merchantID).Scan(&rows)
+
+	out := make(map[uint]string, len(rows))
+	for _, r := range rows {
+		out[r.ID] = r.Name
+	}
+	return out
+}
+
+// TripCalendar is a feed of the departures of the merchant's published
+// products between from and to, or only those on one boat if boatID isn't
+// 0. Trips cancelled with a manual override are marked as cancelled.
+func TripCalendar(db *gorm.DB, merchantID, name string, from, to time.Time, boatID uint) *types.Calendar {
+	cancelled := cancelledTrips(db, from, to)
+	boats := boatNames(db, merchantID)
+
+	cal := &types.Calendar{Name: name}
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	for _, d := range Departures(db, merchantID, 0, day, to) {
+		if (boatID != 0 && d.BoatID != boatID) || d.Time.Before(from) {
+			continue
+		}
+		key := tripKey(d.ProductID, d.Time)
+		e := types.CalendarEvent{
+			UID:       key + "@" + merchantID,
+			Start:     d.Time,
+			End:       d.End,
+			Summary:   d.Product,
+			Cancelled: cancelled[key],
+		}
+		if b := boats[d.BoatID]; b != "" {
+			e.Description = "Boat: " + b
+		}
+		cal.Events = append(cal.Events, e)
+	}
+	return cal
+}
+
+// CrewCalendar is a feed of the trips a crew member is assigned to which
+// haven't finished
+func CrewCalendar(db *gorm.DB, merchantID, userID, name string, now time.Time) *types.Calendar {
+	trips := UpcomingTrips(db, merchantID, userID, now)
+	cancelled := cancelledTrips(db, now.AddDate(0, 0, -1), now.AddDate(1, 0, 0))
+	boats := boatNames(db, merchantID)
+	products := make(map[uint]string)
+
+	cal := &types.Calendar{Name: name}
+	for _, a := range trips {
+		if _, ok := products[a.ProductID]; !ok {
+			var prod catalogProduct
+			db.Table("products").Select(productColumns).Where("id = ?", a.ProductID).Scan(&prod)
+			products[a.ProductID] = prod.Name
+		}
+
+		key := tripKey(a.ProductID, a.Start)
+		e := types.CalendarEvent{
+			UID:       key + "@" + merchantID,
+			Start:     a.Start,
+			End:       a.End,
+			Summary:   fmt.Sprintf("%s (%s)", products[a.ProductID], a.Role),
+			Cancelled: cancelled[key],
+		}
+		if b := boats[a.BoatID]; b != "" {
+			e.Description = "Boat: " + b + "\n"
+		}
+		e.Description = strings.TrimSpace(e.Description + a.Notes)
+		cal.Events = append(cal.Events, e)
+	}
+	return cal
+}
+
+// OrderCalendar is the trips booked by an order, so passengers can add them
+// to their calendar. It is nil if the order has no trips.
+func OrderCalendar(db *gorm.DB, conf *types.MerchantConfig, orderID string, skus []string) *types.Calendar {
+	cal := &types.Calendar{Name: conf.EmailName}
+	seen := make(map[string]bool)
+	for _, sku := range skus {
+		info, ok := types.ParseSku(sku)
+		if !ok {
+			continue
+		}
+		key := tripKey(info.ProductID, info.Time)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		var prod catalogProduct
+		db.Table("products").Select(productColumns).Where("id = ?", info.ProductID).Scan(&prod)
+		e := types.CalendarEvent{
+			UID:         orderID + "-" + key + "@" + conf.ID,
+			Start:       info.Time,
+			End:         info.Time,
+			Summary:     prod.Name,
+			Description: "Order " + orderID,
+		}
+		if _, st := findScheduleTime(db, info); st != nil {
+			e.End = tripEnd(info.Time, st)
+		}
+		cal.Events = append(cal.Events, e)
+	}
+
+	if len(cal.Events) == 0 {
+		return nil
+	}
+	return cal
+}
@@ -0,0 +1,72 @@
+package pricing
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+var clockFormats = []string{"15:04", "15:04:05", "3:04 PM", "3:04PM", "3:04 pm", "3:04pm"}
+
+// parseClock parses the start time of a ScheduleTime into hours and minutes
+func parseClock(s string) (int, int, bool) {
+	s = strings.TrimSpace(s)
+	for _, f := range clockFormats {
+		if t, err := time.Parse(f, s); err == nil {
+			return t.Hour(), t.Minute(), true
+		}
+	}
+	return 0, 0, false
+}
+
+// loadSchedules returns the schedules of a product running between the
+// from and to days with its blackout dates added to their NotAvail, along
+// with its extra departures on those days as schedules of their own
+func loadSchedules(db *gorm.DB, productID uint, from, to time.Time) []types.Schedule {
+	var scheds []types.Schedule
+	db.Preload("TimeArray").
+		Where(`product_id = ? AND start <= ? AND "end" >= ?`, productID, to, from).
+		Find(&scheds)
+
+	return addExceptions(db, productID, scheds, from, to)
+}
+
+// findScheduleTime returns the schedule and trip time a departure belongs to,
+// or nil if the product isn't scheduled at that time. The trip time's Price
+// is the one set by a manual override if the departure has one.
+func findScheduleTime(db *gorm.DB, info types.SkuInfo) (*types.Schedule, *types.ScheduleTime) {
+	day := time.Date(info.Time.Year(), info.Time.Month(), info.Time.Day(), 0, 0, 0, 0, info.Time.Location())
+
+	scheds := loadSchedules(db, info.ProductID, day, day)
+	for sidx := range scheds {
+		for tidx, t := range scheds[sidx].TimeArray {
+			h, m, ok := parseClock(t.StartTime)
+			if ok && h == info.Time.Hour() && m == info.Time.Minute() {
+				st := &scheds[sidx].TimeArray[tidx]
+				var over struct{ Price string }
+				db.Table("manual_overrides").Select("price").
+					Where("product_id = ? AND time = ?", info.ProductID, info.Time).Scan(&over)
+				if over.Price != "" {
+					st.Price = over.Price
+				}
+				return &scheds[sidx], st
+			}
+		}
+	}
+	return nil, nil
+}
+
+// ticketCategoryID returns the id of the TicketCategory used to price a
+// departure, which is what ScheduleTime.Price refers to.
+func ticketCategoryID(db *gorm.DB, info types.SkuInfo) uint {
+	_, st := findScheduleTime(db, info)
+	if st == nil {
+		return 0
+	}
+
+	id, _ := strconv.ParseUint(st.Price, 10, 32)
+	return uint(id)
+}
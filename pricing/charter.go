@@ -0,0 +1,236 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// CharterRequest is what a group leader fills in to hold a charter
+type CharterRequest struct {
+	ProductID   uint      `json:"productId" binding:"required"`
+	Time        time.Time `json:"time" binding:"required"`
+	LeaderName  string    `json:"leaderName" binding:"required"`
+	LeaderEmail string    `json:"leaderEmail" binding:"required"`
+	LeaderPhone string    `json:"leaderPhone"`
+	Headcount   int       `json:"headcount" binding:"required"`
+	Notes       string    `json:"notes"`
+	// IP is the address the request came from, which is limited in how many
+	// charters it can hold
+	IP string `json:"-"`
+}
+
+// Errors for charters that aren't on the schedule
+var (
+	ErrTripDeparted     = errors.New("that trip has already departed")
+	ErrTripNotScheduled = errors.New("there is no trip scheduled at that time")
+)
+
+var loc *time.Location
+
+func init() {
+	loc, _ = time.LoadLocation("America/New_York")
+}
+
+const productColumns = "id, name, publish, boat_id, kind, charter_price, charter_deposit, max_guests"
+
+// tripEnd is when a trip starting at start gets back, using the end time of
+// its schedule time. Trips without one are treated as taking no time.
+func tripEnd(start time.Time, st *types.ScheduleTime) time.Time {
+	h, m, ok := parseClock(st.EndTime)
+	if !ok {
+		return start
+	}
+
+	end := time.Date(start.Year(), start.Month(), start.Day(), h, m, 0, 0, start.Location())
+	if end.Before(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+// overlaps reports whether two blocks of time overlap, a block which takes
+// no time overlaps any block it falls inside of
+func overlaps(start, end, ostart, oend time.Time) bool {
+	if start.Equal(ostart) {
+		return true
+	}
+	return start.Before(oend) && ostart.Before(end)
+}
+
+// boatCharters returns the charters taking up a boat at any point between
+// start and end
+func boatCharters(db *gorm.DB, merchantID string, boatID uint, start, end time.Time) []types.Charter {
+	var found []types.Charter
+	db.Where(`merchant_id = ? AND boat_id = ? AND status IN (?) AND start <= ? AND "end" >= ?`,
+		merchantID, boatID, []string{types.CharterHeld, types.CharterBooked}, end, start).
+		Find(&found)
+
+	now := time.Now()
+	out := found[:0]
+	for _, c := range found {
+		if c.Active(now) && overlaps(start, end, c.Start, c.End) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// openTripsSold reports whether any seats have been sold on open boat trips
+// using a boat between start and end.
+func openTripsSold(db *gorm.DB, conf *types.MerchantConfig, boatID uint, start, end time.Time) bool {
+	from := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	for _, d := range Departures(db, conf.ID, 0, from, end) {
+		if d.BoatID != boatID || d.Charter || !overlaps(start, end, d.Time, d.End) {
+			continue
+		}
+
+		stripeSold, paypalSold := soldSeats(db, conf, fmt.Sprintf("^%d[A-Z]+%d", d.ProductID, d.Time.Unix()))
+		if stripeSold+paypalSold > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// heldCharters counts the unpaid charters held by an email or IP address
+func heldCharters(db *gorm.DB, merchantID, email, ip string) int {
+	var n int
+	db.Model(&types.Charter{}).
+		Where("merchant_id = ? AND status = ? AND hold_until > ? AND (LOWER(leader_email) = LOWER(?) OR hold_ip = ?)",
+			merchantID, types.CharterHeld, time.Now(), email, ip).
+		Count(&n)
+	return n
+}
+
+// HoldCharter checks a charter can be booked and holds the boat for the
+// group while they pay for it. Holds are short and each email and IP
+// address can only have a few at once, so nobody can take every boat off
+// sale without paying.
+func HoldCharter(db *gorm.DB, conf *types.MerchantConfig, req *CharterRequest) (*types.Charter, error) {
+	var prod catalogProduct
+	db.Table("products").Select(productColumns).
+		Where("id = ? AND merchant_id = ? AND deleted_at IS NULL", req.ProductID, conf.ID).Scan(&prod)
+	if prod.ID == 0 || prod.Kind != types.ProductCharter || !prod.Publish {
+		return nil, types.ErrCharterNotFound
+	}
+	if req.Headcount <= 0 || (prod.MaxGuests > 0 && req.Headcount > prod.MaxGuests) {
+		return nil, types.ErrCharterHeadcount
+	}
+
+	info := types.SkuInfo{ProductID: prod.ID, Ticket: types.CharterTicket, Time: req.Time.In(loc)}
+	if info.Time.Before(time.Now()) {
+		return nil, ErrTripDeparted
+	}
+	sched, st := findScheduleTime(db, info)
+	if st == nil || !scheduledOn(sched, info.Time) {
+		return nil, ErrTripNotScheduled
+	}
+
+	now := time.Now()
+	hold := now.Add(types.CharterHold)
+	price, _ := AdjustPrice(LoadPriceRules(db, conf.ID), types.Trip{ProductID: prod.ID, Departure: info.Time, BookedAt: now}, prod.CharterPrice)
+	ch := &types.Charter{
+		MerchantID:  conf.ID,
+		ProductID:   prod.ID,
+		BoatID:      prod.BoatID,
+		Start:       info.Time,
+		End:         tripEnd(info.Time, st),
+		Status:      types.CharterHeld,
+		HoldUntil:   &hold,
+		HoldIP:      req.IP,
+		LeaderName:  req.LeaderName,
+		LeaderEmail: req.LeaderEmail,
+		LeaderPhone: req.LeaderPhone,
+		Headcount:   req.Headcount,
+		Notes:       req.Notes,
+		Price:       price,
+		Deposit:     prod.CharterDeposit,
+	}
+
+	// the locks keep two groups from holding the same boat at once and one
+	// address from holding more than its share on different boats
+	tx := db.Begin()
+	tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", conf.ID+"/charter-holds/"+req.IP)
+	tx.Exec("SELECT pg_advisory_xact_lock(?)", prod.BoatID)
+	if heldCharters(tx, conf.ID, req.LeaderEmail, req.IP) >= types.MaxCharterHolds {
+		tx.Rollback()
+		return nil, types.ErrCharterHolds
+	}
+	if len(boatCharters(tx, conf.ID, prod.BoatID, ch.Start, ch.End)) > 0 ||
+		openTripsSold(tx, conf, prod.BoatID, ch.Start, ch.End) {
+		tx.Rollback()
+		return nil, types.ErrCharterConflict
+	}
+	if err := tx.Create(ch).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return ch, tx.Commit().Error
+}
+
+// BookCharters marks the charters paid for by an order as booked
+func BookCharters(db *gorm.DB, merchantID, provider, orderID string, skus []string) {
+	for _, sku := range skus {
+		info, ok := ParseCharterSku(sku)
+		if !ok {
+			continue
+		}
+
+		db.Model(&types.Charter{}).
+			Where("id = ? AND merchant_id = ? AND status != ?", info.Ref, merchantID, types.CharterCancelled).
+			Updates(map[string]interface{}{
+				"status": types.CharterBooked, "hold_until": nil,
+				"provider": provider, "order_id": orderID,
+			})
+	}
+}
+
+// ParseCharterSku parses a sku, returning false if it isn't for a charter
+func ParseCharterSku(sku string) (types.SkuInfo, bool) {
+	info, ok := types.ParseSku(sku)
+	return info, ok && info.Ticket == types.CharterTicket && info.Ref != 0
+}
+
+// validateCharter checks a charter in a cart is still held for the customer
+// and fills in what is charged for it
+func validateCharter(db *gorm.DB, conf *types.MerchantConfig, verr *ValidationError, idx int, item *CartItem, prod *catalogProduct, info types.SkuInfo) bool {
+	if info.Ticket != types.CharterTicket || info.Ref == 0 {
+		verr.add(idx, item.Sku, ErrUnknownTicket, "%s is booked as a charter", prod.Name)
+		return false
+	}
+	if item.Quantity != 1 {
+		verr.add(idx, item.Sku, ErrInvalidQuantity, "a charter can only be booked once")
+		return false
+	}
+
+	var ch types.Charter
+	if db.Where("id = ? AND merchant_id = ? AND product_id = ? AND start = ?",
+		info.Ref, conf.ID, prod.ID, info.Time).First(&ch).RecordNotFound() {
+		verr.add(idx, item.Sku, ErrNotScheduled, "%s", types.ErrCharterNotFound)
+		return false
+	}
+
+	switch {
+	case ch.Status == types.CharterCancelled:
+		verr.add(idx, item.Sku, ErrCancelled, "this charter has been cancelled")
+		return false
+	case ch.Status == types.CharterBooked:
+		verr.add(idx, item.Sku, ErrSoldOut, "this charter has already been paid for")
+		return false
+	case !ch.Active(time.Now()):
+		verr.add(idx, item.Sku, ErrHoldExpired, "%s", types.ErrCharterExpired)
+		return false
+	}
+
+	item.Name = prod.Name + " - Private Charter"
+	item.Desc = info.Time.Format("Mon Jan 2, 2006 3:04 PM")
+	item.UnitAmount = types.Amount{Value: ch.Price, CurrencyCode: ch.Price.CurrencyCode()}
+	if ch.Deposit.Cents > 0 && ch.Deposit.Cents < ch.Price.Cents {
+		item.deposit = ch.Deposit
+	}
+	return true
+}
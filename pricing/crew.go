@@ -0,0 +1,155 @@
+package pricing
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// CrewHours is how long a crew member worked in a period, for payroll
+type CrewHours struct {
+	UserID string  `json:"userId"`
+	Name   string  `json:"name"`
+	Role   string  `json:"role"`
+	Trips  int     `json:"trips"`
+	Hours  float64 `json:"hours"`
+}
+
+// AssignCrew puts a crew member on the departure of a.ProductID at a.Start,
+// filling in its boat and end from the schedule. It fails if they would be
+// on two trips at once or the trip would have two captains.
+func AssignCrew(db *gorm.DB, merchantID string, a *types.CrewAssignment) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+
+	var prod catalogProduct
+	db.Table("products").Select(productColumns).
+		Where("id = ? AND merchant_id = ? AND deleted_at IS NULL", a.ProductID, merchantID).Scan(&prod)
+	if prod.ID == 0 {
+		return ErrTripNotScheduled
+	}
+
+	info := types.SkuInfo{ProductID: prod.ID, Time: a.Start.In(loc)}
+	sched, st := findScheduleTime(db, info)
+	if st == nil || !scheduledOn(sched, info.Time) {
+		return ErrTripNotScheduled
+	}
+
+	a.MerchantID = merchantID
+	a.BoatID = prod.BoatID
+	a.Start = info.Time
+	a.End = tripEnd(info.Time, st)
+
+	// the lock keeps the same person being put on two trips at once
+	tx := db.Begin()
+	tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", a.UserID)
+
+	var others []types.CrewAssignment
+	tx.Where(`merchant_id = ? AND id <> ? AND start <= ? AND "end" >= ?`, merchantID, a.ID, a.End, a.Start).
+		Where("user_id = ? OR (product_id = ? AND start = ? AND role = ?)", a.UserID, a.ProductID, a.Start, types.CrewCaptain).
+		Find(&others)
+	for _, o := range others {
+		if o.UserID == a.UserID && overlaps(a.Start, a.End, o.Start, o.End) {
+			tx.Rollback()
+			return types.ErrCrewConflict
+		}
+		if o.UserID != a.UserID && a.Role == types.CrewCaptain && o.ProductID == a.ProductID && o.Start.Equal(a.Start) {
+			tx.Rollback()
+			return types.ErrCrewCaptain
+		}
+	}
+
+	if err := tx.Save(a).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// TripCrew returns the crew assigned to departures between start and end
+func TripCrew(db *gorm.DB, merchantID string, start, end time.Time) []types.CrewAssignment {
+	var out []types.CrewAssignment
+	db.Where("merchant_id = ? AND start >= ? AND start < ?", merchantID, start, end).
+		Order("start, product_id, role, name").Find(&out)
+	return out
+}
+
+// CrewShortage is a departure with fewer crew assigned to it than its boat
+// needs to sail
+type CrewShortage struct {
+	ProductID uint      `json:"productId"`
+	Product   string    `json:"product"`
+	Time      time.Time `json:"time"`
+	BoatID    uint      `json:"boatId"`
+	Required  int       `json:"required"`
+	Assigned  int       `json:"assigned"`
+}
+
+// ShortCrewed lists the departures between two dates inclusive which have
+// fewer crew assigned than their boat requires
+func ShortCrewed(db *gorm.DB, merchantID string, from, to time.Time) []CrewShortage {
+	out := make([]CrewShortage, 0)
+
+	var boats []struct {
+		ID           uint
+		CrewRequired int
+	}
+	db.Table("boats").Select("id, crew_required").
+		Where("merchant_id = ? AND crew_required > 0", merchantID).Scan(&boats)
+	if len(boats) == 0 {
+		return out
+	}
+	required := make(map[uint]int, len(boats))
+	for _, b := range boats {
+		required[b.ID] = b.CrewRequired
+	}
+
+	assigned := make(map[string]int)
+	for _, a := range TripCrew(db, merchantID, from, to.AddDate(0, 0, 1)) {
+		assigned[tripKey(a.ProductID, a.Start)]++
+	}
+
+	for _, d := range Departures(db, merchantID, 0, from, to) {
+		need := required[d.BoatID]
+		if n := assigned[tripKey(d.ProductID, d.Time)]; n < need {
+			out = append(out, CrewShortage{
+				ProductID: d.ProductID,
+				Product:   d.Product,
+				Time:      d.Time,
+				BoatID:    d.BoatID,
+				Required:  need,
+				Assigned:  n,
+			})
+		}
+	}
+	return out
+}
+
+// UpcomingTrips returns a crew member's assignments which haven't finished
+func UpcomingTrips(db *gorm.DB, merchantID, userID string, now time.Time) []types.CrewAssignment {
+	var out []types.CrewAssignment
+	db.Where(`merchant_id = ? AND user_id = ? AND "end" >= ?`, merchantID, userID, now).
+		Order("start").Find(&out)
+	return out
+}
+
+// CrewHoursBetween totals each crew member's hours, by role, for the trips
+// which departed between from and to
+func CrewHoursBetween(db *gorm.DB, merchantID string, from, to time.Time) []CrewHours {
+	var out []CrewHours
+	idx := make(map[string]int)
+	for _, a := range TripCrew(db, merchantID, from, to) {
+		key := a.UserID + "/" + a.Role
+		i, ok := idx[key]
+		if !ok {
+			i = len(out)
+			idx[key] = i
+			out = append(out, CrewHours{UserID: a.UserID, Name: a.Name, Role: a.Role})
+		}
+		out[i].Trips++
+		out[i].Hours += a.Hours()
+	}
+	return out
+}
@@ -0,0 +1,36 @@
+package pricing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// Customer is someone who bought tickets
+type Customer struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// TripCustomers returns everyone who paid for tickets on a departure, once
+// each however many orders they made
+func TripCustomers(db *gorm.DB, conf *types.MerchantConfig, productID uint, t time.Time) []Customer {
+	pattern := fmt.Sprintf("^%d[A-Z]+%d", productID, t.Unix())
+
+	var out []Customer
+	db.Raw(`SELECT DISTINCT ON (LOWER(email)) name, email FROM (
+			SELECT pi.name, pi.email FROM payment_intents AS pi
+				JOIN line_items AS li ON li.payment_id = pi.id AND li.acct = pi.acct
+			WHERE pi.acct = ? AND pi.status = 'succeeded' AND li.sku ~ ?
+			UNION ALL
+			SELECT p.given_name || ' ' || p.surname AS name, p.email FROM checkout_orders AS co
+				JOIN purchase_units AS pu ON pu.checkout_id = co.id
+				JOIN purchase_items AS it ON it.checkout_id = co.id
+				JOIN payers AS p ON p.id = co.payer_id
+			WHERE pu.payee_merchant_id = ? AND co.status != 'REFUNDED' AND it.sku ~ ?
+		) AS c WHERE email != '' ORDER BY LOWER(email)`,
+		conf.StripeKey, pattern, conf.ID, pattern).Scan(&out)
+	return out
+}
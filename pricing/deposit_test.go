@@ -0,0 +1,124 @@
+package pricing
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func TestQuoteDeposit(t *testing.T) {
+	soon := time.Now().AddDate(0, 0, 3).Truncate(time.Hour)
+	later := time.Now().AddDate(0, 0, 30).Truncate(time.Hour)
+	conf := &types.MerchantConfig{CommissionBps: 1000, DepositBps: 2500, DepositMinTickets: 10, BalanceDays: 7}
+	rates := []types.TaxRate{{Name: "State", Rate: 50000}}
+
+	charter := func(dep time.Time, price, deposit int64) CartItem {
+		item := cartItem(fmt.Sprintf("5CHARTER%d7", dep.Unix()), 1, price)
+		item.deposit = usd(deposit)
+		return item
+	}
+
+	tests := []struct {
+		name    string
+		cart    []CartItem
+		group   bool
+		taxes   []types.TaxRate
+		due     int64
+		balance int64
+		comm    int64
+		balComm int64
+		dueDate *time.Time
+	}{
+		{
+			name:    "charter deposit covers the commission",
+			cart:    []CartItem{charter(later, 100000, 25000)},
+			due:     25000,
+			balance: 75000,
+			comm:    10000,
+			balComm: 0,
+			dueDate: &later,
+		},
+		{
+			name:    "small charter deposit leaves commission for the balance",
+			cart:    []CartItem{charter(later, 100000, 5000)},
+			due:     5000,
+			balance: 95000,
+			comm:    10000,
+			balComm: 5000,
+			dueDate: &later,
+		},
+		{
+			name: "charter leaving before the balance is due is paid in full",
+			cart: []CartItem{charter(soon, 100000, 25000)},
+			due:  100000,
+			comm: 10000,
+		},
+		{
+			name:    "group deposit",
+			cart:    []CartItem{cartItem(ticketSku(1, "ADULT", later), 10, 5000)},
+			group:   true,
+			due:     12500,
+			balance: 37500,
+			comm:    5000,
+			balComm: 0,
+			dueDate: &later,
+		},
+		{
+			name:  "group too small for a deposit",
+			cart:  []CartItem{cartItem(ticketSku(1, "ADULT", later), 9, 5000)},
+			group: true,
+			due:   45000,
+			comm:  4500,
+		},
+		{
+			name: "group that didn't choose a deposit",
+			cart: []CartItem{cartItem(ticketSku(1, "ADULT", later), 10, 5000)},
+			due:  50000,
+			comm: 5000,
+		},
+		{
+			name:    "tax is paid up front",
+			cart:    []CartItem{cartItem(ticketSku(1, "ADULT", later), 10, 5000)},
+			group:   true,
+			taxes:   rates,
+			due:     15000,
+			balance: 37500,
+			comm:    5000,
+			balComm: 0,
+			dueDate: &later,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := &Rules{Options: Options{Deposit: tt.group}, Taxes: tt.taxes}
+			q := newQuote(conf, rules, newLines(tt.cart))
+
+			if q.Due.Cents != tt.due || q.Balance.Cents != tt.balance {
+				t.Errorf("due, balance = %d, %d, want %d, %d", q.Due.Cents, q.Balance.Cents, tt.due, tt.balance)
+			}
+			if q.Commission.Cents != tt.comm || q.BalanceCommission.Cents != tt.balComm {
+				t.Errorf("commission, balance commission = %d, %d, want %d, %d",
+					q.Commission.Cents, q.BalanceCommission.Cents, tt.comm, tt.balComm)
+			}
+			// what is taken with the first payment and the balance make up
+			// the whole commission
+			if now := q.Commission.Min(q.Due); now.Add(q.BalanceCommission).Cents != q.Commission.Cents {
+				t.Errorf("commission now %d and later %d don't add up to %d", now.Cents, q.BalanceCommission.Cents, q.Commission.Cents)
+			}
+
+			switch {
+			case tt.dueDate == nil && q.BalanceDue != nil:
+				t.Errorf("BalanceDue = %s, want none", q.BalanceDue)
+			case tt.dueDate != nil && q.BalanceDue == nil:
+				t.Errorf("BalanceDue is missing")
+			case tt.dueDate != nil:
+				if want := tt.dueDate.AddDate(0, 0, -conf.BalanceDays); !q.BalanceDue.Equal(want) {
+					t.Errorf("BalanceDue = %s, want %s", q.BalanceDue, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package pricing
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// LoadPriceRules returns the merchant's dynamic pricing rules in the order
+// they are applied
+func LoadPriceRules(db *gorm.DB, merchantID string) []types.PriceRule {
+	var rules []types.PriceRule
+	db.Order("priority, id").Find(&rules, "merchant_id = ?", merchantID)
+	return rules
+}
+
+// AdjustPrice runs a ticket's base price through every rule that applies
+// to the trip, returning the final price and the names of the rules used.
+func AdjustPrice(rules []types.PriceRule, trip types.Trip, base types.Money) (types.Money, []string) {
+	price := base
+	applied := []string{}
+	for idx := range rules {
+		if rules[idx].Applies(trip) {
+			price = rules[idx].Adjust(price)
+			applied = append(applied, rules[idx].Name)
+		}
+	}
+	return price, applied
+}
+
+// occupancy is the percent of a departure's seats that are sold
+func occupancy(left, capacity int) int {
+	if capacity <= 0 {
+		return 100
+	}
+	sold := capacity - left
+	if sold < 0 {
+		sold = 0
+	}
+	return sold * 100 / capacity
+}
+
+// TicketPrice is the price of one ticket category on a trip
+type TicketPrice struct {
+	Name  string      `json:"name"`
+	Sku   string      `json:"sku"`
+	Base  types.Money `json:"base"`
+	Price types.Money `json:"price"`
+	Rules []string    `json:"rules"`
+}
+
+// TripPrices is the availability and current ticket prices of a departure
+type TripPrices struct {
+	ProductID uint          `json:"productId"`
+	Product   string        `json:"product"`
+	Time      time.Time     `json:"time"`
+	SeatsLeft int           `json:"seatsLeft"`
+	Occupancy int           `json:"occupancy"`
+	Cancelled bool          `json:"cancelled"`
+	Chartered bool          `json:"chartered"`
+	Tickets   []TicketPrice `json:"tickets"`
+}
+
+// Departure is a single scheduled trip of a product
+type Departure struct {
+	ProductID uint
+	Product   string
+	BoatID    uint
+	Charter   bool
+	Time      time.Time
+	End       time.Time
+	Schedule  *types.Schedule
+	Category  string
+
+	charterPrice types.Money
+}
+
+// Departures lists every trip of the merchant's published products between
+// two dates inclusive, or only those of one product if productID isn't 0.
+func Departures(db *gorm.DB, merchantID string, productID uint, from, to time.Time) []Departure {
+	var prods []catalogProduct
+	q := db.Table("products").Select(productColumns).
+		Where("merchant_id = ? AND deleted_at IS NULL AND publish", merchantID)
+	if productID != 0 {
+		q = q.Where("id = ?", productID)
+	}
+	q.Scan(&prods)
+
+	var out []Departure
+	for _, p := range prods {
+		scheds := loadSchedules(db, p.ID, from, to)
+
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			for sidx := range scheds {
+				s := &scheds[sidx]
+				if day.Before(s.Start) || day.After(s.End) || !scheduledOn(s, day) {
+					continue
+				}
+				for tidx := range s.TimeArray {
+					t := &s.TimeArray[tidx]
+					h, m, ok := parseClock(t.StartTime)
+					if !ok {
+						continue
+					}
+					start := time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, day.Location())
+					out = append(out, Departure{
+						ProductID: p.ID,
+						Product:   p.Name,
+						BoatID:    p.BoatID,
+						Charter:   p.Kind == types.ProductCharter,
+						Time:      start,
+						End:       tripEnd(start, t),
+						Schedule:  s,
+						Category:  t.Price,
+
+						charterPrice: p.CharterPrice,
+					})
+				}
+			}
+		}
+	}
+
+	prices := overridePrices(db, from, to.AddDate(0, 0, 1))
+	for idx := range out {
+		if p, ok := prices[tripKey(out[idx].ProductID, out[idx].Time)]; ok {
+			out[idx].Category = p
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out
+}
+
+// PriceTrips works out the seats left and ticket prices of each departure,
+// as a customer booking now would see them, using the given rules.
+func PriceTrips(db *gorm.DB, conf *types.MerchantConfig, rules []types.PriceRule, deps []Departure) []TripPrices {
+	now := time.Now()
+	cats := make(map[string]catalogCategory)
+
+	out := make([]TripPrices, 0, len(deps))
+	for _, d := range deps {
+		info := types.SkuInfo{ProductID: d.ProductID, Time: d.Time}
+		left, capacity, cancelled := seatsLeft(db, conf, info, d.Schedule, d.BoatID)
+		trip := types.Trip{ProductID: d.ProductID, Departure: d.Time, BookedAt: now, Occupancy: occupancy(left, capacity)}
+
+		tp := TripPrices{
+			ProductID: d.ProductID,
+			Product:   d.Product,
+			Time:      d.Time,
+			SeatsLeft: left,
+			Occupancy: trip.Occupancy,
+			Cancelled: cancelled,
+			Tickets:   []TicketPrice{},
+		}
+
+		// a charter is either free or taken, and takes the boat from any
+		// open boat trips it overlaps
+		tp.Chartered = len(boatCharters(db, conf.ID, d.BoatID, d.Time, d.End)) > 0
+		if d.Charter {
+			tp.SeatsLeft, tp.Occupancy = 1, 0
+			if tp.Chartered || openTripsSold(db, conf, d.BoatID, d.Time, d.End) {
+				tp.SeatsLeft, tp.Occupancy = 0, 100
+			}
+			trip.Occupancy = tp.Occupancy
+
+			adjusted, applied := AdjustPrice(rules, trip, d.charterPrice)
+			tp.Tickets = append(tp.Tickets, TicketPrice{Name: "Private Charter", Base: d.charterPrice, Price: adjusted, Rules: applied})
+			out = append(out, tp)
+			continue
+		}
+		if tp.Chartered {
+			tp.SeatsLeft = 0
+		}
+
+		cat, ok := cats[d.Category]
+		if !ok {
+			db.Table("ticket_categories").Select("id, categories").
+				Where("id = ? AND merchant_id = ? AND deleted_at IS NULL", d.Category, conf.ID).Scan(&cat)
+			cats[d.Category] = cat
+		}
+
+		for name, price := range cat.Categories {
+			if price == nil {
+				continue
+			}
+			base, err := types.ParseMoney(*price)
+			if err != nil {
+				continue
+			}
+
+			adjusted, applied := AdjustPrice(rules, trip, base)
+			tp.Tickets = append(tp.Tickets, TicketPrice{
+				Name:  name,
+				Sku:   strconv.FormatUint(uint64(d.ProductID), 10) + skuTicket(name) + strconv.FormatInt(d.Time.Unix(), 10),
+				Base:  base,
+				Price: adjusted,
+				Rules: applied,
+			})
+		}
+		sort.Slice(tp.Tickets, func(i, j int) bool { return tp.Tickets[i].Name < tp.Tickets[j].Name })
+		out = append(out, tp)
+	}
+	return out
+}
@@ -0,0 +1,43 @@
+package pricing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// SeatsSold counts the tickets sold for a departure
+func SeatsSold(db *gorm.DB, conf *types.MerchantConfig, productID uint, t time.Time) int {
+	stripeSold, paypalSold := soldSeats(db, conf, fmt.Sprintf("^%d[A-Z]+%d", productID, t.Unix()))
+	return stripeSold + paypalSold
+}
+
+// ExtraConflicts finds the trips of other products which would have the
+// boat out at the same time as an extra departure
+func ExtraConflicts(db *gorm.DB, merchantID string, e *types.ExtraDeparture) []Conflict {
+	var prod catalogProduct
+	db.Table("products").Select(productColumns).
+		Where("id = ? AND merchant_id = ? AND deleted_at IS NULL", e.ProductID, merchantID).Scan(&prod)
+
+	sched := e.Schedule()
+	start := e.Time.In(loc)
+	end := tripEnd(start, &sched.TimeArray[0])
+
+	out := make([]Conflict, 0)
+	for _, d := range Departures(db, merchantID, 0, sched.Start, sched.End) {
+		if d.ProductID == e.ProductID || d.BoatID != prod.BoatID || d.Charter || !overlaps(start, end, d.Time, d.End) {
+			continue
+		}
+		out = append(out, Conflict{
+			ProductID: d.ProductID,
+			Product:   d.Product,
+			From:      start.Format("2006-01-02"),
+			To:        start.Format("2006-01-02"),
+			Time:      start.Format("15:04"),
+			OtherTime: d.Time.Format("15:04"),
+		})
+	}
+	return out
+}
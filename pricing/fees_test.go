@@ -0,0 +1,45 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func usd(cents int64) types.Money { return types.NewMoney(cents, "") }
+
+func TestFeeFor(t *testing.T) {
+	tiers := types.FeeTiers{
+		{Over: usd(0), Amount: usd(100)},
+		{Over: usd(10000), Amount: usd(200), Percent: 100},
+		{Over: usd(50000), Amount: usd(500)},
+	}
+
+	tests := []struct {
+		name     string
+		rule     types.FeeRule
+		subtotal int64
+		tickets  int64
+		want     int64
+	}{
+		{"flat", types.FeeRule{Kind: types.FeeFlat, Amount: usd(250)}, 5000, 2, 250},
+		{"flat without tickets", types.FeeRule{Kind: types.FeeFlat, Amount: usd(250)}, 5000, 0, 0},
+		{"per ticket", types.FeeRule{Kind: types.FeePerTicket, Amount: usd(150)}, 5000, 3, 450},
+		{"percent", types.FeeRule{Kind: types.FeePercent, Percent: 350}, 12345, 1, 432},
+		{"step", types.FeeRule{Kind: types.FeeStep, Amount: usd(100), Step: usd(2500)}, 9999, 1, 300},
+		{"step without a step", types.FeeRule{Kind: types.FeeStep, Amount: usd(100)}, 9999, 1, 0},
+		{"lowest tier", types.FeeRule{Kind: types.FeeTiered, Tiers: tiers}, 5000, 1, 100},
+		{"middle tier", types.FeeRule{Kind: types.FeeTiered, Tiers: tiers}, 20000, 1, 400},
+		{"top tier", types.FeeRule{Kind: types.FeeTiered, Tiers: tiers}, 50000, 1, 500},
+		{"capped", types.FeeRule{Kind: types.FeePerTicket, Amount: usd(150), Cap: usd(500)}, 5000, 10, 500},
+		{"unknown kind", types.FeeRule{Kind: "other", Amount: usd(150)}, 5000, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FeeFor(&tt.rule, usd(tt.subtotal), tt.tickets); got.Cents != tt.want {
+				t.Errorf("FeeFor() = %d, want %d", got.Cents, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// ScheduleImpact is a departure with paid bookings that a product's new
+// schedules drop or move. NewTime is the same trip's new start time if it
+// was moved, or nil if the trip is gone.
+type ScheduleImpact struct {
+	ProductID uint         `json:"productId"`
+	Time      time.Time    `json:"time"`
+	NewTime   *time.Time   `json:"newTime"`
+	Sold      int          `json:"sold"`
+	Orders    []OrderSeats `json:"orders"`
+	// Conflict is why the trip can't be moved to NewTime, such as there not
+	// being enough seats left then
+	Conflict string `json:"conflict,omitempty"`
+}
+
+// ErrMoveFull is the conflict of a trip with more tickets sold than there
+// are seats left at the time it would move to
+var ErrMoveFull = errors.New("not enough seats are left at the new time")
+
+// ErrMoveCancelled is the conflict of a trip that would move to a time that
+// was cancelled
+var ErrMoveCancelled = errors.New("the trip at the new time was cancelled")
+
+// addExceptions adds a product's blackout dates to the NotAvail of its
+// schedules and its extra departures between from and to as schedules
+func addExceptions(db *gorm.DB, productID uint, scheds []types.Schedule, from, to time.Time) []types.Schedule {
+	var blackouts []types.Blackout
+	db.Where("? = ANY (product_ids)", productID).Find(&blackouts)
+	for sidx := range scheds {
+		for _, b := range blackouts {
+			scheds[sidx].NotAvail = append(scheds[sidx].NotAvail, b.Dates...)
+		}
+	}
+
+	var extras []types.ExtraDeparture
+	db.Where("product_id = ? AND time >= ? AND time < ?", productID, from, to.AddDate(0, 0, 1)).
+		Order("time").Find(&extras)
+	for _, e := range extras {
+		scheds = append(scheds, e.Schedule())
+	}
+	return scheds
+}
+
+// runsAt returns the schedule leaving at t, or nil if none of them do
+func runsAt(scheds []types.Schedule, t time.Time) *types.Schedule {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for sidx := range scheds {
+		s := &scheds[sidx]
+		if day.Before(s.Start) || day.After(s.End) || !scheduledOn(s, day) {
+			continue
+		}
+		for _, st := range s.TimeArray {
+			if h, m, ok := parseClock(st.StartTime); ok && h == t.Hour() && m == t.Minute() {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+// ScheduleImpacts finds the departures of a product after now with paid
+// bookings which the schedules it is about to be saved with no longer run,
+// leaving out any that were already cancelled.
+// A trip time kept with a new start time moves its departures to the new
+// time on the same day if the new schedules run then, a move is a conflict
+// if the departure then is cancelled or hasn't the seats for it.
+func ScheduleImpacts(db *gorm.DB, conf *types.MerchantConfig, productID uint, scheds []types.Schedule, now time.Time) []ScheduleImpact {
+	out := make([]ScheduleImpact, 0)
+	if productID == 0 {
+		return out
+	}
+
+	lines := orderSeats(db, conf, `SUBSTRING(sku FROM '^(\d+)[A-Z]+\d{10}\d*$') = ?
+		AND CAST(SUBSTRING(sku FROM '^\d+[A-Z]+(\d{10})\d*$') AS bigint) > ?`,
+		strconv.FormatUint(uint64(productID), 10), now.Unix())
+	if len(lines) == 0 {
+		return out
+	}
+
+	trips := make(map[int64]*ScheduleImpact)
+	for _, l := range lines {
+		info, ok := types.ParseSku(l.Sku)
+		if !ok {
+			continue
+		}
+		imp, ok := trips[info.Time.Unix()]
+		if !ok {
+			imp = &ScheduleImpact{ProductID: productID, Time: info.Time}
+			trips[info.Time.Unix()] = imp
+		}
+		imp.Sold += l.Quantity
+		imp.Orders = append(imp.Orders, l)
+	}
+
+	last := now
+	for _, imp := range trips {
+		if imp.Time.After(last) {
+			last = imp.Time
+		}
+	}
+
+	// the new schedules get the same blackouts and extra departures the
+	// saved ones have, without touching the ones being saved
+	next := make([]types.Schedule, len(scheds))
+	for idx, s := range scheds {
+		s.NotAvail = append(pq.StringArray{}, s.NotAvail...)
+		next[idx] = s
+	}
+	next = addExceptions(db, productID, next, now, last)
+
+	newTimes := make(map[uint]*types.ScheduleTime)
+	for sidx := range scheds {
+		for tidx, st := range scheds[sidx].TimeArray {
+			if st.ID != 0 {
+				newTimes[st.ID] = &scheds[sidx].TimeArray[tidx]
+			}
+		}
+	}
+
+	cancelled := cancelledTrips(db, now, last)
+	for _, imp := range trips {
+		if cancelled[tripKey(productID, imp.Time)] || runsAt(next, imp.Time) != nil {
+			continue
+		}
+
+		// trips the saved schedules didn't run either aren't changed now
+		_, old := findScheduleTime(db, types.SkuInfo{ProductID: productID, Time: imp.Time})
+		if old == nil {
+			continue
+		}
+		if st, ok := newTimes[old.ID]; ok {
+			if h, m, ok := parseClock(st.StartTime); ok {
+				t := time.Date(imp.Time.Year(), imp.Time.Month(), imp.Time.Day(), h, m, 0, 0, imp.Time.Location())
+				if runsAt(next, t) != nil {
+					imp.NewTime = &t
+				}
+			}
+		}
+		out = append(out, *imp)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+
+	// departures moved to the same time share its seats
+	movedIn := make(map[int64]int)
+	for idx := range out {
+		imp := &out[idx]
+		if imp.NewTime == nil {
+			continue
+		}
+		capacity, sold, cancelled := moveSeats(db, conf, productID, runsAt(next, *imp.NewTime), *imp.NewTime)
+		if err := fitMove(imp.Sold, capacity, sold+movedIn[imp.NewTime.Unix()], cancelled); err != nil {
+			imp.Conflict = err.Error()
+			continue
+		}
+		movedIn[imp.NewTime.Unix()] += imp.Sold
+	}
+	return out
+}
+
+// moveSeats returns how many seats the departure of a product at t has in
+// all, how many of them are sold and whether it was cancelled. PayPal
+// orders took their seats off the avail of its manual override if it has
+// one, so they're added back to get its capacity.
+func moveSeats(db *gorm.DB, conf *types.MerchantConfig, productID uint, sched *types.Schedule, t time.Time) (int, int, bool) {
+	stripeSold, paypalSold := soldSeats(db, conf, fmt.Sprintf("^%d[A-Z]+%d", productID, t.Unix()))
+	capacity := int(sched.TicketsAvail)
+
+	var over tripOverride
+	if !db.Table("manual_overrides").Select("cancelled, avail, price").
+		Where("product_id = ? AND time = ?", productID, t).Scan(&over).RecordNotFound() {
+		if over.Cancelled {
+			return 0, stripeSold + paypalSold, true
+		}
+		capacity = over.Avail + paypalSold
+	}
+	return capacity, stripeSold + paypalSold, false
+}
+
+// fitMove checks there is a seat for each of the moving tickets at a
+// departure with capacity seats, sold of which are taken
+func fitMove(moving, capacity, sold int, cancelled bool) error {
+	switch {
+	case cancelled:
+		return ErrMoveCancelled
+	case moving > capacity-sold:
+		return ErrMoveFull
+	}
+	return nil
+}
+
+// skuTimeRe matches the departure time of a ticket sku
+var skuTimeRe = regexp.MustCompile(`^(\d+[A-Z]+)\d{10}`)
+
+// retime changes the departure time of a ticket sku
+func retime(sku string, t time.Time) string {
+	return skuTimeRe.ReplaceAllString(sku, "${1}"+strconv.FormatInt(t.Unix(), 10))
+}
+
+// movedTo follows the moves of a product's departure at t to where its
+// bookings are now. Each move is only followed by ones made after it so a
+// trip moved back and forth ends up at the right time.
+func movedTo(moves []types.TripMove, productID uint, t time.Time) time.Time {
+	var after uint
+	for {
+		var next *types.TripMove
+		for idx := range moves {
+			m := &moves[idx]
+			if m.ProductID == productID && m.FromTime.Equal(t) && m.ID > after && (next == nil || m.ID < next.ID) {
+				next = m
+			}
+		}
+		if next == nil {
+			return t
+		}
+		t, after = next.ToTime, next.ID
+	}
+}
+
+// movedFrom returns the times the bookings of a product's departure at t
+// were moved from, leaving out t itself
+func movedFrom(moves []types.TripMove, productID uint, t time.Time) []time.Time {
+	out := make([]time.Time, 0)
+	seen := map[int64]bool{t.Unix(): true}
+
+	var walk func(to time.Time, before uint)
+	walk = func(to time.Time, before uint) {
+		for _, m := range moves {
+			if m.ProductID != productID || !m.ToTime.Equal(to) || m.ID >= before {
+				continue
+			}
+			if !seen[m.FromTime.Unix()] {
+				seen[m.FromTime.Unix()] = true
+				out = append(out, m.FromTime)
+			}
+			walk(m.FromTime, m.ID)
+		}
+	}
+	walk(t, ^uint(0))
+	return out
+}
+
+// tripMoves loads the trip moves of a merchant's product, or of all its
+// products if productID is 0
+func tripMoves(db *gorm.DB, merchantID string, productID uint) []types.TripMove {
+	var moves []types.TripMove
+	scope := db.Where("merchant_id = ?", merchantID)
+	if productID != 0 {
+		scope = scope.Where("product_id = ?", productID)
+	}
+	scope.Order("id").Find(&moves)
+	return moves
+}
+
+// MoveBookings moves everything booked for a departure to a new start time:
+// the tickets, add-ons and passengers, whose skus are changed to the new
+// time so manifests and seat counts follow the trip, along with its manual
+// override, crew, charter, waitlist, pool and catch report. The move is
+// recorded so boarding passes printed for the old time still scan. It should
+// be run in a transaction, which is left to roll back if it fails.
+func MoveBookings(tx *gorm.DB, conf *types.MerchantConfig, productID uint, from, to time.Time) error {
+	pattern := fmt.Sprintf("^%d[A-Z]+%d", productID, from.Unix())
+	addOnPattern := fmt.Sprintf("^ADDON-\\d+-%d$", from.Unix())
+	stamp := strconv.FormatInt(to.Unix(), 10)
+	const (
+		replace      = `regexp_replace(sku, '^(\d+[A-Z]+)\d{10}', '\1' || ?)`
+		replaceAddOn = `regexp_replace(sku, '-\d+$', '-' || ?)`
+		productAddOn = `CAST(SUBSTRING(sku FROM '^ADDON-(\d+)-') AS integer) IN (SELECT id FROM add_ons WHERE product_id = ?)`
+	)
+
+	// PayPal orders took their seats off the avail of the old time's
+	// override, so they have to come off the new one's too
+	_, paypalSold := soldSeats(tx, conf, pattern)
+	res := tx.Exec(`UPDATE manual_overrides SET avail = avail - ? WHERE product_id = ? AND time = ?`, paypalSold, productID, to)
+	if res.Error != nil {
+		return res.Error
+	}
+	overrides := []interface{}{`UPDATE manual_overrides SET time = ? WHERE product_id = ? AND time = ?`, to, productID, from}
+	if res.RowsAffected > 0 {
+		overrides = []interface{}{`DELETE FROM manual_overrides WHERE product_id = ? AND time = ?`, productID, from}
+	}
+
+	stmts := [][]interface{}{
+		{`UPDATE line_items SET sku = ` + replace + ` WHERE acct = ? AND sku ~ ?`, stamp, conf.StripeKey, pattern},
+		{`UPDATE purchase_items SET sku = ` + replace + ` WHERE sku ~ ?
+			AND checkout_id IN (SELECT checkout_id FROM purchase_units WHERE payee_merchant_id = ?)`,
+			stamp, pattern, conf.ID},
+		{`UPDATE passengers SET sku = ` + replace + ` WHERE merchant_id = ? AND sku ~ ?`, stamp, conf.ID, pattern},
+		{`UPDATE line_items SET sku = ` + replaceAddOn + ` WHERE acct = ? AND sku ~ ? AND ` + productAddOn,
+			stamp, conf.StripeKey, addOnPattern, productID},
+		{`UPDATE purchase_items SET sku = ` + replaceAddOn + ` WHERE sku ~ ? AND ` + productAddOn + `
+			AND checkout_id IN (SELECT checkout_id FROM purchase_units WHERE payee_merchant_id = ?)`,
+			stamp, addOnPattern, productID, conf.ID},
+		overrides,
+		{`UPDATE crew_assignments SET start = ?, "end" = "end" + (CAST(? AS timestamptz) - start)
+			WHERE merchant_id = ? AND product_id = ? AND start = ?`, to, to, conf.ID, productID, from},
+		{`UPDATE charters SET start = ?, "end" = "end" + (CAST(? AS timestamptz) - start)
+			WHERE merchant_id = ? AND product_id = ? AND start = ?`, to, to, conf.ID, productID, from},
+		{`UPDATE waitlist_entries SET time = ? WHERE merchant_id = ? AND product_id = ? AND time = ?`, to, conf.ID, productID, from},
+		{`UPDATE pools SET time = ? WHERE merchant_id = ? AND product_id = ? AND time = ?`, to, conf.ID, productID, from},
+		{`UPDATE catch_reports SET time = ? WHERE merchant_id = ? AND product_id = ? AND time = ?`, to, conf.ID, productID, from},
+	}
+	for _, st := range stmts {
+		if err := tx.Exec(st[0].(string), st[1:]...).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Create(&types.TripMove{MerchantID: conf.ID, ProductID: productID, FromTime: from, ToTime: to}).Error
+}
@@ -0,0 +1,150 @@
+package pricing
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func TestRetime(t *testing.T) {
+	from := time.Date(2030, time.July, 6, 8, 0, 0, 0, loc)
+	to := from.Add(90 * time.Minute)
+
+	tests := []struct {
+		name, sku, want string
+	}{
+		{"ticket", ticketSku(1, "ADULT", from), ticketSku(1, "ADULT", to)},
+		{"charter keeps its suffix", fmt.Sprintf("5CHARTER%d7", from.Unix()), fmt.Sprintf("5CHARTER%d7", to.Unix())},
+		{"not a ticket", FeeSku, FeeSku},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retime(tt.sku, to); got != tt.want {
+				t.Errorf("retime(%q) = %q, want %q", tt.sku, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTripMoves(t *testing.T) {
+	at := func(h int) time.Time { return time.Date(2030, time.July, 6, h, 0, 0, 0, loc) }
+	a, b, c, d := at(8), at(9), at(10), at(11)
+
+	// the 8am trip moved to 9am and back before going to 10am, another
+	// product made the same move to 11am
+	moves := []types.TripMove{
+		{ID: 1, ProductID: 1, FromTime: a, ToTime: b},
+		{ID: 2, ProductID: 1, FromTime: b, ToTime: a},
+		{ID: 3, ProductID: 2, FromTime: a, ToTime: d},
+		{ID: 4, ProductID: 1, FromTime: a, ToTime: c},
+	}
+
+	toTests := []struct {
+		name string
+		from time.Time
+		want time.Time
+	}{
+		{"back and forth", a, c},
+		{"from the middle of the moves", b, c},
+		{"last time", c, c},
+		{"never moved", d, d},
+	}
+	for _, tt := range toTests {
+		t.Run("movedTo "+tt.name, func(t *testing.T) {
+			if got := movedTo(moves, 1, tt.from); !got.Equal(tt.want) {
+				t.Errorf("movedTo(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+
+	fromTests := []struct {
+		name string
+		to   time.Time
+		want []time.Time
+	}{
+		{"every earlier time", c, []time.Time{a, b}},
+		{"leaves out the time itself", a, []time.Time{b}},
+		{"another product's move", d, []time.Time{}},
+	}
+	for _, tt := range fromTests {
+		t.Run("movedFrom "+tt.name, func(t *testing.T) {
+			if got := movedFrom(moves, 1, tt.to); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("movedFrom(%s) = %v, want %v", tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFitMove(t *testing.T) {
+	tests := []struct {
+		name                   string
+		moving, capacity, sold int
+		cancelled              bool
+		want                   error
+	}{
+		{"fits", 4, 20, 16, false, nil},
+		{"one short", 5, 20, 16, false, ErrMoveFull},
+		{"nothing sold yet", 20, 20, 0, false, nil},
+		{"cancelled", 1, 20, 0, true, ErrMoveCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fitMove(tt.moving, tt.capacity, tt.sold, tt.cancelled); got != tt.want {
+				t.Errorf("fitMove() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunsAt(t *testing.T) {
+	at := func(m time.Month, d, h int) time.Time { return time.Date(2030, m, d, h, 0, 0, 0, loc) }
+	scheds := []types.Schedule{
+		{
+			ID:        1,
+			Start:     at(time.June, 1, 0),
+			End:       at(time.August, 31, 0),
+			Days:      pq.Int64Array{0, 6},
+			TimeArray: []types.ScheduleTime{{StartTime: "08:00"}, {StartTime: "1:00 PM"}},
+		},
+		{
+			ID:        2,
+			Start:     at(time.June, 1, 0),
+			End:       at(time.August, 31, 0),
+			TimeArray: []types.ScheduleTime{{StartTime: "18:00"}},
+			NotAvail:  pq.StringArray{"2030-07-04"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want uint
+	}{
+		{"weekend morning", at(time.July, 6, 8), 1},
+		{"12 hour clock", at(time.July, 6, 13), 1},
+		{"no trip then", at(time.July, 6, 9), 0},
+		{"weekday morning", at(time.July, 8, 8), 0},
+		{"evening", at(time.July, 5, 18), 2},
+		{"day off", at(time.July, 4, 18), 0},
+		{"last day", at(time.August, 31, 8), 1},
+		{"after the season", at(time.September, 1, 8), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got uint
+			if s := runsAt(scheds, tt.t); s != nil {
+				got = s.ID
+			}
+			if got != tt.want {
+				t.Errorf("runsAt(%s) = schedule %d, want %d", tt.t, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package pricing
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// CashReconciliation is the money handled on the boats and at the dock
+// during a day, what was collected for each payment method, paid out and
+// what should be left in the cash drawer
+type CashReconciliation struct {
+	Date       string                 `json:"date"`
+	Sales      []types.ManualSale     `json:"sales"`
+	Pools      []types.PoolSummary    `json:"pools"`
+	Collected  map[string]types.Money `json:"collected"`
+	PaidOut    types.Money            `json:"paidOut"`
+	House      types.Money            `json:"house"`
+	Unsettled  types.Money            `json:"unsettled"`
+	CashOnHand types.Money            `json:"cashOnHand"`
+}
+
+// LoadPool finds one of the merchant's pools with its entries
+func LoadPool(db *gorm.DB, merchantID string, id interface{}) (*types.Pool, error) {
+	var p types.Pool
+	if db.Preload("Entries", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Where("id = ? AND merchant_id = ?", id, merchantID).First(&p).RecordNotFound() {
+		return nil, types.ErrPoolNotFound
+	}
+	return &p, nil
+}
+
+// EnterPool buys a passenger into a pool, they have to be checked in to the
+// pool's departure
+func EnterPool(db *gorm.DB, p *types.Pool, passengerID uint, method string) (*types.PoolEntry, error) {
+	if method != types.PoolCash && method != types.PoolCard {
+		return nil, types.ErrPoolMethod
+	}
+	if p.PaidAt != nil {
+		return nil, types.ErrPoolSettled
+	}
+
+	var pass types.Passenger
+	if db.Where("id = ? AND merchant_id = ?", passengerID, p.MerchantID).First(&pass).RecordNotFound() {
+		return nil, types.ErrPassengerNotFound
+	}
+	info, ok := types.ParseSku(pass.Sku)
+	if !ok || info.ProductID != p.ProductID || !info.Time.Equal(p.Time) || pass.CheckedInAt == nil {
+		return nil, types.ErrPoolNotCheckedIn
+	}
+
+	for _, e := range p.Entries {
+		if e.PassengerID == pass.ID {
+			return nil, types.ErrPoolEntered
+		}
+	}
+
+	e := types.PoolEntry{PoolID: p.ID, PassengerID: pass.ID, Name: pass.Name, Paid: p.EntryFee, Method: method}
+	if err := db.Create(&e).Error; err != nil {
+		// the unique index catches two devices entering the same passenger
+		return nil, types.ErrPoolEntered
+	}
+	p.Entries = append(p.Entries, e)
+	return &e, nil
+}
+
+// SettlePool records the payout of the pool to the entry with the heaviest
+// fish
+func SettlePool(db *gorm.DB, p *types.Pool, paidBy string) error {
+	if p.PaidAt != nil {
+		return types.ErrPoolSettled
+	}
+	w := p.Winner()
+	if w == nil {
+		return types.ErrPoolNoWeighIn
+	}
+
+	now := time.Now()
+	res := db.Model(&types.Pool{}).Where("id = ? AND paid_at IS NULL", p.ID).
+		Updates(map[string]interface{}{"winner_id": w.ID, "payout": p.Prize(), "paid_at": now, "paid_by": paidBy})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return types.ErrPoolSettled
+	}
+	p.WinnerID, p.Payout, p.PaidAt, p.PaidBy = &w.ID, p.Prize(), &now, paidBy
+	return nil
+}
+
+// PoolsBetween returns the summaries of the pools for departures between
+// start and end
+func PoolsBetween(db *gorm.DB, merchantID string, start, end time.Time) []types.PoolSummary {
+	var list []types.Pool
+	db.Preload("Entries").Where("merchant_id = ? AND time >= ? AND time < ?", merchantID, start, end).
+		Order("time, product_id").Find(&list)
+
+	out := make([]types.PoolSummary, 0, len(list))
+	for idx := range list {
+		out = append(out, list[idx].Summary())
+	}
+	return out
+}
+
+// DayCash reconciles the money handled on the boats and at the dock during
+// the day. Winners are paid out in cash, pots of pools that haven't been
+// paid out yet are still in the drawer.
+func DayCash(db *gorm.DB, merchantID string, day time.Time) CashReconciliation {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	out := CashReconciliation{
+		Date:      start.Format("2006-01-02"),
+		Sales:     ManualSalesBetween(db, merchantID, start, start.AddDate(0, 0, 1)),
+		Pools:     PoolsBetween(db, merchantID, start, start.AddDate(0, 0, 1)),
+		Collected: make(map[string]types.Money),
+	}
+
+	for _, s := range out.Sales {
+		if s.Method != types.SaleComp {
+			out.Collected[s.Method] = out.Collected[s.Method].Add(s.Amount)
+		}
+	}
+
+	for _, p := range out.Pools {
+		for method, amt := range p.Collected {
+			out.Collected[method] = out.Collected[method].Add(amt)
+		}
+		if p.PaidAt != nil {
+			out.PaidOut = out.PaidOut.Add(p.Payout)
+			out.House = out.House.Add(p.House)
+		} else {
+			out.Unsettled = out.Unsettled.Add(p.Pot)
+		}
+	}
+	out.CashOnHand = out.Collected[types.PoolCash].Sub(out.PaidOut)
+	return out
+}
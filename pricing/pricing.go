@@ -0,0 +1,416 @@
+// Package pricing computes the full price of a cart, including discounts,
+// booking fees, taxes and platform commission, so that every payment
+// provider charges the same amounts.
+package pricing
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// Skus used for the extra lines sent to payment providers so they can be
+// told apart from tickets
+const (
+	FeeSku = "FEE"
+	TaxSku = "TAX"
+	// GiftCardSku is used for cart items which buy a gift card worth
+	// their unit amount
+	GiftCardSku = "GIFTCARD"
+	// BalanceSku is used for the payment of an order's balance due
+	BalanceSku = "BALANCE"
+)
+
+// CartItem is a single line of a cart as sent by the calendar front end
+type CartItem struct {
+	Name       string       `json:"name"`
+	UnitAmount types.Amount `json:"unit_amount"`
+	Quantity   int          `json:"quantity,string"`
+	Sku        string       `json:"sku"`
+	Desc       string       `json:"description"`
+
+	// deposit is what has to be paid up front per unit, set when the
+	// cart is validated
+	deposit types.Money
+}
+
+// Charge is a named amount added to an order on top of the tickets
+type Charge struct {
+	Name   string      `json:"name"`
+	Amount types.Money `json:"amount"`
+}
+
+// Line is a single priced line of a quote
+type Line struct {
+	Sku      string      `json:"sku"`
+	Name     string      `json:"name"`
+	Desc     string      `json:"description"`
+	Unit     types.Money `json:"unitAmount"`
+	Quantity int64       `json:"quantity"`
+	Total    types.Money `json:"total"`
+	// Tax is the total tax for the line, UnitTax is the tax per unit
+	// as PayPal wants it
+	Tax     types.Money `json:"tax"`
+	UnitTax types.Money `json:"unitTax"`
+	// Discount is the total promo discount for the line
+	Discount     types.Money `json:"discount"`
+	UnitDiscount types.Money `json:"unitDiscount"`
+
+	ticket     bool
+	giftCard   bool
+	addOn      bool
+	productID  uint
+	categoryID uint
+	departure  time.Time
+	deposit    types.Money
+}
+
+// Quote is the price breakdown of a cart that is shown to the customer
+// and charged by the payment provider.
+type Quote struct {
+	Lines    []Line      `json:"lines"`
+	Tickets  int64       `json:"tickets"`
+	Subtotal types.Money `json:"subtotal"`
+	Promo    string      `json:"promo,omitempty"`
+	Discount types.Money `json:"discount"`
+	Fees     []Charge    `json:"fees"`
+	FeeTotal types.Money `json:"feeTotal"`
+	Taxes    []Charge    `json:"taxes"`
+	TaxTotal types.Money `json:"taxTotal"`
+	Total    types.Money `json:"total"`
+	// Credit is how much of the Total the voucher pays for and Due is
+	// what is left to charge the customer
+	Voucher string      `json:"voucher,omitempty"`
+	Credit  types.Money `json:"credit"`
+	Due     types.Money `json:"due"`
+	// Balance is what is left to pay by BalanceDue when booking with a
+	// deposit, it isn't included in Due
+	Balance    types.Money `json:"balance"`
+	BalanceDue *time.Time  `json:"balanceDue,omitempty"`
+	// BalanceCommission is the commission still to be taken when the
+	// balance is paid
+	BalanceCommission types.Money `json:"-"`
+	// Commission is the platform's share of the order, it isn't shown
+	// to the customer
+	Commission types.Money `json:"-"`
+}
+
+// Options are the codes the customer entered at checkout, they should
+// already have been checked with LoadPromo and LoadVoucher.
+type Options struct {
+	Promo   *types.PromoCode
+	Voucher *types.Voucher
+	// Deposit is set when a group chooses to pay a deposit now and the
+	// balance later
+	Deposit bool
+}
+
+// Rules holds the merchant's configured fees and tax rates along with
+// the customer's codes
+type Rules struct {
+	Options
+	Fees  []types.FeeRule
+	Taxes []types.TaxRate
+}
+
+// LoadFeeRules returns the fee rules configured for a merchant
+func LoadFeeRules(db *gorm.DB, merchantID string) []types.FeeRule {
+	var rules []types.FeeRule
+	db.Order("id").Find(&rules, "merchant_id = ?", merchantID)
+	return rules
+}
+
+// LoadTaxRates returns the tax rates configured for a merchant
+func LoadTaxRates(db *gorm.DB, merchantID string) []types.TaxRate {
+	var rates []types.TaxRate
+	db.Order("id").Find(&rates, "merchant_id = ?", merchantID)
+	return rates
+}
+
+// LoadRules fetches everything needed to price a cart for a merchant
+func LoadRules(db *gorm.DB, merchantID string) *Rules {
+	return &Rules{
+		Fees:  LoadFeeRules(db, merchantID),
+		Taxes: LoadTaxRates(db, merchantID),
+	}
+}
+
+func (r *Rules) needCategories() bool {
+	if r.Promo != nil && r.Promo.TicketCategoryID != nil {
+		return true
+	}
+	for _, t := range r.Taxes {
+		if t.TicketCategoryID != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// FeeFor calculates the amount of a single fee rule for an order
+func FeeFor(rule *types.FeeRule, subtotal types.Money, tickets int64) types.Money {
+	fee := types.NewMoney(0, subtotal.Currency)
+
+	switch rule.Kind {
+	case types.FeeFlat:
+		if tickets > 0 {
+			fee = fee.Add(rule.Amount)
+		}
+	case types.FeePerTicket:
+		fee = fee.Add(rule.Amount.Mul(tickets))
+	case types.FeePercent:
+		fee = subtotal.Percent(rule.Percent)
+	case types.FeeStep:
+		if rule.Step.Cents > 0 {
+			fee = fee.Add(rule.Amount.Mul(subtotal.Cents / rule.Step.Cents))
+		}
+	case types.FeeTiered:
+		var tier *types.FeeTier
+		for idx, t := range rule.Tiers {
+			if subtotal.Cents >= t.Over.Cents && (tier == nil || t.Over.Cents >= tier.Over.Cents) {
+				tier = &rule.Tiers[idx]
+			}
+		}
+		if tier != nil {
+			fee = fee.Add(tier.Amount).Add(subtotal.Percent(tier.Percent))
+		}
+	}
+
+	if rule.Cap.Cents > 0 {
+		fee = fee.Min(rule.Cap)
+	}
+	return fee
+}
+
+func newLines(cart []CartItem) []Line {
+	lines := make([]Line, 0, len(cart))
+	for _, item := range cart {
+		if item.Sku == FeeSku || item.Sku == TaxSku {
+			continue
+		}
+
+		qty := int64(item.Quantity)
+		line := Line{
+			Sku:      item.Sku,
+			Name:     item.Name,
+			Desc:     item.Desc,
+			Unit:     item.UnitAmount.Value,
+			Quantity: qty,
+			Total:    item.UnitAmount.Value.Mul(qty),
+			deposit:  item.deposit,
+		}
+
+		if info, ok := types.ParseSku(item.Sku); ok {
+			line.ticket = true
+			line.productID = info.ProductID
+			line.departure = info.Time
+		}
+		if _, t, ok := types.ParseAddOnSku(item.Sku); ok {
+			line.addOn = true
+			line.departure = t
+		}
+		line.giftCard = item.Sku == GiftCardSku
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// applyTax works out the tax for every ticket and add-on line, rounding per
+// unit so that the per item amounts sent to PayPal add up to the total.
+// Add-ons only pay the rates which aren't limited to a product or ticket.
+func applyTax(q *Quote, rates []types.TaxRate) {
+	byRate := make([]types.Money, len(rates))
+	for lidx := range q.Lines {
+		line := &q.Lines[lidx]
+		line.UnitTax = types.NewMoney(0, line.Unit.Currency)
+		line.Tax = line.UnitTax
+		if !line.ticket && !line.addOn {
+			continue
+		}
+
+		for ridx := range rates {
+			if !rates[ridx].Applies(line.productID, line.categoryID) {
+				continue
+			}
+
+			unit := rates[ridx].Tax(line.Unit.Sub(line.UnitDiscount))
+			line.UnitTax = line.UnitTax.Add(unit)
+			byRate[ridx] = byRate[ridx].Add(unit.Mul(line.Quantity))
+		}
+		line.Tax = line.UnitTax.Mul(line.Quantity)
+		q.TaxTotal = q.TaxTotal.Add(line.Tax)
+	}
+
+	for idx, amount := range byRate {
+		if amount.Cents > 0 {
+			q.Taxes = append(q.Taxes, Charge{Name: rates[idx].Name, Amount: amount})
+		}
+	}
+}
+
+// applyPromo discounts every ticket line the promo code applies to
+func applyPromo(q *Quote, promo *types.PromoCode) {
+	for idx := range q.Lines {
+		line := &q.Lines[idx]
+		line.UnitDiscount = types.NewMoney(0, line.Unit.Currency)
+		if promo != nil && line.ticket && promo.Applies(line.productID, line.categoryID) {
+			line.UnitDiscount = promo.Discount(line.Unit)
+		}
+		line.Discount = line.UnitDiscount.Mul(line.Quantity)
+		q.Discount = q.Discount.Add(line.Discount)
+	}
+
+	if promo != nil && q.Discount.Cents > 0 {
+		q.Promo = promo.Code
+	}
+}
+
+func newQuote(conf *types.MerchantConfig, rules *Rules, lines []Line) *Quote {
+	q := &Quote{
+		Lines:    lines,
+		Fees:     make([]Charge, 0, len(rules.Fees)),
+		Taxes:    make([]Charge, 0, len(rules.Taxes)),
+		Subtotal: types.NewMoney(0, ""),
+		Discount: types.NewMoney(0, ""),
+		FeeTotal: types.NewMoney(0, ""),
+		TaxTotal: types.NewMoney(0, ""),
+		Credit:   types.NewMoney(0, ""),
+		Balance:  types.NewMoney(0, ""),
+	}
+
+	// gift cards are charged at face value, fees and commission are taken
+	// when they are spent instead
+	giftCards := types.NewMoney(0, "")
+	for _, line := range lines {
+		q.Subtotal = q.Subtotal.Add(line.Total)
+		if line.ticket {
+			q.Tickets += line.Quantity
+		}
+		if line.giftCard {
+			giftCards = giftCards.Add(line.Total)
+		}
+	}
+
+	applyPromo(q, rules.Promo)
+	net := q.Subtotal.Sub(q.Discount).Sub(giftCards)
+
+	for idx := range rules.Fees {
+		fee := FeeFor(&rules.Fees[idx], net, q.Tickets)
+		if fee.Cents <= 0 {
+			continue
+		}
+
+		q.Fees = append(q.Fees, Charge{Name: rules.Fees[idx].Name, Amount: fee})
+		q.FeeTotal = q.FeeTotal.Add(fee)
+	}
+
+	applyTax(q, rules.Taxes)
+
+	q.Total = net.Add(giftCards).Add(q.FeeTotal).Add(q.TaxTotal)
+	q.Commission = net.Percent(conf.CommissionBps)
+
+	if v := rules.Voucher; v != nil {
+		q.Voucher = v.Code
+		q.Credit = v.Balance.Min(q.Total.Sub(giftCards))
+	}
+	q.Due = q.Total.Sub(q.Credit)
+	applyDeposit(q, conf, rules.Deposit)
+	return q
+}
+
+// Comp gives the whole order away, nothing is collected for it so the
+// tickets are all discounted and there are no fees, tax, balance or
+// commission.
+func (q *Quote) Comp() {
+	zero := types.NewMoney(0, q.Total.Currency)
+	for idx := range q.Lines {
+		line := &q.Lines[idx]
+		line.Discount, line.UnitDiscount = line.Total, line.Unit
+		line.Tax, line.UnitTax = zero, zero
+	}
+
+	q.Discount = q.Subtotal
+	q.Fees, q.FeeTotal = make([]Charge, 0), zero
+	q.Taxes, q.TaxTotal = make([]Charge, 0), zero
+	q.Total, q.Credit, q.Due = zero, zero, zero
+	q.Balance, q.BalanceDue, q.BalanceCommission = zero, nil, zero
+	q.Commission = zero
+}
+
+// applyDeposit moves what doesn't have to be paid up front out of Due and
+// into the Balance, for charters which take a deposit and for large groups
+// that chose to pay one. Fees and taxes are always paid up front, and trips
+// leaving before the balance would be due are paid in full.
+func applyDeposit(q *Quote, conf *types.MerchantConfig, group bool) {
+	group = group && conf.DepositBps > 0 && q.Tickets >= int64(conf.DepositMinTickets)
+
+	deferred := types.NewMoney(0, q.Due.Currency)
+	var first time.Time
+	for _, line := range q.Lines {
+		if !line.ticket {
+			continue
+		}
+
+		net := line.Unit.Sub(line.UnitDiscount)
+		var unit types.Money
+		switch {
+		case line.deposit.Cents > 0:
+			unit = net.Sub(line.deposit)
+		case group:
+			unit = net.Sub(net.Percent(conf.DepositBps))
+		default:
+			continue
+		}
+		if unit.Cents <= 0 {
+			continue
+		}
+
+		deferred = deferred.Add(unit.Mul(line.Quantity))
+		if first.IsZero() || line.departure.Before(first) {
+			first = line.departure
+		}
+	}
+
+	due := first.AddDate(0, 0, -conf.BalanceDays)
+	if deferred.Cents <= 0 || due.Before(time.Now()) {
+		return
+	}
+
+	q.Balance = deferred.Min(q.Due)
+	q.Due = q.Due.Sub(q.Balance)
+	q.BalanceDue = &due
+	q.BalanceCommission = q.Commission.Sub(q.Commission.Min(q.Due))
+}
+
+// QuoteCart loads the merchant's pricing rules and prices the cart
+func QuoteCart(db *gorm.DB, conf *types.MerchantConfig, cart []CartItem, opts Options) *Quote {
+	rules := LoadRules(db, conf.ID)
+	rules.Options = opts
+	lines := newLines(cart)
+
+	if rules.needCategories() {
+		for idx := range lines {
+			if info, ok := types.ParseSku(lines[idx].Sku); ok {
+				lines[idx].categoryID = ticketCategoryID(db, info)
+			}
+		}
+	}
+
+	return newQuote(conf, rules, lines)
+}
+
+// CartFromPurchaseItems rebuilds a cart from the items of a PayPal order
+func CartFromPurchaseItems(items []types.PurchaseItem) []CartItem {
+	cart := make([]CartItem, 0, len(items))
+	for _, i := range items {
+		cart = append(cart, CartItem{
+			Name:       i.Name,
+			UnitAmount: i.Amount,
+			Quantity:   int(i.Quantity),
+			Sku:        i.Sku,
+			Desc:       i.Description,
+		})
+	}
+	return cart
+}
@@ -0,0 +1,178 @@
+package pricing
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// ticketSku builds the sku of a ticket for a product's departure at t
+func ticketSku(productID uint, ticket string, t time.Time) string {
+	return fmt.Sprintf("%d%s%d", productID, ticket, t.Unix())
+}
+
+func cartItem(sku string, qty int, cents int64) CartItem {
+	return CartItem{Sku: sku, Quantity: qty, UnitAmount: types.Amount{Value: usd(cents)}}
+}
+
+func TestQuoteTax(t *testing.T) {
+	dep := time.Date(2030, time.July, 4, 8, 0, 0, 0, loc)
+	one := uint(1)
+	rates := []types.TaxRate{
+		{Name: "State", Rate: 62500},
+		{Name: "County", Rate: 20000, ProductID: &one},
+	}
+	conf := &types.MerchantConfig{CommissionBps: 200}
+
+	tests := []struct {
+		name     string
+		cart     []CartItem
+		promo    *types.PromoCode
+		lineTax  []int64
+		byRate   map[string]int64
+		total    int64
+		due      int64
+		comm     int64
+		subtotal int64
+	}{
+		{
+			name: "rates limited to a product",
+			cart: []CartItem{
+				cartItem(ticketSku(1, "ADULT", dep), 2, 2500),
+				cartItem(ticketSku(2, "ADULT", dep), 1, 1999),
+			},
+			lineTax:  []int64{412, 125},
+			byRate:   map[string]int64{"State": 437, "County": 100},
+			subtotal: 6999,
+			total:    7536,
+			due:      7536,
+			comm:     140,
+		},
+		{
+			name: "fee and tax lines are recalculated",
+			cart: []CartItem{
+				cartItem(ticketSku(2, "ADULT", dep), 1, 1000),
+				cartItem(FeeSku, 1, 500),
+				cartItem(TaxSku, 1, 999),
+			},
+			lineTax:  []int64{63},
+			byRate:   map[string]int64{"State": 63},
+			subtotal: 1000,
+			total:    1063,
+			due:      1063,
+			comm:     20,
+		},
+		{
+			name: "add-ons only pay rates for every product",
+			cart: []CartItem{
+				cartItem(fmt.Sprintf("ADDON-4-%d", dep.Unix()), 1, 1000),
+			},
+			lineTax:  []int64{63},
+			byRate:   map[string]int64{"State": 63},
+			subtotal: 1000,
+			total:    1063,
+			due:      1063,
+			comm:     20,
+		},
+		{
+			name: "gift cards aren't taxed or commissioned",
+			cart: []CartItem{
+				cartItem(ticketSku(2, "ADULT", dep), 1, 1000),
+				cartItem(GiftCardSku, 1, 5000),
+			},
+			lineTax:  []int64{63, 0},
+			byRate:   map[string]int64{"State": 63},
+			subtotal: 6000,
+			total:    6063,
+			due:      6063,
+			comm:     20,
+		},
+		{
+			name: "tax is on the discounted price",
+			cart: []CartItem{
+				cartItem(ticketSku(1, "ADULT", dep), 2, 2500),
+			},
+			promo:    &types.PromoCode{Kind: types.PromoPercent, Percent: 1000},
+			lineTax:  []int64{372},
+			byRate:   map[string]int64{"State": 282, "County": 90},
+			subtotal: 5000,
+			total:    4872,
+			due:      4872,
+			comm:     90,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := &Rules{Options: Options{Promo: tt.promo}, Taxes: rates}
+			q := newQuote(conf, rules, newLines(tt.cart))
+
+			if len(q.Lines) != len(tt.lineTax) {
+				t.Fatalf("got %d lines, want %d", len(q.Lines), len(tt.lineTax))
+			}
+			var sum int64
+			for idx, line := range q.Lines {
+				if line.Tax.Cents != tt.lineTax[idx] {
+					t.Errorf("line %d tax = %d, want %d", idx, line.Tax.Cents, tt.lineTax[idx])
+				}
+				if line.Tax.Cents != line.UnitTax.Mul(line.Quantity).Cents {
+					t.Errorf("line %d tax %d isn't its unit tax %d times %d", idx, line.Tax.Cents, line.UnitTax.Cents, line.Quantity)
+				}
+				sum += line.Tax.Cents
+			}
+			if q.TaxTotal.Cents != sum {
+				t.Errorf("TaxTotal = %d, want the line taxes %d", q.TaxTotal.Cents, sum)
+			}
+
+			if len(q.Taxes) != len(tt.byRate) {
+				t.Errorf("Taxes = %v, want %v", q.Taxes, tt.byRate)
+			}
+			for _, ch := range q.Taxes {
+				if ch.Amount.Cents != tt.byRate[ch.Name] {
+					t.Errorf("%s tax = %d, want %d", ch.Name, ch.Amount.Cents, tt.byRate[ch.Name])
+				}
+			}
+
+			if q.Subtotal.Cents != tt.subtotal || q.Total.Cents != tt.total || q.Due.Cents != tt.due || q.Commission.Cents != tt.comm {
+				t.Errorf("subtotal, total, due, commission = %d, %d, %d, %d, want %d, %d, %d, %d",
+					q.Subtotal.Cents, q.Total.Cents, q.Due.Cents, q.Commission.Cents, tt.subtotal, tt.total, tt.due, tt.comm)
+			}
+		})
+	}
+}
+
+func TestQuoteComp(t *testing.T) {
+	later := time.Now().AddDate(0, 0, 30).Truncate(time.Hour)
+	conf := &types.MerchantConfig{CommissionBps: 1000, DepositBps: 2500, DepositMinTickets: 10, BalanceDays: 7}
+	rules := &Rules{
+		Options: Options{Deposit: true},
+		Taxes:   []types.TaxRate{{Name: "State", Rate: 62500}},
+		Fees:    []types.FeeRule{{Name: "Booking", Kind: types.FeeFlat, Amount: usd(200)}},
+	}
+	q := newQuote(conf, rules, newLines([]CartItem{cartItem(ticketSku(1, "ADULT", later), 10, 5000)}))
+	q.Comp()
+
+	for idx, line := range q.Lines {
+		if line.Discount.Cents != line.Total.Cents || line.Tax.Cents != 0 || line.UnitTax.Cents != 0 {
+			t.Errorf("line %d discount, tax = %d, %d, want %d, 0", idx, line.Discount.Cents, line.Tax.Cents, line.Total.Cents)
+		}
+	}
+	if q.Discount.Cents != q.Subtotal.Cents {
+		t.Errorf("Discount = %d, want the subtotal %d", q.Discount.Cents, q.Subtotal.Cents)
+	}
+	if len(q.Fees) != 0 || len(q.Taxes) != 0 || q.FeeTotal.Cents != 0 || q.TaxTotal.Cents != 0 {
+		t.Errorf("fees, taxes = %v, %v, want none", q.Fees, q.Taxes)
+	}
+	for name, m := range map[string]types.Money{
+		"Total": q.Total, "Due": q.Due, "Balance": q.Balance, "Commission": q.Commission, "BalanceCommission": q.BalanceCommission,
+	} {
+		if m.Cents != 0 {
+			t.Errorf("%s = %d, want 0", name, m.Cents)
+		}
+	}
+	if q.BalanceDue != nil {
+		t.Errorf("BalanceDue = %s, want none", q.BalanceDue)
+	}
+}
@@ -0,0 +1,182 @@
+package pricing
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// PromoHoldTime is how long a checkout that hasn't been paid keeps the use
+// of a promo code it holds, the same as the voucher money it holds
+const PromoHoldTime = VoucherHoldTime
+
+// LoadPromo looks up a merchant's promo code and checks that the customer
+// can use it right now. An empty code returns no promo and no error.
+func LoadPromo(db *gorm.DB, merchantID, code, email string) (*types.PromoCode, error) {
+	code = types.NormalizePromoCode(code)
+	if code == "" {
+		return nil, nil
+	}
+
+	var promo types.PromoCode
+	if db.Where("merchant_id = ? AND code = ?", merchantID, code).First(&promo).RecordNotFound() {
+		return nil, types.ErrPromoNotFound
+	}
+
+	if err := promo.Usable(time.Now()); err != nil {
+		return nil, err
+	}
+	if err := promoLimits(db, &promo, email, time.Now()); err != nil {
+		return nil, err
+	}
+	return &promo, nil
+}
+
+// promoLimits checks that a code has a use left for the customer, counting
+// the uses held by checkouts that haven't been paid yet
+func promoLimits(db *gorm.DB, promo *types.PromoCode, email string, now time.Time) error {
+	since := now.Add(-PromoHoldTime)
+	if promo.MaxUses > 0 {
+		var held int
+		db.Model(&types.PromoRedemption{}).
+			Where("promo_code_id = ? AND pending AND created_at > ?", promo.ID, since).Count(&held)
+		if promo.Uses+held >= promo.MaxUses {
+			return types.ErrPromoUsedUp
+		}
+	}
+
+	if promo.MaxPerCustomer > 0 {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			return types.ErrPromoNeedsEmail
+		}
+
+		var used int
+		db.Model(&types.PromoRedemption{}).
+			Where("promo_code_id = ? AND LOWER(email) = LOWER(?) AND (NOT pending OR created_at > ?)", promo.ID, email, since).
+			Count(&used)
+		if used >= promo.MaxPerCustomer {
+			return types.ErrPromoCustomer
+		}
+	}
+	return nil
+}
+
+// HoldPromo takes a use of a promo code for a checkout before it is paid,
+// checking the code's limits with it locked so two checkouts can't both
+// take its last use. Codes without limits aren't held and return no hold.
+func HoldPromo(db *gorm.DB, promo *types.PromoCode, email string) (*types.PromoRedemption, error) {
+	if promo.MaxUses <= 0 && promo.MaxPerCustomer <= 0 {
+		return nil, nil
+	}
+
+	tx := db.Begin()
+	var locked types.PromoCode
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&locked, promo.ID).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := locked.Usable(time.Now()); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := promoLimits(tx, &locked, email, time.Now()); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	hold := &types.PromoRedemption{PromoCodeID: promo.ID, MerchantID: promo.MerchantID, Email: email, Pending: true}
+	if err := tx.Create(hold).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return hold, tx.Commit().Error
+}
+
+// LoadHeldPromo looks up the promo code a checkout holds a use of, without
+// counting that use against its limits. A hold that was released is
+// checked like a new use of code.
+func LoadHeldPromo(db *gorm.DB, merchantID string, holdID uint, code, email string) (*types.PromoCode, error) {
+	var hold types.PromoRedemption
+	if db.Where("id = ? AND merchant_id = ?", holdID, merchantID).First(&hold).RecordNotFound() {
+		return LoadPromo(db, merchantID, code, email)
+	}
+
+	var promo types.PromoCode
+	if db.Where("id = ? AND merchant_id = ?", hold.PromoCodeID, merchantID).First(&promo).RecordNotFound() {
+		return nil, types.ErrPromoNotFound
+	}
+	if !promo.Active {
+		return nil, types.ErrPromoNotActive
+	}
+	return &promo, nil
+}
+
+// RedeemPromo records a paid order using a promo code and counts it
+// against the code's limits, turning the checkout's hold into the
+// redemption. Without a hold, or once it was released, the use is only
+// recorded if the code still has one. Redeeming the same order twice, as
+// happens when webhooks are retried, only counts once.
+func RedeemPromo(db *gorm.DB, promo *types.PromoCode, holdID uint, provider, orderID, email string, discount types.Money) error {
+	tx := db.Begin()
+
+	var locked types.PromoCode
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&locked, promo.ID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var n int
+	tx.Model(&types.PromoRedemption{}).Where("provider = ? AND order_id = ? AND NOT pending", provider, orderID).Count(&n)
+	if n > 0 {
+		return tx.Commit().Error
+	}
+
+	var hold types.PromoRedemption
+	if holdID != 0 && !tx.Where("id = ? AND promo_code_id = ? AND pending", holdID, promo.ID).First(&hold).RecordNotFound() {
+		if err := tx.Model(&hold).Updates(map[string]interface{}{
+			"pending": false, "email": email, "provider": provider, "order_id": orderID, "discount": discount,
+		}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	} else {
+		if err := promoLimits(tx, &locked, email, time.Now()); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Create(&types.PromoRedemption{
+			PromoCodeID: promo.ID,
+			MerchantID:  promo.MerchantID,
+			Email:       email,
+			Provider:    provider,
+			OrderID:     orderID,
+			Discount:    discount,
+		}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Model(&locked).UpdateColumn("uses", gorm.Expr("uses + 1")).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	promo.Uses = locked.Uses + 1
+	return tx.Commit().Error
+}
+
+// ReleasePromo gives back the use of a promo code held for a checkout, a
+// hold that was redeemed is left alone
+func ReleasePromo(db *gorm.DB, holdID uint) error {
+	return db.Where("id = ? AND pending", holdID).Delete(&types.PromoRedemption{}).Error
+}
+
+// ReleasePromos gives back the uses held by checkouts abandoned for longer
+// than PromoHoldTime, returning how many there were
+func ReleasePromos(db *gorm.DB, now time.Time) int {
+	res := db.Where("pending AND created_at < ?", now.Add(-PromoHoldTime)).Delete(&types.PromoRedemption{})
+	return int(res.RowsAffected)
+}
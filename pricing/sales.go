@@ -0,0 +1,35 @@
+package pricing
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// SaleTotals is how much staff sold through a channel with a payment method
+// in a period
+type SaleTotals struct {
+	Channel string      `json:"channel"`
+	Method  string      `json:"method"`
+	Orders  int         `json:"orders"`
+	Amount  types.Money `json:"amount"`
+}
+
+// ManualSalesBetween returns the sales staff made between from and to
+func ManualSalesBetween(db *gorm.DB, merchantID string, from, to time.Time) []types.ManualSale {
+	var out []types.ManualSale
+	db.Where("merchant_id = ? AND created_at >= ? AND created_at < ?", merchantID, from, to).
+		Order("created_at").Find(&out)
+	return out
+}
+
+// ManualSaleTotals totals the sales staff made between from and to by
+// channel and payment method
+func ManualSaleTotals(db *gorm.DB, merchantID string, from, to time.Time) []SaleTotals {
+	var out []SaleTotals
+	db.Table("manual_sales").Select("channel, method, COUNT(*) AS orders, SUM(amount) AS amount").
+		Where("merchant_id = ? AND created_at >= ? AND created_at < ?", merchantID, from, to).
+		Group("channel, method").Order("channel, method").Scan(&out)
+	return out
+}
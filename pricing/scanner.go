@@ -0,0 +1,193 @@
+package pricing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// OrderSeats is a ticket line of a paid order, each of its seats gets a
+// boarding pass
+type OrderSeats struct {
+	OrderID  string `json:"orderId"`
+	Sku      string `json:"sku"`
+	Product  string `json:"product"`
+	Payer    string `json:"payer"`
+	Quantity int    `json:"quantity"`
+}
+
+// orderSeatsSQL selects the lines of paid Stripe and PayPal orders
+const orderSeatsSQL = `SELECT li.payment_id AS order_id, li.sku, li.name AS product, pi.name AS payer, li.quantity
+	FROM line_items AS li JOIN payment_intents AS pi ON pi.id = li.payment_id AND pi.acct = li.acct
+	WHERE li.acct = ? AND pi.status = 'succeeded'
+	UNION ALL
+	SELECT it.checkout_id AS order_id, it.sku, it.name AS product,
+		TRIM(COALESCE(p.given_name, '') || ' ' || COALESCE(p.surname, '')) AS payer, it.quantity
+	FROM purchase_items AS it
+		JOIN checkout_orders AS co ON co.id = it.checkout_id
+		JOIN purchase_units AS pu ON pu.checkout_id = co.id
+		LEFT JOIN payers AS p ON p.id = co.payer_id
+	WHERE pu.payee_merchant_id = ? AND co.status != 'REFUNDED'`
+
+func orderSeats(db *gorm.DB, conf *types.MerchantConfig, filter string, args ...interface{}) []OrderSeats {
+	var out []OrderSeats
+	db.Raw("SELECT * FROM ("+orderSeatsSQL+") AS s WHERE "+filter+" ORDER BY order_id, sku",
+		append([]interface{}{conf.StripeKey, conf.ID}, args...)...).Scan(&out)
+	return out
+}
+
+// OrderTickets returns how many seats each ticket sku of a paid order has,
+// which is how many boarding passes it gets
+func OrderTickets(db *gorm.DB, conf *types.MerchantConfig, orderID string) map[string]int {
+	seats := make(map[string]int)
+	for _, line := range orderSeats(db, conf, "order_id = ? AND sku ~ '^\\d+[A-Z]+\\d{10}'", orderID) {
+		seats[line.Sku] += line.Quantity
+	}
+	return seats
+}
+
+// ResolvePassCode finds the seat a boarding pass is for, which is false if
+// it isn't a seat of a paid order. Passes printed before their trip was
+// moved to a new time are for the seat at the time it was moved to.
+func ResolvePassCode(db *gorm.DB, conf *types.MerchantConfig, code string) (string, string, int, bool) {
+	orderID, sku, seat, ok := types.ParsePassCode(code)
+	if !ok {
+		return "", "", 0, false
+	}
+
+	seats := OrderTickets(db, conf, orderID)
+	if seat <= seats[sku] {
+		return orderID, sku, seat, true
+	}
+
+	info, _ := types.ParseSku(sku)
+	t := movedTo(tripMoves(db, conf.ID, info.ProductID), info.ProductID, info.Time)
+	if t.Equal(info.Time) {
+		return "", "", 0, false
+	}
+	sku = retime(sku, t)
+	return orderID, sku, seat, seat <= seats[sku]
+}
+
+// TripSeats returns the ticket lines of the orders for departures leaving
+// at t
+func TripSeats(db *gorm.DB, conf *types.MerchantConfig, t time.Time) []OrderSeats {
+	return orderSeats(db, conf, "SUBSTRING(sku FROM '^\\d+[A-Z]+(\\d{10})\\d*$') = ?", fmt.Sprint(t.Unix()))
+}
+
+// ScannerPasses lists every seat of the departures leaving at t with what a
+// scanner needs to check them in offline. Signed is whether the passenger
+// can board given the merchant's active waiver, nil if it has none.
+func ScannerPasses(db *gorm.DB, conf *types.MerchantConfig, t time.Time, waiver *types.Waiver) []types.ScannerPass {
+	var list []types.Passenger
+	db.Preload("Signature").Where("merchant_id = ? AND SUBSTRING(sku FROM '^\\d+[A-Z]+(\\d{10})\\d*$') = ?",
+		conf.ID, fmt.Sprint(t.Unix())).Find(&list)
+	known := make(map[string]*types.Passenger, len(list))
+	for idx := range list {
+		p := &list[idx]
+		known[types.PassCode(p.OrderID, p.Sku, p.Seat)] = p
+	}
+
+	moves := tripMoves(db, conf.ID, 0)
+
+	var out []types.ScannerPass
+	for _, line := range TripSeats(db, conf, t) {
+		info, _ := types.ParseSku(line.Sku)
+		oldTimes := movedFrom(moves, info.ProductID, info.Time)
+		for seat := 1; seat <= line.Quantity; seat++ {
+			pass := types.ScannerPass{
+				Code:    types.PassCode(line.OrderID, line.Sku, seat),
+				OrderID: line.OrderID,
+				Sku:     line.Sku,
+				Seat:    seat,
+				Product: line.Product,
+				Payer:   line.Payer,
+				Signed:  waiver == nil,
+			}
+			for _, old := range oldTimes {
+				pass.Aliases = append(pass.Aliases, types.PassCode(line.OrderID, retime(line.Sku, old), seat))
+			}
+			if p, ok := known[pass.Code]; ok {
+				pass.Name, pass.AgeGroup = p.Name, p.AgeGroup
+				pass.CheckedInAt, pass.CheckedInDevice = p.CheckedInAt, p.CheckedInDevice
+				pass.Signed = p.CanBoard(waiver)
+			}
+			out = append(out, pass)
+		}
+	}
+	return out
+}
+
+// SyncCheckIn merges a check in a device recorded offline. Syncing a scan
+// again returns what happened the first time. When two devices checked in
+// the same seat the one scanned first keeps it whichever synced first, the
+// other is a conflict. A passenger who can't board as they haven't signed
+// the active waiver isn't checked in, the scan is unsigned.
+func SyncCheckIn(db *gorm.DB, conf *types.MerchantConfig, deviceID, code string, scannedAt time.Time, waiver *types.Waiver) *types.CheckInScan {
+	scan := types.CheckInScan{MerchantID: conf.ID, DeviceID: deviceID, Code: code, ScannedAt: scannedAt}
+
+	tx := db.Begin()
+	defer tx.Commit()
+
+	// the lock keeps two devices syncing the same seat from both winning,
+	// whichever of its codes they scanned
+	orderID, sku, seat, ok := ResolvePassCode(tx, conf, code)
+	if ok {
+		tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", conf.ID+"/"+types.PassCode(orderID, sku, seat))
+	}
+
+	var prev types.CheckInScan
+	if !tx.Where("merchant_id = ? AND device_id = ? AND code = ? AND scanned_at = ?",
+		conf.ID, deviceID, code, scannedAt).First(&prev).RecordNotFound() {
+		return &prev
+	}
+
+	if !ok {
+		scan.Status = types.ScanInvalid
+		tx.Create(&scan)
+		return &scan
+	}
+
+	var p types.Passenger
+	if tx.Preload("Signature").Where("merchant_id = ? AND order_id = ? AND sku = ? AND seat = ?",
+		conf.ID, orderID, sku, seat).First(&p).RecordNotFound() {
+		p = types.Passenger{MerchantID: conf.ID, OrderID: orderID, Sku: sku, Seat: seat}
+	}
+
+	switch {
+	case p.CheckedInAt == nil && !p.CanBoard(waiver):
+		scan.Status, scan.Warning = types.ScanUnsigned, types.ErrWaiverUnsigned.Error()
+	case p.CheckedInAt == nil:
+		p.CheckedInAt, p.CheckedInDevice = &scannedAt, deviceID
+		if p.ID == 0 {
+			tx.Create(&p)
+		} else {
+			tx.Model(&p).Updates(map[string]interface{}{"checked_in_at": p.CheckedInAt, "checked_in_device": deviceID})
+		}
+		scan.Status = types.ScanCheckedIn
+	case p.CheckedInDevice == deviceID:
+		scan.Status = types.ScanAlready
+		if scannedAt.Before(*p.CheckedInAt) {
+			tx.Model(&p).Update("checked_in_at", &scannedAt)
+		}
+	case scannedAt.Before(*p.CheckedInAt):
+		// the other device synced first but scanned later, so its check in
+		// becomes the conflict
+		at := *p.CheckedInAt
+		scan.Status = types.ScanCheckedIn
+		scan.ConflictDevice, scan.ConflictAt = p.CheckedInDevice, &at
+		tx.Model(&types.CheckInScan{}).
+			Where("merchant_id = ? AND passenger_id = ? AND device_id = ? AND status = ?", conf.ID, p.ID, p.CheckedInDevice, types.ScanCheckedIn).
+			Updates(map[string]interface{}{"status": types.ScanConflict, "conflict_device": deviceID, "conflict_at": &scannedAt})
+		tx.Model(&p).Updates(map[string]interface{}{"checked_in_at": &scannedAt, "checked_in_device": deviceID})
+	default:
+		scan.Status = types.ScanConflict
+		scan.ConflictDevice, scan.ConflictAt = p.CheckedInDevice, p.CheckedInAt
+	}
+
+	scan.PassengerID = p.ID
+	tx.Create(&scan)
+	return &scan
+}
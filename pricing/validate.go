@@ -0,0 +1,433 @@
+package pricing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// Codes for the reasons a cart item can be rejected
+const (
+	ErrInvalidSku      = "invalid_sku"
+	ErrInvalidQuantity = "invalid_quantity"
+	ErrInvalidAmount   = "invalid_amount"
+	ErrUnknownProduct  = "unknown_product"
+	ErrUnpublished     = "unpublished"
+	ErrDeparted        = "departed"
+	ErrNotScheduled    = "not_scheduled"
+	ErrCancelled       = "cancelled"
+	ErrUnknownTicket   = "unknown_ticket"
+	ErrSoldOut         = "sold_out"
+	ErrPriceMismatch   = "price_mismatch"
+	ErrHoldExpired     = "hold_expired"
+	ErrNoTrip          = "no_trip"
+)
+
+// ItemError is why a single item of a cart was rejected
+type ItemError struct {
+	Index   int    `json:"index"`
+	Sku     string `json:"sku"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every problem found with a cart
+type ValidationError struct {
+	Items []ItemError `json:"items"`
+}
+
+func (v *ValidationError) Error() string {
+	msgs := make([]string, 0, len(v.Items))
+	for _, i := range v.Items {
+		msgs = append(msgs, i.Sku+": "+i.Message)
+	}
+	return "invalid cart: " + strings.Join(msgs, "; ")
+}
+
+func (v *ValidationError) add(idx int, sku, code, format string, args ...interface{}) {
+	v.Items = append(v.Items, ItemError{Index: idx, Sku: sku, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+type catalogProduct struct {
+	ID             uint
+	Name           string
+	Publish        bool
+	BoatID         uint
+	Kind           string
+	CharterPrice   types.Money
+	CharterDeposit types.Money
+	MaxGuests      int
+}
+
+type catalogCategory struct {
+	ID         uint
+	Categories postgres.Hstore
+}
+
+type departure struct {
+	info      types.SkuInfo
+	name      string
+	qty       int
+	first     int
+	left      int
+	cancelled bool
+	chartered bool
+	trip      types.Trip
+	// offers are the waitlist offers whose held seats are being used
+	offers map[uint]bool
+}
+
+// useOffer lets the departure's tickets take the seats held for a waitlist
+// offer, counting them once however many of the cart's lines use it
+func (d *departure) useOffer(w *types.WaitlistEntry) {
+	if d.offers == nil {
+		d.offers = make(map[uint]bool)
+	}
+	if !d.offers[w.ID] {
+		d.offers[w.ID] = true
+		d.left += w.Party
+	}
+}
+
+// problem returns the error code and message for why the departure's
+// tickets can't be booked, or an empty code if they can
+func (d *departure) problem() (string, string) {
+	switch {
+	case d.cancelled:
+		return ErrCancelled, fmt.Sprintf("%s on %s has been cancelled", d.name, d.info.Time.Format("Jan 2"))
+	case d.chartered:
+		return ErrCancelled, fmt.Sprintf("the boat for %s on %s has been chartered", d.name, d.info.Time.Format("Jan 2"))
+	case d.qty > d.left:
+		left := d.left
+		if left < 0 {
+			left = 0
+		}
+		return ErrSoldOut, fmt.Sprintf("only %d seats left on %s", left, d.name)
+	}
+	return "", ""
+}
+
+// ValidateCart checks every item of a cart against the merchant's catalog
+// and returns the cart with the names and prices of the tickets replaced
+// by the ones the server knows about, so a modified request can't change
+// what is charged. Ticket prices have the merchant's price rules applied for
+// the trip being booked, and tickets bought with a waitlist offer can use the
+// seats held for it. Add-ons have to be for a trip booked in the same cart.
+// Fee and tax lines are dropped since they are always recalculated by
+// QuoteCart.
+func ValidateCart(db *gorm.DB, conf *types.MerchantConfig, cart []CartItem) ([]CartItem, *ValidationError) {
+	verr := &ValidationError{}
+	out := make([]CartItem, 0, len(cart))
+	deps := make(map[string]*departure)
+	addOns := make(map[string]*addOnLine)
+	charters := make(map[string]bool)
+	now := time.Now()
+	rules := LoadPriceRules(db, conf.ID)
+
+	for idx, item := range cart {
+		switch item.Sku {
+		case FeeSku, TaxSku:
+			continue
+		case GiftCardSku:
+			if item.Quantity <= 0 {
+				verr.add(idx, item.Sku, ErrInvalidQuantity, "quantity must be positive")
+			} else if item.UnitAmount.Value.Cents <= 0 {
+				verr.add(idx, item.Sku, ErrInvalidAmount, "gift cards need a positive amount")
+			} else {
+				item.UnitAmount.Value.Currency = types.DefaultCurrency
+				item.Name = "Gift Card"
+				out = append(out, item)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(item.Sku, types.AddOnPrefix) {
+			if validateAddOn(db, conf, verr, idx, &item, addOns) {
+				out = append(out, item)
+			}
+			continue
+		}
+
+		info, ok := types.ParseSku(item.Sku)
+		if !ok {
+			verr.add(idx, item.Sku, ErrInvalidSku, "not a ticket or gift card")
+			continue
+		}
+		if item.Quantity <= 0 {
+			verr.add(idx, item.Sku, ErrInvalidQuantity, "quantity must be positive")
+			continue
+		}
+
+		var prod catalogProduct
+		if db.Table("products").Select(productColumns).
+			Where("id = ? AND merchant_id = ? AND deleted_at IS NULL", info.ProductID, conf.ID).
+			Scan(&prod).RecordNotFound() || prod.ID == 0 {
+			verr.add(idx, item.Sku, ErrUnknownProduct, "product %d doesn't exist", info.ProductID)
+			continue
+		}
+		if !prod.Publish {
+			verr.add(idx, item.Sku, ErrUnpublished, "%s isn't available for booking", prod.Name)
+			continue
+		}
+		if info.Time.Before(now) {
+			verr.add(idx, item.Sku, ErrDeparted, "%s has already departed", prod.Name)
+			continue
+		}
+
+		if prod.Kind == types.ProductCharter {
+			if validateCharter(db, conf, verr, idx, &item, &prod, info) {
+				charters[fmt.Sprintf("%d@%d", info.ProductID, info.Time.Unix())] = true
+				out = append(out, item)
+			}
+			continue
+		}
+
+		sched, st := findScheduleTime(db, info)
+		if st == nil || !scheduledOn(sched, info.Time) {
+			verr.add(idx, item.Sku, ErrNotScheduled, "%s doesn't run at %s", prod.Name, info.Time.Format("Jan 2, 2006 3:04 PM"))
+			continue
+		}
+
+		price, ticket, ok := ticketPrice(db, conf, st.Price, info.Ticket)
+		if !ok {
+			verr.add(idx, item.Sku, ErrUnknownTicket, "%s has no %s tickets", prod.Name, strings.ToLower(info.Ticket))
+			continue
+		}
+
+		key := fmt.Sprintf("%d@%d", info.ProductID, info.Time.Unix())
+		d, ok := deps[key]
+		if ok {
+			d.qty += item.Quantity
+		} else {
+			left, capacity, cancelled := seatsLeft(db, conf, info, sched, prod.BoatID)
+			d = &departure{info: info, name: prod.Name, qty: item.Quantity, first: idx, left: left, cancelled: cancelled}
+			d.chartered = len(boatCharters(db, conf.ID, prod.BoatID, info.Time, tripEnd(info.Time, st))) > 0
+			d.trip = types.Trip{ProductID: info.ProductID, Departure: info.Time, BookedAt: now, Occupancy: occupancy(left, capacity)}
+			deps[key] = d
+		}
+
+		if info.Ref != 0 {
+			w, ok := validateOffer(db, conf, verr, idx, &item, info)
+			if !ok {
+				continue
+			}
+			d.useOffer(w)
+		}
+
+		price, _ = AdjustPrice(rules, d.trip, price)
+		item.Name = prod.Name + " - " + ticket
+		item.Desc = info.Time.Format("Mon Jan 2, 2006 3:04 PM")
+		item.UnitAmount = types.Amount{Value: price, CurrencyCode: price.CurrencyCode()}
+		out = append(out, item)
+	}
+
+	for _, d := range deps {
+		if code, msg := d.problem(); code != "" {
+			verr.add(d.first, cart[d.first].Sku, code, "%s", msg)
+		}
+	}
+
+	for sku, l := range addOns {
+		if _, ok := deps[l.trip]; !ok && !charters[l.trip] {
+			verr.add(l.first, sku, ErrNoTrip, "%s has to be booked with a trip", l.name)
+		} else if l.inventory > 0 {
+			if left := l.inventory - addOnsSold(db, conf, sku); l.qty > left {
+				if left < 0 {
+					left = 0
+				}
+				verr.add(l.first, sku, ErrSoldOut, "only %d %s left", left, l.name)
+			}
+		}
+	}
+
+	if len(verr.Items) > 0 {
+		return nil, verr
+	}
+	return out, nil
+}
+
+// scheduledOn checks the schedule runs on the day of a departure, Days are
+// the weekdays it runs (0 is Sunday), Recur a rule the day has to match and
+// NotAvail the dates it doesn't.
+func scheduledOn(s *types.Schedule, t time.Time) bool {
+	if s.Recur != "" {
+		r, err := types.ParseRRule(s.Recur)
+		if err != nil || !r.On(s.Start, t) {
+			return false
+		}
+	}
+
+	if len(s.Days) > 0 {
+		found := false
+		for _, d := range s.Days {
+			if time.Weekday(d) == t.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	day := t.Format("2006-01-02")
+	for _, na := range s.NotAvail {
+		if strings.HasPrefix(na, day) {
+			return false
+		}
+	}
+	return true
+}
+
+// skuTicket is how a ticket category name appears in a sku, uppercased
+// with anything but letters removed
+func skuTicket(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return -1
+	}, strings.ToUpper(name))
+}
+
+// CheckCategories makes sure every name in a ticket category's prices is
+// its own ticket in skus, names which only differ in anything but their
+// letters would be sold as the same ticket.
+func CheckCategories(prices map[string]*string) error {
+	names := make([]string, 0, len(prices))
+	for name := range prices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := make(map[string]string, len(names))
+	for _, name := range names {
+		ticket := skuTicket(name)
+		if ticket == "" {
+			return fmt.Errorf("ticket %q needs a letter in its name", name)
+		}
+		if other, ok := seen[ticket]; ok {
+			return fmt.Errorf("tickets %q and %q need names with different letters", other, name)
+		}
+		seen[ticket] = name
+	}
+	return nil
+}
+
+// ticketPrice looks up the price of a ticket in the TicketCategory a
+// schedule time uses, returning the category's name as it was entered. A
+// ticket more than one name in the category could be isn't sold, rather
+// than picking one of their prices.
+func ticketPrice(db *gorm.DB, conf *types.MerchantConfig, categoryID, ticket string) (types.Money, string, bool) {
+	var cat catalogCategory
+	db.Table("ticket_categories").Select("id, categories").
+		Where("id = ? AND merchant_id = ? AND deleted_at IS NULL", categoryID, conf.ID).Scan(&cat)
+
+	var found string
+	for name, price := range cat.Categories {
+		if price == nil || skuTicket(name) != ticket {
+			continue
+		}
+		if found != "" {
+			return types.Money{}, "", false
+		}
+		found = name
+	}
+	if found == "" {
+		return types.Money{}, "", false
+	}
+
+	m, err := types.ParseMoney(*cat.Categories[found])
+	if err != nil {
+		return types.Money{}, "", false
+	}
+	return m, found, true
+}
+
+// soldSeats counts the seats sold by Stripe and by PayPal on tickets whose
+// skus match a pattern
+func soldSeats(db *gorm.DB, conf *types.MerchantConfig, pattern string) (int, int) {
+	var stripeSold, paypalSold struct{ N int }
+	db.Table("line_items AS li").
+		Joins("JOIN payment_intents AS pi ON pi.id = li.payment_id AND pi.acct = li.acct").
+		Select("COALESCE(SUM(li.quantity), 0) AS n").
+		Where("li.acct = ? AND li.sku ~ ? AND pi.status = 'succeeded'", conf.StripeKey, pattern).
+		Scan(&stripeSold)
+	db.Table("purchase_items AS it").
+		Joins("JOIN purchase_units AS pu ON pu.checkout_id = it.checkout_id").
+		Joins("JOIN checkout_orders AS co ON co.id = it.checkout_id").
+		Select("COALESCE(SUM(it.quantity), 0) AS n").
+		Where("pu.payee_merchant_id = ? AND it.sku ~ ? AND co.status != 'REFUNDED'", conf.ID, pattern).
+		Scan(&paypalSold)
+	return stripeSold.N, paypalSold.N
+}
+
+// seatsLeft returns how many seats can still be sold for a departure, how
+// many it has in all and whether it was cancelled. PayPal orders take their
+// seats off a manual override's avail when they are saved, Stripe orders
+// don't, so only those need counting against it. The seats are also limited
+// by what is left on the boat, which may be shared by other products
+// leaving at the same time. Seats held for waitlist offers aren't left.
+func seatsLeft(db *gorm.DB, conf *types.MerchantConfig, info types.SkuInfo, sched *types.Schedule, boatID uint) (int, int, bool) {
+	type override struct {
+		Cancelled bool
+		Avail     int
+	}
+
+	stripeSold, paypalSold := soldSeats(db, conf, fmt.Sprintf("^%d[A-Z]+%d", info.ProductID, info.Time.Unix()))
+
+	left, capacity, cancelled := int(sched.TicketsAvail)-stripeSold-paypalSold, int(sched.TicketsAvail), false
+
+	var count int
+	var over override
+	db.Table("manual_overrides").Where("product_id = ? AND time = ?", info.ProductID, info.Time).Count(&count)
+	if count > 0 {
+		db.Table("manual_overrides").Select("cancelled, avail").
+			Where("product_id = ? AND time = ?", info.ProductID, info.Time).Scan(&over)
+		left, capacity, cancelled = over.Avail-stripeSold, over.Avail+paypalSold, over.Cancelled
+	}
+
+	if boatLeft, ok := boatSeatsLeft(db, conf, boatID, info.Time); ok && boatLeft < left {
+		left = boatLeft
+	}
+	return left - heldSeats(db, info.ProductID, info.Time, time.Now()), capacity, cancelled
+}
+
+// ValidateOrder checks an order built by the front end, such as a PayPal
+// order, against the catalog. Every item must have the server's price and
+// the total must be what the server would charge, which is returned.
+func ValidateOrder(db *gorm.DB, conf *types.MerchantConfig, items []types.PurchaseItem, total types.Money, opts Options) (*Quote, *ValidationError) {
+	cart := CartFromPurchaseItems(items)
+	valid, verr := ValidateCart(db, conf, cart)
+	if verr != nil {
+		return nil, verr
+	}
+
+	verr = &ValidationError{}
+	for idx, item := range cart {
+		if item.Sku == FeeSku || item.Sku == TaxSku || item.Sku == GiftCardSku {
+			continue
+		}
+		for _, v := range valid {
+			if v.Sku == item.Sku && v.UnitAmount.Value.Cents != item.UnitAmount.Value.Cents {
+				verr.add(idx, item.Sku, ErrPriceMismatch, "price should be %s", v.UnitAmount.Value)
+				break
+			}
+		}
+	}
+
+	quote := QuoteCart(db, conf, valid, opts)
+	if quote.Due.Cents != total.Cents {
+		verr.add(-1, "", ErrPriceMismatch, "order total should be %s", quote.Due)
+	}
+
+	if len(verr.Items) > 0 {
+		return nil, verr
+	}
+	return quote, nil
+}
@@ -0,0 +1,89 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func TestSkuTicket(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Adult", "ADULT"},
+		{"Senior 65+", "SENIOR"},
+		{"Adult 1/2 Day", "ADULTDAY"},
+		{"child (under 12)", "CHILDUNDER"},
+		{"12+", ""},
+	}
+
+	for _, tt := range tests {
+		if got := skuTicket(tt.name); got != tt.want {
+			t.Errorf("skuTicket(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCategories(t *testing.T) {
+	price := func(s string) *string { return &s }
+
+	tests := []struct {
+		name    string
+		prices  map[string]*string
+		wantErr bool
+	}{
+		{"different tickets", map[string]*string{"Adult": price("25.00"), "Child": price("15.00")}, false},
+		{"only digits differ", map[string]*string{"Senior 65+": price("20.00"), "Senior": price("22.00")}, true},
+		{"only case differs", map[string]*string{"adult": price("20.00"), "Adult": price("25.00")}, true},
+		{"no letters", map[string]*string{"12+": price("20.00")}, true},
+		{"half and full day", map[string]*string{"Adult Half Day": price("40.00"), "Adult Full Day": price("70.00")}, false},
+		{"none", map[string]*string{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckCategories(tt.prices); (err != nil) != tt.wantErr {
+				t.Errorf("CheckCategories() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDepartureProblem(t *testing.T) {
+	dep := types.SkuInfo{ProductID: 1, Ticket: "ADULT", Time: time.Date(2030, time.July, 4, 8, 0, 0, 0, loc)}
+	offer := func(id uint, party int) *types.WaitlistEntry { return &types.WaitlistEntry{ID: id, Party: party} }
+
+	tests := []struct {
+		name      string
+		qty, left int
+		offers    []*types.WaitlistEntry
+		cancelled bool
+		chartered bool
+		code, msg string
+	}{
+		{name: "seats left", qty: 4, left: 4},
+		{name: "sold out", qty: 5, left: 4, code: ErrSoldOut, msg: "only 4 seats left on Sunset Cruise"},
+		{name: "held seats count as none left", qty: 1, left: -2, code: ErrSoldOut, msg: "only 0 seats left on Sunset Cruise"},
+		{name: "offer's held seats", qty: 3, left: 0, offers: []*types.WaitlistEntry{offer(9, 3)}},
+		{name: "offer used by two lines counts once", qty: 4, left: 0, offers: []*types.WaitlistEntry{offer(9, 3), offer(9, 3)},
+			code: ErrSoldOut, msg: "only 3 seats left on Sunset Cruise"},
+		{name: "two offers", qty: 5, left: 0, offers: []*types.WaitlistEntry{offer(9, 3), offer(10, 2)}},
+		{name: "bigger than the offer", qty: 4, left: -3, offers: []*types.WaitlistEntry{offer(9, 3)},
+			code: ErrSoldOut, msg: "only 0 seats left on Sunset Cruise"},
+		{name: "cancelled", qty: 1, left: 10, cancelled: true, code: ErrCancelled, msg: "Sunset Cruise on Jul 4 has been cancelled"},
+		{name: "chartered", qty: 1, left: 10, chartered: true, code: ErrCancelled, msg: "the boat for Sunset Cruise on Jul 4 has been chartered"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &departure{info: dep, name: "Sunset Cruise", qty: tt.qty, left: tt.left, cancelled: tt.cancelled, chartered: tt.chartered}
+			for _, w := range tt.offers {
+				d.useOffer(w)
+			}
+			if code, msg := d.problem(); code != tt.code || msg != tt.msg {
+				t.Errorf("problem() = %q, %q, want %q, %q", code, msg, tt.code, tt.msg)
+			}
+		})
+	}
+}
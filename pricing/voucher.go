@@ -0,0 +1,272 @@
+package pricing
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// LoadVoucher looks up a merchant's voucher and checks that it can still
+// be spent. An empty code returns no voucher and no error.
+func LoadVoucher(db *gorm.DB, merchantID, code string) (*types.Voucher, error) {
+	code = types.NormalizePromoCode(code)
+	if code == "" {
+		return nil, nil
+	}
+
+	var v types.Voucher
+	if db.Where("merchant_id = ? AND code = ?", merchantID, code).First(&v).RecordNotFound() {
+		return nil, types.ErrVoucherNotFound
+	}
+
+	if err := v.Usable(time.Now()); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// IssueVoucher gives the voucher a new code and a balance of its Amount,
+// and records the issue in its ledger.
+func IssueVoucher(db *gorm.DB, v *types.Voucher, userID string) error {
+	tx := db.Begin()
+
+	var err error
+	for tries := 0; tries < 5; tries++ {
+		if v.Code, err = types.NewVoucherCode(); err != nil {
+			break
+		}
+
+		var n int
+		tx.Model(&types.Voucher{}).Where("code = ?", v.Code).Count(&n)
+		if n == 0 {
+			break
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	v.ID = 0
+	v.Balance = v.Amount
+	if err := tx.Create(v).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	tx.Create(&types.VoucherEntry{
+		VoucherID: v.ID,
+		Kind:      types.VoucherIssue,
+		Amount:    v.Amount,
+		Provider:  v.Provider,
+		OrderID:   v.OrderID,
+		UserID:    userID,
+	})
+	return tx.Commit().Error
+}
+
+// IssueGiftCards creates the gift cards bought with an order, one for each
+// amount. Vouchers already issued for the order are returned instead so
+// that retried webhooks don't issue them twice.
+func IssueGiftCards(db *gorm.DB, merchantID, provider, orderID, email, name string, amounts []types.Money) ([]types.Voucher, error) {
+	var cards []types.Voucher
+	db.Where("provider = ? AND order_id = ? AND kind = ?", provider, orderID, types.VoucherGift).Find(&cards)
+	if len(cards) > 0 {
+		return cards, nil
+	}
+
+	for _, amt := range amounts {
+		v := types.Voucher{
+			MerchantID: merchantID,
+			Kind:       types.VoucherGift,
+			Amount:     amt,
+			ExpiresAt:  giftCardExpiry(),
+			Email:      email,
+			Name:       name,
+			Provider:   provider,
+			OrderID:    orderID,
+		}
+		if err := IssueVoucher(db, &v, ""); err != nil {
+			return cards, err
+		}
+		cards = append(cards, v)
+	}
+	return cards, nil
+}
+
+// gift cards are good for five years, the shortest expiry federal law allows
+func giftCardExpiry() *time.Time {
+	t := time.Now().AddDate(5, 0, 0)
+	return &t
+}
+
+// RedeemVoucher spends amount from the voucher's balance for an order. The
+// balance is checked in the update so that two orders can't both spend
+// the same money, and redeeming for the same order again does nothing.
+func RedeemVoucher(db *gorm.DB, v *types.Voucher, amount types.Money, provider, orderID string) error {
+	if amount.Cents <= 0 {
+		return nil
+	}
+
+	tx := db.Begin()
+
+	var n int
+	tx.Model(&types.VoucherEntry{}).Where("voucher_id = ? AND kind = ? AND provider = ? AND order_id = ?",
+		v.ID, types.VoucherRedeem, provider, orderID).Count(&n)
+	if n > 0 {
+		return tx.Commit().Error
+	}
+
+	res := tx.Model(&types.Voucher{}).Where("id = ? AND balance >= ?", v.ID, amount.Cents).
+		UpdateColumn("balance", gorm.Expr("balance - ?", amount.Cents))
+	if res.Error != nil {
+		tx.Rollback()
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		return types.ErrVoucherBalance
+	}
+
+	tx.Create(&types.VoucherEntry{
+		VoucherID: v.ID,
+		Kind:      types.VoucherRedeem,
+		Amount:    amount.Mul(-1),
+		Provider:  provider,
+		OrderID:   orderID,
+	})
+	v.Balance = v.Balance.Sub(amount)
+	return tx.Commit().Error
+}
+
+// VoucherHoldTime is how long a checkout that hasn't been paid keeps the
+// voucher money it holds, longer than Stripe checkout sessions last
+const VoucherHoldTime = 25 * time.Hour
+
+// HoldVoucher takes amount off a voucher's balance for a checkout before it
+// is paid for, with the voucher locked so that two checkouts can't spend
+// the same money. The hold is redeemed by RedeemHold once the order is
+// paid or given back by ReleaseHold. No amount needs no hold.
+func HoldVoucher(db *gorm.DB, v *types.Voucher, amount types.Money) (*types.VoucherEntry, error) {
+	if amount.Cents <= 0 {
+		return nil, nil
+	}
+
+	tx := db.Begin()
+	var locked types.Voucher
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&locked, v.ID).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if locked.Balance.Cents < amount.Cents {
+		tx.Rollback()
+		return nil, types.ErrVoucherBalance
+	}
+
+	hold := &types.VoucherEntry{VoucherID: v.ID, Kind: types.VoucherHold, Amount: amount.Mul(-1)}
+	if err := tx.Model(&locked).UpdateColumn("balance", gorm.Expr("balance - ?", amount.Cents)).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Create(hold).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	v.Balance = locked.Balance.Sub(amount)
+	return hold, nil
+}
+
+// LoadHeldVoucher looks up the voucher a hold is on with the held money
+// back on its balance, as it was when the checkout was quoted.
+func LoadHeldVoucher(db *gorm.DB, merchantID string, holdID uint) (*types.Voucher, error) {
+	var hold types.VoucherEntry
+	if db.Where("id = ? AND kind IN (?)", holdID, []string{types.VoucherHold, types.VoucherRedeem}).
+		First(&hold).RecordNotFound() {
+		return nil, types.ErrVoucherHold
+	}
+
+	var v types.Voucher
+	if db.Where("id = ? AND merchant_id = ?", hold.VoucherID, merchantID).First(&v).RecordNotFound() {
+		return nil, types.ErrVoucherNotFound
+	}
+	if v.ExpiresAt != nil && time.Now().After(*v.ExpiresAt) {
+		return nil, types.ErrVoucherExpired
+	}
+	v.Balance = v.Balance.Sub(hold.Amount)
+	return &v, nil
+}
+
+// RedeemHold turns a checkout's hold into the redemption of the order that
+// paid for it, doing nothing if it already was. A hold that was released
+// is redeemed from the balance again if it still covers amount.
+func RedeemHold(db *gorm.DB, v *types.Voucher, holdID uint, amount types.Money, provider, orderID string) error {
+	if holdID == 0 {
+		return RedeemVoucher(db, v, amount, provider, orderID)
+	}
+
+	tx := db.Begin()
+	var hold types.VoucherEntry
+	if tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ? AND voucher_id = ?", holdID, v.ID).
+		First(&hold).RecordNotFound() {
+		tx.Rollback()
+		return RedeemVoucher(db, v, amount, provider, orderID)
+	}
+
+	switch {
+	case hold.Kind == types.VoucherRedeem && hold.Provider == provider && hold.OrderID == orderID:
+		return tx.Commit().Error
+	case hold.Kind != types.VoucherHold:
+		tx.Rollback()
+		return types.ErrVoucherHold
+	}
+
+	if err := tx.Model(&hold).Updates(map[string]interface{}{
+		"kind": types.VoucherRedeem, "provider": provider, "order_id": orderID,
+	}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// ReleaseHold gives the money held for a checkout back to the voucher, a
+// hold that was redeemed or already released is left alone.
+func ReleaseHold(db *gorm.DB, holdID uint) error {
+	tx := db.Begin()
+	var hold types.VoucherEntry
+	if tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ? AND kind = ?", holdID, types.VoucherHold).
+		First(&hold).RecordNotFound() {
+		tx.Rollback()
+		return nil
+	}
+
+	if err := tx.Model(&types.Voucher{}).Where("id = ?", hold.VoucherID).
+		UpdateColumn("balance", gorm.Expr("balance - ?", hold.Amount.Cents)).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(&hold).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// ReleaseHolds gives back the holds of checkouts abandoned for longer than
+// VoucherHoldTime, returning how many there were
+func ReleaseHolds(db *gorm.DB, now time.Time) int {
+	var holds []types.VoucherEntry
+	db.Where("kind = ? AND created_at < ?", types.VoucherHold, now.Add(-VoucherHoldTime)).Find(&holds)
+
+	released := 0
+	for _, h := range holds {
+		if err := ReleaseHold(db, h.ID); err == nil {
+			released++
+		}
+	}
+	return released
+}
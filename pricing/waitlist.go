@@ -0,0 +1,255 @@
+package pricing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// WaitlistRequest is what a customer fills in to join the waitlist for a
+// departure
+type WaitlistRequest struct {
+	ProductID uint      `json:"productId" binding:"required"`
+	Time      time.Time `json:"time" binding:"required"`
+	Party     int       `json:"party" binding:"required"`
+	Name      string    `json:"name" binding:"required"`
+	Email     string    `json:"email" binding:"required"`
+	Phone     string    `json:"phone"`
+}
+
+// WaitingDeparture is a departure which has people waiting for seats
+type WaitingDeparture struct {
+	MerchantID string
+	ProductID  uint
+	Time       time.Time
+}
+
+// lockDeparture keeps two offers from being made for the same seats
+func lockDeparture(tx *gorm.DB, productID uint, t time.Time) {
+	tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", fmt.Sprintf("waitlist:%d@%d", productID, t.Unix()))
+}
+
+// heldSeats is how many seats on a departure are held by waitlist offers
+func heldSeats(db *gorm.DB, productID uint, t, now time.Time) int {
+	var held struct{ N int }
+	db.Table("waitlist_entries").Select("COALESCE(SUM(party), 0) AS n").
+		Where("product_id = ? AND time = ? AND status = ? AND offer_until > ?",
+			productID, t, types.WaitlistOffered, now).
+		Scan(&held)
+	return held.N
+}
+
+// JoinWaitlist puts a customer at the end of the waitlist for a departure,
+// which has to be too full for their party to book.
+func JoinWaitlist(db *gorm.DB, conf *types.MerchantConfig, req *WaitlistRequest, payURL string) (*types.WaitlistEntry, error) {
+	if req.Party <= 0 {
+		return nil, types.ErrWaitlistParty
+	}
+
+	var prod catalogProduct
+	db.Table("products").Select(productColumns).
+		Where("id = ? AND merchant_id = ? AND deleted_at IS NULL", req.ProductID, conf.ID).Scan(&prod)
+	if prod.ID == 0 || !prod.Publish || prod.Kind == types.ProductCharter {
+		return nil, ErrTripNotScheduled
+	}
+
+	info := types.SkuInfo{ProductID: prod.ID, Time: req.Time.In(loc)}
+	if info.Time.Before(time.Now()) {
+		return nil, ErrTripDeparted
+	}
+	sched, st := findScheduleTime(db, info)
+	if st == nil || !scheduledOn(sched, info.Time) {
+		return nil, ErrTripNotScheduled
+	}
+	left, _, cancelled := seatsLeft(db, conf, info, sched, prod.BoatID)
+	if cancelled {
+		return nil, ErrTripNotScheduled
+	}
+	if left >= req.Party {
+		return nil, types.ErrWaitlistOpen
+	}
+
+	w := &types.WaitlistEntry{
+		MerchantID: conf.ID,
+		ProductID:  prod.ID,
+		Time:       info.Time,
+		Party:      req.Party,
+		Name:       req.Name,
+		Email:      req.Email,
+		Phone:      req.Phone,
+		Status:     types.WaitlistWaiting,
+		PayURL:     payURL,
+	}
+
+	tx := db.Begin()
+	lockDeparture(tx, w.ProductID, w.Time)
+	var last struct{ N int }
+	tx.Table("waitlist_entries").Select("COALESCE(MAX(position), 0) AS n").
+		Where("product_id = ? AND time = ?", w.ProductID, w.Time).Scan(&last)
+	w.Position = last.N + 1
+	if err := tx.Create(w).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return w, tx.Commit().Error
+}
+
+// OfferSeats offers the seats left on a departure to the people waiting for
+// it in order, skipping any whose party is too big for what is left, and
+// returns the entries which were made an offer so they can be told.
+func OfferSeats(db *gorm.DB, conf *types.MerchantConfig, productID uint, t time.Time) ([]types.WaitlistEntry, error) {
+	now := time.Now()
+	info := types.SkuInfo{ProductID: productID, Time: t.In(loc)}
+	if !info.Time.After(now) {
+		return nil, nil
+	}
+
+	var prod catalogProduct
+	db.Table("products").Select(productColumns).
+		Where("id = ? AND merchant_id = ? AND deleted_at IS NULL", productID, conf.ID).Scan(&prod)
+	if prod.ID == 0 {
+		return nil, nil
+	}
+	sched, st := findScheduleTime(db, info)
+	if st == nil || !scheduledOn(sched, info.Time) {
+		return nil, nil
+	}
+
+	tx := db.Begin()
+	lockDeparture(tx, productID, info.Time)
+
+	left, _, cancelled := seatsLeft(tx, conf, info, sched, prod.BoatID)
+	if cancelled || left <= 0 {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	var waiting []types.WaitlistEntry
+	tx.Where("merchant_id = ? AND product_id = ? AND time = ? AND status = ?",
+		conf.ID, productID, info.Time, types.WaitlistWaiting).
+		Order("position, id").Find(&waiting)
+
+	until := now.Add(types.WaitlistHold)
+	if until.After(info.Time) {
+		until = info.Time
+	}
+
+	var offered []types.WaitlistEntry
+	for _, w := range waiting {
+		if left <= 0 {
+			break
+		}
+		if w.Party > left {
+			continue
+		}
+
+		code, err := types.NewWaitlistCode()
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		w.Status, w.Code, w.OfferedAt, w.OfferUntil = types.WaitlistOffered, code, &now, &until
+		if err := tx.Save(&w).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		left -= w.Party
+		offered = append(offered, w)
+	}
+	return offered, tx.Commit().Error
+}
+
+// ExpireOffers gives up the seats held by offers which weren't taken in time
+func ExpireOffers(db *gorm.DB, now time.Time) int64 {
+	return db.Model(&types.WaitlistEntry{}).
+		Where("status = ? AND offer_until <= ?", types.WaitlistOffered, now).
+		Update("status", types.WaitlistExpired).RowsAffected
+}
+
+// WaitingDepartures returns the departures yet to leave which have people
+// waiting for seats
+func WaitingDepartures(db *gorm.DB, now time.Time) []WaitingDeparture {
+	var out []WaitingDeparture
+	db.Table("waitlist_entries").Select("DISTINCT merchant_id, product_id, time").
+		Where("status = ? AND time > ?", types.WaitlistWaiting, now).
+		Order("time").Scan(&out)
+	return out
+}
+
+// LoadOffer looks up the waitlist entry an offer's code was sent to and
+// checks its seats are still held
+func LoadOffer(db *gorm.DB, merchantID string, code uint) (*types.WaitlistEntry, error) {
+	var w types.WaitlistEntry
+	if code == 0 || db.Where("merchant_id = ? AND code = ?", merchantID, code).
+		Order("id desc").First(&w).RecordNotFound() {
+		return nil, types.ErrWaitlistNotFound
+	}
+	if !w.Holding(time.Now()) {
+		return &w, types.ErrWaitlistExpired
+	}
+	return &w, nil
+}
+
+// BookWaitlist marks the waitlist offers used by an order as booked, even
+// if the hold ran out while it was being paid for
+func BookWaitlist(db *gorm.DB, merchantID, provider, orderID string, skus []string) {
+	for _, sku := range skus {
+		info, ok := types.ParseSku(sku)
+		if !ok || info.Ref == 0 || info.Ticket == types.CharterTicket {
+			continue
+		}
+
+		db.Model(&types.WaitlistEntry{}).
+			Where("merchant_id = ? AND code = ? AND product_id = ? AND time = ? AND status IN (?)",
+				merchantID, info.Ref, info.ProductID, info.Time, []string{types.WaitlistOffered, types.WaitlistExpired}).
+			Updates(map[string]interface{}{
+				"status": types.WaitlistBooked, "provider": provider, "order_id": orderID,
+			})
+	}
+}
+
+// ReorderWaitlist moves the entries of a departure's waitlist into the order
+// of ids, anyone left out keeps their place after them
+func ReorderWaitlist(db *gorm.DB, merchantID string, productID uint, t time.Time, ids []uint) error {
+	tx := db.Begin()
+	lockDeparture(tx, productID, t)
+
+	var entries []types.WaitlistEntry
+	tx.Where("merchant_id = ? AND product_id = ? AND time = ?", merchantID, productID, t).
+		Order("position, id").Find(&entries)
+
+	pos := make(map[uint]int, len(ids))
+	for i, id := range ids {
+		pos[id] = i + 1
+	}
+	next := len(ids)
+	for _, w := range entries {
+		p, ok := pos[w.ID]
+		if !ok {
+			next++
+			p = next
+		}
+		if err := tx.Model(&w).Update("position", p).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// validateOffer checks a ticket bought with a waitlist offer matches the
+// departure the offer was for and is still held, returning the offer
+func validateOffer(db *gorm.DB, conf *types.MerchantConfig, verr *ValidationError, idx int, item *CartItem, info types.SkuInfo) (*types.WaitlistEntry, bool) {
+	w, err := LoadOffer(db, conf.ID, info.Ref)
+	switch {
+	case err == types.ErrWaitlistNotFound || (w != nil && (w.ProductID != info.ProductID || !w.Time.Equal(info.Time))):
+		verr.add(idx, item.Sku, ErrNotScheduled, "%s", types.ErrWaitlistNotFound)
+		return nil, false
+	case err != nil:
+		verr.add(idx, item.Sku, ErrHoldExpired, "%s", err)
+		return nil, false
+	}
+	return w, true
+}
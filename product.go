@@ -1,11 +1,16 @@
 package main
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/zeroshade/tmsapi/internal"
+	"github.com/zeroshade/tmsapi/pricing"
 	"github.com/zeroshade/tmsapi/types"
 )
 
@@ -25,6 +30,13 @@ type Boat struct {
 	Name       string `json:"name"`
 	Color      string `json:"color"`
 	MerchantID string `json:"-" gorm:"type:varchar;not null;primary_key;"`
+	// Capacity is the most passengers the boat can take on one departure
+	// across all products using it, 0 leaves it up to each schedule
+	Capacity int `json:"capacity"`
+	// CrewRequired is how many crew have to be assigned to a departure on
+	// the boat, manifests warn about departures with fewer
+	CrewRequired int    `json:"crewRequired"`
+	Registration string `json:"registration"`
 }
 
 func getBoats(db *gorm.DB) gin.HandlerFunc {
@@ -44,7 +56,11 @@ func modifyBoat(db *gorm.DB) gin.HandlerFunc {
 		}
 		boat.MerchantID = c.Param("merchantid")
 
+		var old Boat
+		db.Find(&old, "id = ? AND merchant_id = ?", boat.ID, boat.MerchantID)
+
 		db.Save(&boat)
+		recordChange(c, "boat", boat.ID, &old, &boat)
 		c.Status(http.StatusOK)
 	}
 }
@@ -59,6 +75,7 @@ func createBoat(db *gorm.DB) gin.HandlerFunc {
 
 		boat.MerchantID = c.Param("merchantid")
 		db.Create(&boat)
+		recordChange(c, "boat", boat.ID, nil, &boat)
 		c.Status(http.StatusOK)
 	}
 }
@@ -72,7 +89,12 @@ func deleteBoat(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		boat.MerchantID = c.Param("merchantid")
+
+		var old Boat
+		db.Find(&old, "id = ? AND merchant_id = ?", boat.ID, boat.MerchantID)
+
 		db.Delete(&boat)
+		recordChange(c, "boat", boat.ID, &old, nil)
 		c.Status(http.StatusOK)
 	}
 }
@@ -93,6 +115,15 @@ type Product struct {
 	Fish        string           `json:"fish"`
 	Boat        *Boat            `json:"-"`
 	BoatID      uint             `json:"boatId" gorm:"default:1"`
+	// Kind is empty for open boat trips selling seats, or types.ProductCharter
+	// for private charters which book the whole boat at a flat price
+	Kind           string      `json:"kind"`
+	CharterPrice   types.Money `json:"charterPrice" gorm:"type:bigint"`
+	CharterDeposit types.Money `json:"charterDeposit" gorm:"type:bigint"`
+	MaxGuests      int         `json:"maxGuests"`
+	// Extras are the upcoming one-off departures of the product, they're
+	// saved on their own so are only filled in to show them
+	Extras []types.ExtraDeparture `json:"extras" gorm:"-"`
 }
 
 // SaveProduct exports a handler for reading in a product and saving it to the db
@@ -104,17 +135,131 @@ func SaveProduct(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		switch {
+		case inprod.Kind != "" && inprod.Kind != types.ProductCharter:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown product kind " + inprod.Kind})
+			return
+		case inprod.Kind == types.ProductCharter && inprod.CharterPrice.Cents <= 0:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "charters need a price"})
+			return
+		}
+
+		var old *Product
+		if inprod.ID != 0 {
+			old = &Product{}
+			db.Preload("Schedules").Preload("Schedules.TimeArray").
+				Find(old, "id = ? AND merchant_id = ?", inprod.ID, c.Param("merchantid"))
+		}
+
+		// a boat can't be out on two products' trips at once, the
+		// conflicts are only returned as warnings when forced
+		var conflicts []pricing.Conflict
+		if inprod.Kind != types.ProductCharter {
+			boatID := inprod.BoatID
+			if boatID == 0 {
+				boatID = 1
+			}
+			conflicts = pricing.ScheduleConflicts(db, c.Param("merchantid"), inprod.ID, boatID, inprod.Schedules)
+			if len(conflicts) > 0 && c.Query("force") != "true" {
+				c.JSON(http.StatusConflict, gin.H{"error": "schedules overlap other trips on the same boat", "conflicts": conflicts})
+				return
+			}
+		}
+
+		// departures with paid bookings the new schedules drop or move
+		// are refused unless asked to reschedule them
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+		impacts := pricing.ScheduleImpacts(db, &conf, inprod.ID, inprod.Schedules, time.Now())
+		for _, imp := range impacts {
+			// moves that don't fit can't be forced
+			if imp.Conflict != "" {
+				c.JSON(http.StatusConflict, gin.H{"error": "some departures can't be moved to their new times", "impacts": impacts})
+				return
+			}
+		}
+		if len(impacts) > 0 && c.Query("reschedule") != "true" {
+			c.JSON(http.StatusConflict, gin.H{"error": "tickets have been sold for departures these schedules drop or move", "impacts": impacts})
+			return
+		}
+
 		ids := make([]uint, 0, len(inprod.Schedules))
 		for _, s := range inprod.Schedules {
 			ids = append(ids, s.ID)
 		}
-		db.Where("product_id = ?", inprod.ID).Not("id", ids).Delete(types.Schedule{})
 
+		// the product is only saved if all of its trips can be rescheduled
 		inprod.MerchantID = c.Param("merchantid")
-		db.Save(&inprod)
+		tx := db.Begin()
+		if err := tx.Where("product_id = ?", inprod.ID).Not("id", ids).Delete(types.Schedule{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Save(&inprod).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		customers, err := rescheduleTrips(c, tx, &conf, impacts)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not reschedule trips: " + err.Error()})
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		recordChange(c, "product", inprod.ID, old, &inprod)
+
+		for idx, imp := range impacts {
+			for _, cust := range customers[idx] {
+				if err := internal.SendScheduleChangeEmail(apiKey, &conf, cust.Name, cust.Email, inprod.Name, imp.Time, imp.NewTime); err != nil {
+					log.Println("could not send schedule change:", imp.ProductID, imp.Time, cust.Email, err)
+				}
+			}
+		}
+
+		if len(conflicts) > 0 || len(impacts) > 0 {
+			c.JSON(http.StatusOK, gin.H{"conflicts": conflicts, "rescheduled": impacts})
+		}
 	}
 }
 
+// rescheduleTrips moves the bookings of the departures a product's new
+// schedules moved and cancels the ones they dropped, in the transaction the
+// product is saved in. It returns the customers booked on each departure to
+// email once it's committed.
+func rescheduleTrips(c *gin.Context, tx *gorm.DB, conf *types.MerchantConfig, impacts []pricing.ScheduleImpact) ([][]pricing.Customer, error) {
+	out := make([][]pricing.Customer, len(impacts))
+	for idx, imp := range impacts {
+		out[idx] = pricing.TripCustomers(tx, conf, imp.ProductID, imp.Time)
+
+		if imp.NewTime != nil {
+			if err := pricing.MoveBookings(tx, conf, imp.ProductID, imp.Time, *imp.NewTime); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		over := ManualOverride{ProductID: imp.ProductID, Time: imp.Time.In(timeloc), Cancelled: true}
+		var old *ManualOverride
+		var count int
+		tx.Model(&ManualOverride{}).Where("product_id = ? AND time = ?", over.ProductID, over.Time).Count(&count)
+		if count > 0 {
+			old = &ManualOverride{}
+			tx.Find(old, "product_id = ? AND time = ?", over.ProductID, over.Time)
+			over.Avail, over.Price = old.Avail, old.Price
+		}
+		if err := tx.Save(&over).Error; err != nil {
+			return nil, err
+		}
+		recordChange(c, "override", fmt.Sprintf("%d@%d", over.ProductID, over.Time.Unix()), old, &over)
+	}
+	return out, nil
+}
+
 func GetProdEvenDeleted(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var prod Product
@@ -123,17 +268,54 @@ func GetProdEvenDeleted(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// GetProducts lists the merchant's products with their schedules, along
+// with the blackout dates and upcoming extra departures that change when
+// they run
 func GetProducts(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		merchantID := c.Param("merchantid")
+
 		var prods []Product
-		db.Preload("Schedules").Preload("Schedules.TimeArray").Order("name asc").Find(&prods, "merchant_id = ?", c.Param("merchantid"))
+		db.Preload("Schedules").Preload("Schedules.TimeArray").Order("name asc").Find(&prods, "merchant_id = ?", merchantID)
+
+		var blackouts []types.Blackout
+		db.Where("merchant_id = ?", merchantID).Find(&blackouts)
+		var extras []types.ExtraDeparture
+		db.Where("merchant_id = ? AND time >= ?", merchantID, time.Now()).Order("time").Find(&extras)
+
+		for pidx := range prods {
+			p := &prods[pidx]
+			var dates pq.StringArray
+			for _, b := range blackouts {
+				for _, id := range b.ProductIDs {
+					if uint(id) == p.ID {
+						dates = append(dates, b.Dates...)
+					}
+				}
+			}
+			for sidx := range p.Schedules {
+				p.Schedules[sidx].Blackouts = dates
+			}
+
+			p.Extras = make([]types.ExtraDeparture, 0)
+			for _, e := range extras {
+				if e.ProductID == p.ID {
+					p.Extras = append(p.Extras, e)
+				}
+			}
+		}
 		c.JSON(http.StatusOK, prods)
 	}
 }
 
 func DeleteProduct(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		var old Product
+		db.Preload("Schedules").Preload("Schedules.TimeArray").
+			Find(&old, "id = ? AND merchant_id = ?", c.Param("prodid"), c.Param("merchantid"))
+
 		db.Where("id = ? AND merchant_id = ?", c.Param("prodid"), c.Param("merchantid")).Delete(&Product{})
+		recordChange(c, "product", c.Param("prodid"), &old, nil)
 		c.Status(http.StatusOK)
 	}
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func addPromoRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/promos", checkJWT(), GetPromoCodes(db))
+	router.PUT("/promos", checkJWT(), logActionMiddle(db), SavePromoCodes(db))
+	router.DELETE("/promos/:id", checkJWT(), logActionMiddle(db), DeletePromoCode(db))
+	router.GET("/promos/:id/redemptions", checkJWT(), GetPromoRedemptions(db))
+}
+
+// GetPromoCodes returns all of the merchant's promo codes, they aren't
+// public so customers can't go looking for them
+func GetPromoCodes(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var promos []types.PromoCode
+		db.Order("code").Find(&promos, "merchant_id = ?", c.Param("merchantid"))
+		c.JSON(http.StatusOK, promos)
+	}
+}
+
+// SavePromoCodes creates or updates all of the promo codes in the request
+func SavePromoCodes(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var promos []types.PromoCode
+		if err := c.ShouldBindJSON(&promos); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		for idx := range promos {
+			if err := promos[idx].Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if !merchantProduct(db, c.Param("merchantid"), promos[idx].ProductID) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "product not found"})
+				return
+			}
+			// an id has to be one of the merchant's own codes or saving it
+			// would overwrite another merchant's
+			if promos[idx].ID != 0 && db.Where("id = ? AND merchant_id = ?", promos[idx].ID, c.Param("merchantid")).
+				First(&types.PromoCode{}).RecordNotFound() {
+				c.JSON(http.StatusNotFound, gin.H{"error": types.ErrPromoNotFound.Error()})
+				return
+			}
+
+			var n int
+			db.Model(&types.PromoCode{}).Where("merchant_id = ? AND code = ? AND id != ?",
+				c.Param("merchantid"), promos[idx].Code, promos[idx].ID).Count(&n)
+			if n > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "promo code " + promos[idx].Code + " already exists"})
+				return
+			}
+		}
+
+		for _, p := range promos {
+			p.MerchantID = c.Param("merchantid")
+
+			var old *types.PromoCode
+			if p.ID != 0 {
+				old = &types.PromoCode{}
+				db.Find(old, "id = ? AND merchant_id = ?", p.ID, p.MerchantID)
+				// uses are only counted by redemptions
+				p.Uses = old.Uses
+			}
+
+			db.Save(&p)
+			recordChange(c, "promo_code", p.ID, old, &p)
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+func DeletePromoCode(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var old types.PromoCode
+		db.Find(&old, "id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid"))
+
+		db.Where("id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid")).Delete(types.PromoCode{})
+		recordChange(c, "promo_code", c.Param("id"), &old, nil)
+		c.Status(http.StatusOK)
+	}
+}
+
+// GetPromoRedemptions lists the orders which used a promo code
+func GetPromoRedemptions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var out []types.PromoRedemption
+		db.Order("created_at desc").
+			Find(&out, "promo_code_id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid"))
+		c.JSON(http.StatusOK, out)
+	}
+}
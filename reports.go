@@ -6,12 +6,21 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
 )
 
 func addReportRoutes(router *gin.RouterGroup, db *gorm.DB) {
 	router.GET("/reports", GetReports(db))
 	router.PUT("/reports", checkJWT(), logActionMiddle(db), SaveReport(db))
 	router.DELETE("/reports/:id", checkJWT(), DeleteReport(db))
+	router.GET("/reports/platform/:from/:to", checkJWT(), GetPlatformReport(db))
+	router.GET("/reports/tax/:from/:to", checkJWT(), GetTaxReport(db))
+	router.GET("/reports/promos/:from/:to", checkJWT(), GetPromoReport(db))
+	router.GET("/reports/balances", checkJWT(), GetBalanceReport(db))
+	router.GET("/reports/addons/:from/:to", checkJWT(), GetAddOnReport(db))
+	router.GET("/reports/cash/:date", checkJWT(), GetCashReport(db))
+	router.GET("/reports/sales/:from/:to", checkJWT(), GetManualSaleReport(db))
 }
 
 type Report struct {
@@ -53,3 +62,220 @@ func DeleteReport(db *gorm.DB) gin.HandlerFunc {
 		c.Status(http.StatusNoContent)
 	}
 }
+
+// PlatformTotals sums up the orders for a period so that the platform
+// invoice for a merchant can be generated
+type PlatformTotals struct {
+	Orders     uint        `json:"orders"`
+	Total      types.Money `json:"total"`
+	Fees       types.Money `json:"fees"`
+	Discount   types.Money `json:"discount"`
+	Commission types.Money `json:"commission"`
+}
+
+// GetPlatformReport totals the fees and platform commission of the orders
+// between the from and to dates (inclusive, YYYY-MM-DD) for each provider
+func GetPlatformReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := time.ParseInLocation("2006-01-02", c.Param("from"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := time.ParseInLocation("2006-01-02", c.Param("to"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to = to.AddDate(0, 0, 1)
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		var stripeTotals PlatformTotals
+		db.Table("payment_intents").
+			Select("COUNT(*) AS orders, COALESCE(SUM(amount), 0) AS total, COALESCE(SUM(fees), 0) AS fees, COALESCE(SUM(discount), 0) AS discount, COALESCE(SUM(commission), 0) AS commission").
+			Where("acct = ? AND status = 'succeeded' AND created_at >= ? AND created_at < ?", conf.StripeKey, from, to).
+			Scan(&stripeTotals)
+
+		var paypalTotals PlatformTotals
+		db.Table("checkout_orders AS co").
+			Joins("LEFT JOIN purchase_units AS pu ON pu.checkout_id = co.id").
+			Select("COUNT(*) AS orders, COALESCE(SUM(pu.value), 0) AS total, COALESCE(SUM(co.fees), 0) AS fees, COALESCE(SUM(co.discount), 0) AS discount, COALESCE(SUM(co.commission), 0) AS commission").
+			Where("pu.payee_merchant_id = ? AND co.status != 'REFUNDED' AND co.create_time >= ? AND co.create_time < ?", conf.ID, from, to).
+			Scan(&paypalTotals)
+
+		c.JSON(http.StatusOK, gin.H{"stripe": stripeTotals, "paypal": paypalTotals})
+	}
+}
+
+// TaxTotals is the tax collected by a provider during one period
+type TaxTotals struct {
+	Period   time.Time   `json:"period"`
+	Provider string      `json:"provider"`
+	Taxable  types.Money `json:"taxable"`
+	Tax      types.Money `json:"tax"`
+}
+
+// GetTaxReport returns the sales tax liability between the from and to
+// dates (inclusive, YYYY-MM-DD), grouped by the period given in the query
+// (day, week, month or quarter, defaulting to month).
+func GetTaxReport(db *gorm.DB) gin.HandlerFunc {
+	periods := map[string]bool{"day": true, "week": true, "month": true, "quarter": true}
+
+	return func(c *gin.Context) {
+		from, err := time.ParseInLocation("2006-01-02", c.Param("from"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := time.ParseInLocation("2006-01-02", c.Param("to"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to = to.AddDate(0, 0, 1)
+
+		period := c.DefaultQuery("period", "month")
+		if !periods[period] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid period " + period})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		var rows []TaxTotals
+		db.Raw(`SELECT date_trunc(?, pi.created_at) AS period, 'stripe' AS provider,
+				SUM(li.amount) AS taxable, SUM(li.tax) AS tax
+			FROM line_items AS li JOIN payment_intents AS pi ON pi.id = li.payment_id AND pi.acct = li.acct
+			WHERE li.acct = ? AND li.tax > 0 AND pi.status = 'succeeded' AND pi.created_at >= ? AND pi.created_at < ?
+			GROUP BY 1
+			UNION ALL
+			SELECT date_trunc(?, co.create_time) AS period, 'paypal' AS provider,
+				SUM(it.value * it.quantity) AS taxable, SUM(it.tax_value * it.quantity) AS tax
+			FROM purchase_items AS it
+				JOIN checkout_orders AS co ON co.id = it.checkout_id
+				JOIN purchase_units AS pu ON pu.checkout_id = co.id
+			WHERE pu.payee_merchant_id = ? AND it.tax_value > 0 AND co.status != 'REFUNDED' AND co.create_time >= ? AND co.create_time < ?
+			GROUP BY 1
+			ORDER BY period, provider`,
+			period, conf.StripeKey, from, to, period, conf.ID, from, to).Scan(&rows)
+
+		c.JSON(http.StatusOK, rows)
+	}
+}
+
+// PromoTotals is how much a promo code was used during a period
+type PromoTotals struct {
+	Code     string      `json:"code"`
+	Provider string      `json:"provider"`
+	Uses     uint        `json:"uses"`
+	Discount types.Money `json:"discount"`
+}
+
+// GetPromoReport totals the discounts given by each promo code between the
+// from and to dates (inclusive, YYYY-MM-DD)
+func GetPromoReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := time.ParseInLocation("2006-01-02", c.Param("from"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := time.ParseInLocation("2006-01-02", c.Param("to"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to = to.AddDate(0, 0, 1)
+
+		var rows []PromoTotals
+		db.Table("promo_redemptions AS r").
+			Joins("JOIN promo_codes AS p ON p.id = r.promo_code_id").
+			Select("p.code, r.provider, COUNT(*) AS uses, SUM(r.discount) AS discount").
+			Where("r.merchant_id = ? AND r.created_at >= ? AND r.created_at < ?", c.Param("merchantid"), from, to).
+			Group("p.code, r.provider").Order("p.code, r.provider").
+			Scan(&rows)
+
+		c.JSON(http.StatusOK, rows)
+	}
+}
+
+// BalanceTotals is how much is owed on bookings made with a deposit
+type BalanceTotals struct {
+	Status   string      `json:"status"`
+	Provider string      `json:"provider"`
+	Count    uint        `json:"count"`
+	Amount   types.Money `json:"amount"`
+}
+
+// GetBalanceReport totals the merchant's balances due by status, so open and
+// overdue are what is still outstanding
+func GetBalanceReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rows []BalanceTotals
+		db.Table("balance_dues").
+			Select("status, provider, COUNT(*) AS count, SUM(amount) AS amount").
+			Where("merchant_id = ?", c.Param("merchantid")).
+			Group("status, provider").Order("status, provider").
+			Scan(&rows)
+
+		c.JSON(http.StatusOK, rows)
+	}
+}
+
+// GetAddOnReport totals the add-ons sold between the from and to dates
+// (inclusive, YYYY-MM-DD), which aren't counted as tickets
+func GetAddOnReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := time.ParseInLocation("2006-01-02", c.Param("from"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := time.ParseInLocation("2006-01-02", c.Param("to"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+		c.JSON(http.StatusOK, pricing.AddOnSalesBetween(db, &conf, from, to.AddDate(0, 0, 1)))
+	}
+}
+
+// GetCashReport reconciles the cash handled on the boats on a date
+// (YYYY-MM-DD), such as dock sales and pool buy ins and payouts
+func GetCashReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		day, err := time.ParseInLocation("2006-01-02", c.Param("date"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, pricing.DayCash(db, c.Param("merchantid"), day))
+	}
+}
+
+// GetManualSaleReport totals the sales staff made at the dock and over the
+// phone between the from and to dates (inclusive, YYYY-MM-DD) by payment
+// method
+func GetManualSaleReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := time.ParseInLocation("2006-01-02", c.Param("from"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := time.ParseInLocation("2006-01-02", c.Param("to"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, pricing.ManualSaleTotals(db, c.Param("merchantid"), from, to.AddDate(0, 0, 1)))
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func addSaleRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/sales/:from/:to", checkJWT(), GetManualSales(db))
+	router.POST("/sales", checkJWT(), logActionMiddle(db), ManualSale(db))
+}
+
+// GetManualSales lists the sales staff made between the from and to dates
+// (inclusive, YYYY-MM-DD)
+func GetManualSales(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := time.ParseInLocation("2006-01-02", c.Param("from"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := time.ParseInLocation("2006-01-02", c.Param("to"), loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, pricing.ManualSalesBetween(db, c.Param("merchantid"), from, to.AddDate(0, 0, 1)))
+	}
+}
+
+// ManualSale books a cart sold by staff at the dock or over the phone and
+// paid outside of PayPal and Stripe. Like voucher orders it is stored with
+// the merchant's payment provider's orders so it takes its seats and shows
+// up in manifests, boarding passes and reports like any other.
+func ManualSale(db *gorm.DB) gin.HandlerFunc {
+	type saleReq struct {
+		Cart      []pricing.CartItem `json:"cart" binding:"required"`
+		Promo     string             `json:"promo"`
+		Method    string             `json:"method" binding:"required"`
+		Channel   string             `json:"channel"`
+		Reference string             `json:"reference"`
+		Name      string             `json:"name"`
+		Email     string             `json:"email"`
+		Phone     string             `json:"phone"`
+		Notes     string             `json:"notes"`
+	}
+
+	return func(c *gin.Context) {
+		var req saleReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sale := types.ManualSale{
+			Channel:   req.Channel,
+			Method:    req.Method,
+			Reference: req.Reference,
+			Name:      req.Name,
+			Email:     req.Email,
+			Phone:     req.Phone,
+			Notes:     req.Notes,
+			SoldBy:    c.GetString("user_id"),
+		}
+		if sale.Channel == "" {
+			sale.Channel = types.ChannelDock
+		}
+		if err := sale.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		var (
+			opts pricing.Options
+			err  error
+		)
+		if opts.Promo, err = pricing.LoadPromo(db, conf.ID, req.Promo, req.Email); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		cart, verr := pricing.ValidateCart(db, &conf, req.Cart)
+		if verr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": verr.Error(), "items": verr.Items})
+			return
+		}
+
+		quote := pricing.QuoteCart(db, &conf, cart, opts)
+		promoDiscount := quote.Discount
+		if sale.Method == types.SaleComp {
+			quote.Comp()
+		}
+
+		code, err := types.NewVoucherCode()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		orderID := types.SalePrefix + code
+
+		if opts.Promo != nil && !promoDiscount.IsZero() {
+			if err := pricing.RedeemPromo(db, opts.Promo, 0, conf.PaymentType, orderID, req.Email, promoDiscount); err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		skus := make([]string, 0, len(quote.Lines))
+		for _, line := range quote.Lines {
+			skus = append(skus, line.Sku)
+		}
+		pricing.BookCharters(db, conf.ID, conf.PaymentType, orderID, skus)
+		pricing.BookWaitlist(db, conf.ID, conf.PaymentType, orderID, skus)
+
+		desc := "Sold at the dock, paid by " + sale.Method
+		if sale.Channel == types.ChannelPhone {
+			desc = "Sold over the phone, paid by " + sale.Method
+		}
+
+		var order *types.CheckoutOrder
+		switch conf.PaymentType {
+		case "stripe":
+			saveStripeOrder(db, &conf, orderID, req.Name, req.Email, quote)
+			// there's no Stripe receipt for it, so the customer gets the
+			// same confirmation as a PayPal order
+			order = quoteOrder(&conf, orderID, req.Name, req.Email, desc, quote)
+		default:
+			order = savePaypalOrder(db, &conf, orderID, req.Name, req.Email, desc, quote)
+		}
+
+		sale.MerchantID, sale.OrderID, sale.Provider, sale.Amount = conf.ID, orderID, conf.PaymentType, quote.Due
+		db.Create(&sale)
+		recordChange(c, "manual_sale", sale.ID, nil, &sale)
+
+		if order != nil && req.Email != "" {
+			if _, err := SendClientMail(apiKey, c.Request.Host, req.Email, order, &conf, orderCalendar(db, &conf, order)); err != nil {
+				log.Println("could not send confirmation:", orderID, err)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":     orderID,
+			"sale":   sale,
+			"quote":  quote,
+			"passes": "/info/" + conf.ID + "/passes/" + orderID,
+		})
+	}
+}
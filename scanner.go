@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// maxSyncBatch is the most check ins a scanner can sync at once
+const maxSyncBatch = 500
+
+func addScannerRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/scanner/:timestamp", checkJWT(), ExportScanner(db))
+	router.POST("/scanner/sync", checkJWT(), logActionMiddle(db), SyncScanner(db))
+}
+
+// ExportScanner is everything a scanner needs to check in the departures
+// leaving at a time without a connection: the orders, every valid pass and
+// who has signed the waiver
+func ExportScanner(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ts, err := strconv.ParseInt(c.Param("timestamp"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		t := time.Unix(ts, 0)
+		waiver := activeWaiver(db, conf.ID)
+		c.JSON(http.StatusOK, gin.H{
+			"time":       t,
+			"exportedAt": time.Now(),
+			"waiver":     waiver != nil,
+			"orders":     pricing.TripSeats(db, &conf, t),
+			"passes":     pricing.ScannerPasses(db, &conf, t, waiver),
+			"crew":       pricing.TripCrew(db, conf.ID, t, t.Add(time.Second)),
+		})
+	}
+}
+
+// SyncScanner merges the check ins a scanner recorded while offline and
+// returns what happened to each, syncing the same batch again is safe.
+// Passengers who hadn't signed the waiver aren't checked in and are counted
+// as unsigned so the crew can go find them.
+func SyncScanner(db *gorm.DB) gin.HandlerFunc {
+	type scanReq struct {
+		Code      string    `json:"code" binding:"required"`
+		ScannedAt time.Time `json:"scannedAt" binding:"required"`
+	}
+	type syncReq struct {
+		DeviceID string    `json:"deviceId" binding:"required"`
+		CheckIns []scanReq `json:"checkIns" binding:"required,dive"`
+	}
+
+	return func(c *gin.Context) {
+		var req syncReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(req.CheckIns) > maxSyncBatch {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "too many check ins, sync them in smaller batches"})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+		waiver := activeWaiver(db, conf.ID)
+
+		results := make([]*types.CheckInScan, 0, len(req.CheckIns))
+		conflicts, unsigned := 0, 0
+		for _, s := range req.CheckIns {
+			scan := pricing.SyncCheckIn(db, &conf, req.DeviceID, s.Code, s.ScannedAt.Truncate(time.Second), waiver)
+			switch {
+			case scan.Status == types.ScanUnsigned:
+				unsigned++
+			case scan.Status == types.ScanConflict || scan.ConflictDevice != "":
+				conflicts++
+			}
+			results = append(results, scan)
+		}
+		c.JSON(http.StatusOK, gin.H{"results": results, "conflicts": conflicts, "unsigned": unsigned})
+	}
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 	"github.com/zeroshade/tmsapi/paypal"
+	"github.com/zeroshade/tmsapi/pricing"
 	"github.com/zeroshade/tmsapi/stripe"
 	"github.com/zeroshade/tmsapi/types"
 )
@@ -22,13 +24,17 @@ func addScheduleRoutes(router *gin.RouterGroup, db *gorm.DB) {
 	router.PUT("/override", checkJWT(), logActionMiddle(db), saveOverride(db))
 	router.GET("/override/:date", checkJWT(), getOverrides(db))
 	router.GET("/overrides/:from/:to", getOverrideRange(db))
+	router.POST("/overrides/bulk", checkJWT(), logActionMiddle(db), bulkOverride(db))
 }
 
+// ManualOverride changes a single departure, Price is the id of the ticket
+// category it is sold at instead of the schedule's
 type ManualOverride struct {
 	ProductID uint      `json:"pid" gorm:"primary_key"`
 	Time      time.Time `json:"time" gorm:"primary_key"`
 	Cancelled bool      `json:"cancelled"`
 	Avail     int       `json:"avail"`
+	Price     string    `json:"price"`
 }
 
 func getOverrideRange(db *gorm.DB) gin.HandlerFunc {
@@ -53,16 +59,115 @@ func getOverrides(db *gorm.DB) gin.HandlerFunc {
 }
 
 func saveOverride(db *gorm.DB) gin.HandlerFunc {
+	// Price is the id of the ticket category to charge, "" goes back to
+	// the schedule's and leaving it out keeps the one the trip has now
+	type overrideReq struct {
+		ManualOverride
+		Price *string `json:"price"`
+	}
+
 	return func(c *gin.Context) {
-		var over ManualOverride
-		if err := c.ShouldBindJSON(&over); err != nil {
+		var req overrideReq
+		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		over := req.ManualOverride
 		over.Time = over.Time.In(timeloc)
+		if req.Price != nil {
+			over.Price = *req.Price
+		}
+
+		var old *ManualOverride
+		var count int
+		db.Model(&ManualOverride{}).Where("product_id = ? AND time = ?", over.ProductID, over.Time).Count(&count)
+		if count > 0 {
+			old = &ManualOverride{}
+			db.Find(old, "product_id = ? AND time = ?", over.ProductID, over.Time)
+			if req.Price == nil {
+				over.Price = old.Price
+			}
+		}
 
 		db.Save(&over)
+		recordChange(c, "override", fmt.Sprintf("%d@%d", over.ProductID, over.Time.Unix()), old, &over)
+
+		if !over.Cancelled && (old == nil || over.Avail > old.Avail) {
+			var conf types.MerchantConfig
+			db.Find(&conf, "id = ?", c.Param("merchantid"))
+			offerWaitlist(db, &conf, over.ProductID, over.Time)
+		}
+	}
+}
+
+// bulkOverride applies a capacity, cancellation or price change to every
+// departure matching a filter in one go. With ?dryrun=true nothing is
+// changed, it returns the trips that would be and the tickets sold for them.
+func bulkOverride(db *gorm.DB) gin.HandlerFunc {
+	type bulkResult struct {
+		DryRun   bool               `json:"dryRun"`
+		Trips    []pricing.BulkTrip `json:"trips"`
+		Sold     int                `json:"sold"`
+		Impacted int                `json:"impacted"`
+	}
+
+	return func(c *gin.Context) {
+		var change pricing.BulkChange
+		if err := c.ShouldBindJSON(&change); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		tx := db.Begin()
+		trips, err := pricing.PlanBulk(tx, &conf, &change)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		res := bulkResult{DryRun: c.Query("dryrun") == "true", Trips: trips}
+		for _, t := range trips {
+			res.Sold += t.Sold
+			res.Impacted += t.Impacted
+		}
+		if res.DryRun {
+			tx.Rollback()
+			c.JSON(http.StatusOK, res)
+			return
+		}
+
+		olds := make([]*ManualOverride, len(trips))
+		news := make([]ManualOverride, len(trips))
+		for idx, t := range trips {
+			var old ManualOverride
+			if !tx.Find(&old, "product_id = ? AND time = ?", t.ProductID, t.Time).RecordNotFound() {
+				olds[idx] = &old
+			}
+			news[idx] = ManualOverride{ProductID: t.ProductID, Time: t.Time.In(timeloc), Cancelled: t.NewCancelled, Avail: t.Avail, Price: t.PriceID}
+			if err := tx.Save(&news[idx]).Error; err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		for idx, t := range trips {
+			over := &news[idx]
+			recordChange(c, "override", fmt.Sprintf("%d@%d", over.ProductID, over.Time.Unix()), olds[idx], over)
+			if t.Reopened() {
+				offerWaitlist(db, &conf, over.ProductID, over.Time)
+			}
+		}
+		c.JSON(http.StatusOK, res)
 	}
 }
 
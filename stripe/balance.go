@@ -0,0 +1,58 @@
+package stripe
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/stripe/stripe-go/v71"
+	"github.com/stripe/stripe-go/v71/checkout/session"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// CreateBalanceSession starts a checkout session on the merchant's account
+// for paying off the balance of a booking made with a deposit.
+func CreateBalanceSession(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, err := pricing.LoadBalance(db, c.Param("merchantid"), c.Param("token"))
+		switch err {
+		case nil:
+		case types.ErrBalanceNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		origin := c.Request.Header.Get("x-calendar-origin")
+		params := &stripe.CheckoutSessionParams{
+			PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+			Mode:               stripe.String(string(stripe.CheckoutSessionModePayment)),
+			SuccessURL:         stripe.String(origin + "?status=success&stripe_session_id={CHECKOUT_SESSION_ID}"),
+			CancelURL:          stripe.String(origin + "?status=cancelled&stripe_session_id={CHECKOUT_SESSION_ID}"),
+			LineItems: []*stripe.CheckoutSessionLineItemParams{
+				lineItem("Balance Due", pricing.BalanceSku, b.Amount, 1),
+			},
+			CustomerEmail: stripe.String(b.Email),
+			PaymentIntentData: &stripe.CheckoutSessionPaymentIntentDataParams{
+				ApplicationFeeAmount: stripe.Int64(b.Commission.Min(b.Amount).Cents),
+				Description:          stripe.String("Balance Payment"),
+				Metadata: map[string]string{
+					"balance_token": b.Token,
+					"order":         b.OrderID,
+				},
+			},
+		}
+		params.AddMetadata("balance_token", b.Token)
+		params.SetStripeAccount(c.GetString("stripe_acct"))
+
+		sess, err := session.New(params)
+		if err != nil {
+			c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, createCheckoutSessionResponse{SessionID: sess.ID})
+	}
+}
@@ -70,7 +70,7 @@ type passitem struct {
 	Sku         string
 	Name        string
 	Description string
-	Amount      string `gorm:"type:money"`
+	Amount      types.Money
 }
 
 func (p *passitem) GetName() string   { return p.Name }
@@ -83,7 +83,7 @@ func (h Handler) GetPassItems(config *types.MerchantConfig, db *gorm.DB, id stri
 	var items []passitem
 
 	db.Model(&LineItem{}).
-		Where("payment_id = ? AND sku != ''", id).
+		Where("payment_id = ? AND sku ~ '^\\d+[A-Z]+\\d{10}'", id).
 		Select([]string{"payment_id", "id", "quantity", "sku", "name", "amount",
 			`SUBSTRING(name from '\w* Ticket, [^,]*, (.*)') as description`}).
 		Scan(&items)
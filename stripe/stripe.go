@@ -8,6 +8,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,31 +18,37 @@ import (
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 	"github.com/stripe/stripe-go/v71"
 	"github.com/stripe/stripe-go/v71/checkout/session"
+	"github.com/stripe/stripe-go/v71/coupon"
 	"github.com/stripe/stripe-go/v71/paymentintent"
 	"github.com/zeroshade/tmsapi/internal"
+	"github.com/zeroshade/tmsapi/pricing"
 	"github.com/zeroshade/tmsapi/types"
 )
 
 func AddStripeRoutes(router *gin.RouterGroup, acctHandler gin.HandlerFunc, db *gorm.DB) {
 	router.GET("/stripe/:stripe_session", acctHandler, GetSession(db))
 	router.POST("/stripe", acctHandler, CreateSession(db))
+	router.POST("/stripe/balances/:token", acctHandler, CreateBalanceSession(db))
 }
 
 type createCheckoutSessionResponse struct {
 	SessionID string `json:"id"`
 }
 
-type Money struct {
-	CurrencyCode string  `json:"currency_code"`
-	Value        float32 `json:"value,string"`
-}
-
-type Item struct {
-	Name       string `json:"name"`
-	UnitAmount Money  `json:"unit_amount"`
-	Quantity   int    `json:"quantity,string"`
-	Sku        string `json:"sku"`
-	Desc       string `json:"description"`
+func lineItem(name, sku string, unit types.Money, qty int64) *stripe.CheckoutSessionLineItemParams {
+	return &stripe.CheckoutSessionLineItemParams{
+		PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+			Currency: stripe.String(strings.ToLower(unit.CurrencyCode())),
+			ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+				Name: stripe.String(name),
+				Metadata: map[string]string{
+					"sku": sku,
+				},
+			},
+			UnitAmount: stripe.Int64(unit.Cents),
+		},
+		Quantity: stripe.Int64(qty),
+	}
 }
 
 func init() {
@@ -72,12 +80,41 @@ func CreateSession(db *gorm.DB) gin.HandlerFunc {
 	// }
 
 	return func(c *gin.Context) {
-		var cart []Item
+		var cart []pricing.CartItem
 		if err := c.ShouldBindJSON(&cart); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		cart, verr := pricing.ValidateCart(db, &conf, cart)
+		if verr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": verr.Error(), "items": verr.Items})
+			return
+		}
+
+		email := c.Query("email")
+		promo, err := pricing.LoadPromo(db, conf.ID, c.Query("promo"), email)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		voucher, err := pricing.LoadVoucher(db, conf.ID, c.Query("voucher"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		opts := pricing.Options{Promo: promo, Voucher: voucher, Deposit: c.Query("deposit") == "true"}
+		quote := pricing.QuoteCart(db, &conf, cart, opts)
+		if quote.Due.Cents <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nothing left to pay, check out with the voucher instead"})
+			return
+		}
+
 		params := &stripe.CheckoutSessionParams{
 			PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
 			Mode:               stripe.String(string(stripe.CheckoutSessionModePayment)),
@@ -86,49 +123,113 @@ func CreateSession(db *gorm.DB) gin.HandlerFunc {
 			LineItems:          []*stripe.CheckoutSessionLineItemParams{},
 		}
 
-		total := int64(0)
-		for _, item := range cart {
-			unit := int64(item.UnitAmount.Value * 100)
-			quant := int64(item.Quantity)
-			total += (unit * quant)
-			params.LineItems = append(params.LineItems, &stripe.CheckoutSessionLineItemParams{
-				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-					Currency: stripe.String(string(stripe.CurrencyUSD)),
-					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-						Name: &item.Name,
-						Metadata: map[string]string{
-							"sku": item.Sku,
-						},
-					},
-					UnitAmount: &unit,
-				},
-				Quantity: &quant,
-			})
+		for _, line := range quote.Lines {
+			li := lineItem(line.Name, line.Sku, line.Unit.Sub(line.UnitDiscount), line.Quantity)
+			li.PriceData.ProductData.Metadata["tax"] = strconv.FormatInt(line.UnitTax.Cents, 10)
+			li.PriceData.ProductData.Metadata["discount"] = strconv.FormatInt(line.UnitDiscount.Cents, 10)
+			params.LineItems = append(params.LineItems, li)
 		}
 
-		fee := (total / 5000) * 300
-		if fee > 0 {
-			params.LineItems = append(params.LineItems, &stripe.CheckoutSessionLineItemParams{
-				Quantity: stripe.Int64(1),
-				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-					Currency: stripe.String(string(stripe.CurrencyUSD)),
-					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-						Name: stripe.String("Fees"),
-					},
-					UnitAmount: stripe.Int64(fee),
-				},
-			})
+		for _, fee := range quote.Fees {
+			params.LineItems = append(params.LineItems, lineItem(fee.Name, pricing.FeeSku, fee.Amount, 1))
+		}
+
+		for _, tax := range quote.Taxes {
+			params.LineItems = append(params.LineItems, lineItem(tax.Name, pricing.TaxSku, tax.Amount, 1))
 		}
 
 		params.PaymentIntentData = &stripe.CheckoutSessionPaymentIntentDataParams{
-			ApplicationFeeAmount: stripe.Int64(int64(float64(total) * 0.02)),
+			ApplicationFeeAmount: stripe.Int64(quote.Commission.Min(quote.Due).Cents),
 			Description:          stripe.String("Ticket Purchase"),
+			Metadata: map[string]string{
+				"fees": strconv.FormatInt(quote.FeeTotal.Cents, 10),
+				"tax":  strconv.FormatInt(quote.TaxTotal.Cents, 10),
+			},
+		}
+
+		if promo != nil && !quote.Discount.IsZero() {
+			params.PaymentIntentData.Metadata["promo"] = promo.Code
+			params.PaymentIntentData.Metadata["discount"] = strconv.FormatInt(quote.Discount.Cents, 10)
+		}
+		// the credit and the promo code's use are held before the session
+		// is created so two checkouts can't both spend them, and given back
+		// if it isn't
+		var (
+			hold      *types.VoucherEntry
+			promoHold *types.PromoRedemption
+		)
+		release := func() {
+			if hold != nil {
+				pricing.ReleaseHold(db, hold.ID)
+			}
+			if promoHold != nil {
+				pricing.ReleasePromo(db, promoHold.ID)
+			}
+		}
+		if promo != nil && !quote.Discount.IsZero() {
+			if promoHold, err = pricing.HoldPromo(db, promo, email); err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			if promoHold != nil {
+				params.PaymentIntentData.Metadata["promo_hold"] = strconv.FormatUint(uint64(promoHold.ID), 10)
+			}
+		}
+		if voucher != nil {
+			if hold, err = pricing.HoldVoucher(db, voucher, quote.Credit); err != nil {
+				release()
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if off := quote.Credit.Add(quote.Balance); !off.IsZero() {
+			// checkout sessions can't have negative lines, so the voucher and
+			// the balance left for later are taken off with a single use coupon
+			names := make([]string, 0, 2)
+			if !quote.Credit.IsZero() {
+				names = append(names, "Voucher "+voucher.Code)
+				params.PaymentIntentData.Metadata["voucher"] = voucher.Code
+				params.PaymentIntentData.Metadata["credit"] = strconv.FormatInt(quote.Credit.Cents, 10)
+				if hold != nil {
+					params.PaymentIntentData.Metadata["voucher_hold"] = strconv.FormatUint(uint64(hold.ID), 10)
+				}
+			}
+			if !quote.Balance.IsZero() {
+				names = append(names, "Balance due "+quote.BalanceDue.Format("Jan 2"))
+				params.PaymentIntentData.Metadata["balance"] = strconv.FormatInt(quote.Balance.Cents, 10)
+				params.PaymentIntentData.Metadata["balance_due"] = strconv.FormatInt(quote.BalanceDue.Unix(), 10)
+				params.PaymentIntentData.Metadata["balance_commission"] = strconv.FormatInt(quote.BalanceCommission.Cents, 10)
+				params.PaymentIntentData.Metadata["origin"] = c.Request.Header.Get("x-calendar-origin")
+			}
+
+			cparams := &stripe.CouponParams{
+				AmountOff:      stripe.Int64(off.Cents),
+				Currency:       stripe.String(strings.ToLower(off.CurrencyCode())),
+				Duration:       stripe.String(string(stripe.CouponDurationOnce)),
+				MaxRedemptions: stripe.Int64(1),
+				Name:           stripe.String(strings.Join(names, ", ")),
+			}
+			cparams.SetStripeAccount(c.GetString("stripe_acct"))
+			cp, err := coupon.New(cparams)
+			if err != nil {
+				release()
+				c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
+				return
+			}
+
+			params.AddExtra("discounts[0][coupon]", cp.ID)
+		}
+		if email != "" {
+			// lock the email so per customer promo limits can't be dodged
+			params.CustomerEmail = stripe.String(email)
 		}
 
 		params.SetStripeAccount(c.GetString("stripe_acct"))
 
 		session, err := session.New(params)
 		if err != nil {
+			release()
 			c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
 			return
 		}
@@ -139,13 +240,23 @@ func CreateSession(db *gorm.DB) gin.HandlerFunc {
 }
 
 type PaymentIntent struct {
-	ID        string    `json:"id" gorm:"primary_key"`
-	Acct      string    `json:"-" gorm:"primary_key"`
-	CreatedAt time.Time `json:"createdAt"`
-	Amount    string    `json:"amount" gorm:"type:money"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
-	Status    string    `json:"status"`
+	ID        string      `json:"id" gorm:"primary_key"`
+	Acct      string      `json:"-" gorm:"primary_key"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Amount    types.Money `json:"amount" gorm:"type:bigint"`
+	Fees      types.Money `json:"fees" gorm:"type:bigint"`
+	Tax       types.Money `json:"tax" gorm:"type:bigint"`
+	Discount  types.Money `json:"discount" gorm:"type:bigint"`
+	Promo     string      `json:"promo"`
+	Credit    types.Money `json:"credit" gorm:"type:bigint"`
+	Voucher   string      `json:"voucher"`
+	// Balance is what was left to pay after this deposit
+	Balance types.Money `json:"balance" gorm:"type:bigint"`
+	// Commission is the platform's application fee for this payment
+	Commission types.Money `json:"commission" gorm:"type:bigint"`
+	Email      string      `json:"email"`
+	Name       string      `json:"name"`
+	Status     string      `json:"status"`
 }
 
 type notifyItem struct {
@@ -194,7 +305,27 @@ func sendNotifyEmail(apiKey string, conf *types.MerchantConfig, payment *stripe.
 	return nil
 }
 
-func sendCustomerEmail(apiKey, host string, conf *types.MerchantConfig, payment *stripe.PaymentIntent) error {
+// paymentSkus looks up the skus bought by a payment from its checkout
+// session, the line items may not have been saved yet when it succeeds
+func paymentSkus(acct, paymentID string) []string {
+	params := &stripe.CheckoutSessionListParams{PaymentIntent: stripe.String(paymentID)}
+	params.SetStripeAccount(acct)
+
+	skus := make([]string, 0)
+	sessions := session.List(params)
+	for sessions.Next() {
+		lineParams := &stripe.CheckoutSessionListLineItemsParams{}
+		lineParams.AddExpand("data.price.product")
+		lineParams.SetStripeAccount(acct)
+		i := session.ListLineItems(sessions.CheckoutSession().ID, lineParams)
+		for i.Next() {
+			skus = append(skus, i.LineItem().Price.Product.Metadata["sku"])
+		}
+	}
+	return skus
+}
+
+func sendCustomerEmail(apiKey, host string, conf *types.MerchantConfig, payment *stripe.PaymentIntent, cal *types.Calendar) error {
 	details := payment.Charges.Data[0].BillingDetails
 
 	const tmpl = `
@@ -222,6 +353,7 @@ func sendCustomerEmail(apiKey, host string, conf *types.MerchantConfig, payment
 	content := mail.NewContent("text/html", conf.EmailContent+tpl.String())
 	log.Println("Send Email:", from, subject, to, content)
 	m := mail.NewV3MailInit(from, subject, to, content)
+	internal.AttachCalendar(m, cal)
 	request := sendgrid.GetRequest(apiKey, "/v3/mail/send", "https://api.sendgrid.com")
 	request.Method = "POST"
 	request.Body = mail.GetRequestBody(m)
@@ -233,14 +365,18 @@ func sendCustomerEmail(apiKey, host string, conf *types.MerchantConfig, payment
 }
 
 type LineItem struct {
-	ID        string `json:"id" gorm:"primary_key"`
-	PaymentID string `json:"paymentId" gorm:"primary_key"`
-	Acct      string `json:"-"`
-	Quantity  int    `json:"quantity"`
-	Sku       string `json:"sku"`
-	Name      string `json:"name"`
-	UnitPrice string `json:"unitPrice" gorm:"type:money"`
-	Amount    string `json:"total" gorm:"type:money"`
+	ID        string      `json:"id" gorm:"primary_key"`
+	PaymentID string      `json:"paymentId" gorm:"primary_key"`
+	Acct      string      `json:"-"`
+	Quantity  int         `json:"quantity"`
+	Sku       string      `json:"sku"`
+	Name      string      `json:"name"`
+	UnitPrice types.Money `json:"unitPrice" gorm:"type:bigint"`
+	Amount    types.Money `json:"total" gorm:"type:bigint"`
+	// Tax is the sales tax collected on this line and Discount the promo
+	// discount already taken off the UnitPrice
+	Tax      types.Money `json:"tax" gorm:"type:bigint"`
+	Discount types.Money `json:"discount" gorm:"type:bigint"`
 }
 
 func StripeWebhook(db *gorm.DB) gin.HandlerFunc {
@@ -267,18 +403,101 @@ func StripeWebhook(db *gorm.DB) gin.HandlerFunc {
 			}
 
 			details := paymentIntent.Charges.Data[0].BillingDetails
+			fees, _ := strconv.ParseInt(paymentIntent.Metadata["fees"], 10, 64)
+			tax, _ := strconv.ParseInt(paymentIntent.Metadata["tax"], 10, 64)
+			discount := types.NewMoney(0, string(paymentIntent.Currency))
+			if v, err := strconv.ParseInt(paymentIntent.Metadata["discount"], 10, 64); err == nil {
+				discount.Cents = v
+			}
+			credit := types.NewMoney(0, string(paymentIntent.Currency))
+			if v, err := strconv.ParseInt(paymentIntent.Metadata["credit"], 10, 64); err == nil {
+				credit.Cents = v
+			}
+			balance := types.NewMoney(0, string(paymentIntent.Currency))
+			if v, err := strconv.ParseInt(paymentIntent.Metadata["balance"], 10, 64); err == nil {
+				balance.Cents = v
+			}
 
 			db.Save(&PaymentIntent{
-				ID:        paymentIntent.ID,
-				Acct:      event.Account,
-				CreatedAt: time.Unix(paymentIntent.Created, 0),
-				Amount:    fmt.Sprintf("%0.2f", float64(paymentIntent.Amount)/100.0),
-				Email:     details.Email,
-				Name:      details.Name,
-				Status:    string(paymentIntent.Status),
+				ID:         paymentIntent.ID,
+				Acct:       event.Account,
+				CreatedAt:  time.Unix(paymentIntent.Created, 0),
+				Amount:     types.NewMoney(paymentIntent.Amount, string(paymentIntent.Currency)),
+				Fees:       types.NewMoney(fees, string(paymentIntent.Currency)),
+				Tax:        types.NewMoney(tax, string(paymentIntent.Currency)),
+				Discount:   discount,
+				Promo:      paymentIntent.Metadata["promo"],
+				Credit:     credit,
+				Voucher:    paymentIntent.Metadata["voucher"],
+				Balance:    balance,
+				Commission: types.NewMoney(paymentIntent.ApplicationFeeAmount, string(paymentIntent.Currency)),
+				Email:      details.Email,
+				Name:       details.Name,
+				Status:     string(paymentIntent.Status),
 			})
 
-			err := sendCustomerEmail(apiKey, c.Request.Host, &conf, &paymentIntent)
+			if code := paymentIntent.Metadata["promo"]; code != "" {
+				hold, _ := strconv.ParseUint(paymentIntent.Metadata["promo_hold"], 10, 32)
+				var promo types.PromoCode
+				if db.Where("merchant_id = ? AND code = ?", conf.ID, code).First(&promo).RecordNotFound() {
+					log.Println("promo code not found for payment:", code, paymentIntent.ID)
+				} else if err := pricing.RedeemPromo(db, &promo, uint(hold), "stripe", paymentIntent.ID, details.Email, discount); err != nil {
+					log.Println("could not redeem promo code:", code, paymentIntent.ID, err)
+				}
+			}
+
+			if code := paymentIntent.Metadata["voucher"]; code != "" {
+				hold, _ := strconv.ParseUint(paymentIntent.Metadata["voucher_hold"], 10, 32)
+				var v types.Voucher
+				if db.Where("merchant_id = ? AND code = ?", conf.ID, code).First(&v).RecordNotFound() {
+					log.Println("voucher not found for payment:", code, paymentIntent.ID)
+				} else if err := pricing.RedeemHold(db, &v, uint(hold), credit, "stripe", paymentIntent.ID); err != nil {
+					log.Println("could not redeem voucher:", code, paymentIntent.ID, err)
+				}
+			}
+
+			if token := paymentIntent.Metadata["balance_token"]; token != "" {
+				// paying off a balance, the tickets were already sent
+				// an error lets Stripe retry the webhook, a balance already
+				// paid by this payment is a retry that worked
+				b, err := pricing.LoadBalance(db, conf.ID, token)
+				if err == nil {
+					err = pricing.PayBalance(db, b, paymentIntent.ID)
+				} else if b != nil && b.PaymentID == paymentIntent.ID {
+					err = nil
+				}
+				if err != nil {
+					log.Println("could not pay balance:", token, paymentIntent.ID, err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				c.Status(http.StatusOK)
+				return
+			}
+
+			if !balance.IsZero() {
+				due, _ := strconv.ParseInt(paymentIntent.Metadata["balance_due"], 10, 64)
+				commission, _ := strconv.ParseInt(paymentIntent.Metadata["balance_commission"], 10, 64)
+				b, err := pricing.OpenBalance(db, &types.BalanceDue{
+					MerchantID: conf.ID,
+					Provider:   "stripe",
+					OrderID:    paymentIntent.ID,
+					Email:      details.Email,
+					Name:       details.Name,
+					Amount:     balance,
+					Commission: types.NewMoney(commission, string(paymentIntent.Currency)),
+					DueDate:    time.Unix(due, 0),
+					PayURL:     paymentIntent.Metadata["origin"],
+				})
+				if err != nil {
+					log.Println("could not open balance:", paymentIntent.ID, err)
+				} else if err := internal.SendBalanceEmail(apiKey, &conf, b, false); err != nil {
+					log.Println(err)
+				}
+			}
+
+			cal := pricing.OrderCalendar(db, &conf, paymentIntent.ID, paymentSkus(event.Account, paymentIntent.ID))
+			err := sendCustomerEmail(apiKey, c.Request.Host, &conf, &paymentIntent, cal)
 			if err != nil {
 				c.JSON(http.StatusFailedDependency, gin.H{"err": err.Error()})
 				return
@@ -291,6 +510,9 @@ func StripeWebhook(db *gorm.DB) gin.HandlerFunc {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
+			if sess.Metadata["balance_token"] != "" {
+				break
+			}
 
 			paymentParams := &stripe.PaymentIntentParams{}
 			paymentParams.AddExpand("charges")
@@ -302,6 +524,8 @@ func StripeWebhook(db *gorm.DB) gin.HandlerFunc {
 			}
 
 			itemList := make([]notifyItem, 0)
+			giftCards := make([]types.Money, 0)
+			skus := make([]string, 0)
 
 			params := &stripe.CheckoutSessionListLineItemsParams{}
 			params.AddExpand("data.price")
@@ -310,12 +534,21 @@ func StripeWebhook(db *gorm.DB) gin.HandlerFunc {
 			i := session.ListLineItems(sess.ID, params)
 			for i.Next() {
 				li := i.LineItem()
+				unitTax, _ := strconv.ParseInt(li.Price.Product.Metadata["tax"], 10, 64)
+				unitDiscount, _ := strconv.ParseInt(li.Price.Product.Metadata["discount"], 10, 64)
 
 				itemList = append(itemList, notifyItem{
 					Name:     li.Price.Product.Name,
 					Quantity: int(li.Quantity),
 				})
 
+				skus = append(skus, li.Price.Product.Metadata["sku"])
+				if li.Price.Product.Metadata["sku"] == pricing.GiftCardSku {
+					for n := int64(0); n < li.Quantity; n++ {
+						giftCards = append(giftCards, types.NewMoney(li.Price.UnitAmount, string(li.Price.Currency)))
+					}
+				}
+
 				db.Save(&LineItem{
 					ID:        li.ID,
 					PaymentID: sess.PaymentIntent.ID,
@@ -323,11 +556,26 @@ func StripeWebhook(db *gorm.DB) gin.HandlerFunc {
 					Quantity:  int(li.Quantity),
 					Name:      li.Price.Product.Name,
 					Sku:       li.Price.Product.Metadata["sku"],
-					Amount:    fmt.Sprintf("%0.2f", float64(li.AmountTotal)/100.0),
-					UnitPrice: fmt.Sprintf("%0.2f", float64(li.Price.UnitAmount)/100.0),
+					Amount:    types.NewMoney(li.AmountTotal, string(li.Currency)),
+					UnitPrice: types.NewMoney(li.Price.UnitAmount, string(li.Price.Currency)),
+					Tax:       types.NewMoney(unitTax*li.Quantity, string(li.Currency)),
+					Discount:  types.NewMoney(unitDiscount*li.Quantity, string(li.Currency)),
 				})
 			}
 
+			pricing.BookCharters(db, conf.ID, "stripe", sess.PaymentIntent.ID, skus)
+			pricing.BookWaitlist(db, conf.ID, "stripe", sess.PaymentIntent.ID, skus)
+			if len(giftCards) > 0 && pm != nil {
+				details := pm.Charges.Data[0].BillingDetails
+				cards, err := pricing.IssueGiftCards(db, conf.ID, "stripe", pm.ID, details.Email, details.Name, giftCards)
+				if err != nil {
+					log.Println("could not issue gift cards:", pm.ID, err)
+				}
+				if err := internal.SendVoucherEmail(apiKey, &conf, details.Name, details.Email, cards); err != nil {
+					log.Println(err)
+				}
+			}
+
 			if err := sendNotifyEmail(apiKey, &conf, pm, itemList); err != nil {
 				c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
 				return
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func addTaxRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/taxes", GetTaxRates(db))
+	router.PUT("/taxes", checkJWT(), logActionMiddle(db), SaveTaxRates(db))
+	router.DELETE("/taxes/:id", checkJWT(), logActionMiddle(db), DeleteTaxRate(db))
+}
+
+// GetTaxRates returns the sales tax rates configured for the merchant
+func GetTaxRates(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, pricing.LoadTaxRates(db, c.Param("merchantid")))
+	}
+}
+
+// SaveTaxRates creates or updates all of the tax rates in the request
+func SaveTaxRates(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rates []types.TaxRate
+		if err := c.ShouldBindJSON(&rates); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		for idx := range rates {
+			if err := rates[idx].Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if !merchantProduct(db, c.Param("merchantid"), rates[idx].ProductID) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "product not found"})
+				return
+			}
+			// an id has to be one of the merchant's own rates or saving it
+			// would overwrite another merchant's
+			if rates[idx].ID != 0 && db.Where("id = ? AND merchant_id = ?", rates[idx].ID, c.Param("merchantid")).
+				First(&types.TaxRate{}).RecordNotFound() {
+				c.JSON(http.StatusNotFound, gin.H{"error": "tax rate not found"})
+				return
+			}
+		}
+
+		for _, r := range rates {
+			r.MerchantID = c.Param("merchantid")
+
+			var old *types.TaxRate
+			if r.ID != 0 {
+				old = &types.TaxRate{}
+				db.Find(old, "id = ? AND merchant_id = ?", r.ID, r.MerchantID)
+			}
+
+			db.Save(&r)
+			recordChange(c, "tax_rate", r.ID, old, &r)
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+func DeleteTaxRate(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var old types.TaxRate
+		db.Find(&old, "id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid"))
+
+		db.Where("id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid")).Delete(types.TaxRate{})
+		recordChange(c, "tax_rate", c.Param("id"), &old, nil)
+		c.Status(http.StatusOK)
+	}
+}
+
+// merchantProduct checks an optional product id is one of the merchant's,
+// products are keyed by (id, merchant_id) so tables can't reference them
+func merchantProduct(db *gorm.DB, merchantID string, id *uint) bool {
+	if id == nil {
+		return true
+	}
+	var count int
+	db.Model(&Product{}).Where("id = ? AND merchant_id = ?", *id, merchantID).Count(&count)
+	return count > 0
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/jinzhu/gorm/dialects/postgres"
 	"github.com/zeroshade/tmsapi/paypal"
+	"github.com/zeroshade/tmsapi/pricing"
 	"github.com/zeroshade/tmsapi/stripe"
 	"github.com/zeroshade/tmsapi/types"
 )
@@ -55,13 +56,18 @@ func GetTicketCatEvenDeleted(db *gorm.DB) gin.HandlerFunc {
 
 func DeleteTicketsCat(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		var old TicketCategory
+		db.Find(&old, "id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid"))
+
 		db.Where("id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid")).Delete(TicketCategory{})
+		recordChange(c, "ticket_category", c.Param("id"), &old, nil)
 		c.Status(http.StatusOK)
 	}
 }
 
 // SaveTicketCats returns a function that will update and save/create
-// all ticket categories that came in from a JSON request
+// all ticket categories that came in from a JSON request, refusing all of
+// them if any has two names which would be the same ticket in a sku
 func SaveTicketCats(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var cat []TicketCategory
@@ -70,9 +76,24 @@ func SaveTicketCats(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		for _, ct := range cat {
+			if err := pricing.CheckCategories(ct.Categories); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
 		for _, ct := range cat {
 			ct.MerchantID = c.Param("merchantid")
+
+			var old *TicketCategory
+			if ct.ID != 0 {
+				old = &TicketCategory{}
+				db.Find(old, "id = ? AND merchant_id = ?", ct.ID, ct.MerchantID)
+			}
+
 			db.Save(&ct)
+			recordChange(c, "ticket_category", ct.ID, old, &ct)
 		}
 		c.Status(http.StatusOK)
 	}
@@ -166,7 +187,14 @@ func GetPurchases(db *gorm.DB) gin.HandlerFunc {
 			db.Where("checkout_id = ?", co[idx].ID).Find(&co[idx].PurchaseUnits[0].Items)
 		}
 
-		c.JSON(http.StatusOK, gin.H{"items": ret, "orders": co})
+		var crew []types.CrewAssignment
+		short := make([]pricing.CrewShortage, 0)
+		if day, err := time.ParseInLocation("2006-01-02", c.Param("date"), timeloc); err == nil {
+			crew = pricing.TripCrew(db, c.Param("merchantid"), day, day.AddDate(0, 0, 1))
+			short = pricing.ShortCrewed(db, c.Param("merchantid"), day, day)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"items": ret, "orders": co, "crew": crew, "crewShort": short})
 	}
 }
 
@@ -0,0 +1,61 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// AddOnPrefix starts the sku of an add-on, it can't be confused with a ticket
+// sku so add-ons are never counted as seats or given boarding passes
+const AddOnPrefix = "ADDON-"
+
+var addOnRe = regexp.MustCompile(`^ADDON-(\d+)-(\d{10})$`)
+
+// ErrAddOnPrice is returned when saving an add-on without a price
+var ErrAddOnPrice = errors.New("add-ons need a name and a price")
+
+// AddOn is something extra sold with a trip product, like a rod rental or
+// lunch. Inventory limits how many can be sold for each departure, 0 is
+// unlimited.
+type AddOn struct {
+	ID         uint       `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time  `json:"-"`
+	UpdatedAt  time.Time  `json:"-"`
+	DeletedAt  *time.Time `json:"-"`
+	MerchantID string     `json:"-" gorm:"index"`
+	ProductID  uint       `json:"productId" binding:"required"`
+	Name       string     `json:"name"`
+	Desc       string     `json:"desc"`
+	Price      Money      `json:"price" gorm:"type:bigint"`
+	Inventory  int        `json:"inventory"`
+	Publish    bool       `json:"publish"`
+}
+
+// Validate checks the add-on can be sold
+func (a *AddOn) Validate() error {
+	if a.Name == "" || a.Price.Cents <= 0 {
+		return ErrAddOnPrice
+	}
+	return nil
+}
+
+// AddOnSku is the sku of an add-on bought for the departure at t
+func AddOnSku(addOnID uint, t time.Time) string {
+	return fmt.Sprintf("%s%d-%d", AddOnPrefix, addOnID, t.Unix())
+}
+
+// ParseAddOnSku returns the add-on and departure time of an add-on sku,
+// returning false if it isn't for an add-on
+func ParseAddOnSku(sku string) (uint, time.Time, bool) {
+	res := addOnRe.FindStringSubmatch(sku)
+	if res == nil {
+		return 0, time.Time{}, false
+	}
+
+	id, _ := strconv.ParseUint(res[1], 10, 32)
+	stamp, _ := strconv.ParseInt(res[2], 10, 64)
+	return uint(id), time.Unix(stamp, 0).In(loc), true
+}
@@ -0,0 +1,73 @@
+package types
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// The states of a balance due
+const (
+	BalanceOpen      = "open"
+	BalanceOverdue   = "overdue"
+	BalancePaid      = "paid"
+	BalanceCancelled = "cancelled"
+)
+
+// Errors returned when a balance can't be paid
+var (
+	ErrBalanceNotFound = errors.New("balance not found")
+	ErrBalanceClosed   = errors.New("this balance has already been paid or was cancelled")
+)
+
+// BalanceDue is what is left to pay on an order that was booked with a
+// deposit. The customer pays it through a link containing the Token,
+// which is emailed to them and again as a reminder as the DueDate nears.
+type BalanceDue struct {
+	ID         uint       `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	MerchantID string     `json:"-" gorm:"index"`
+	Token      string     `json:"token" gorm:"unique_index"`
+	Provider   string     `json:"provider"`
+	OrderID    string     `json:"orderId"`
+	Email      string     `json:"email"`
+	Name       string     `json:"name"`
+	Amount     Money      `json:"amount" gorm:"type:bigint"`
+	Commission Money      `json:"-" gorm:"type:bigint"`
+	DueDate    time.Time  `json:"dueDate"`
+	PayURL     string     `json:"-"`
+	Status     string     `json:"status"`
+	PaidAt     *time.Time `json:"paidAt"`
+	PaymentID  string     `json:"paymentId"`
+	RemindedAt *time.Time `json:"remindedAt"`
+	Reminders  int        `json:"reminders"`
+}
+
+// Payable reports whether the balance can still be paid
+func (b *BalanceDue) Payable() bool {
+	return b.Status == BalanceOpen || b.Status == BalanceOverdue
+}
+
+// Link is where the customer pays the balance
+func (b *BalanceDue) Link() string {
+	if b.PayURL == "" {
+		return ""
+	}
+	sep := "?"
+	if strings.Contains(b.PayURL, "?") {
+		sep = "&"
+	}
+	return b.PayURL + sep + "balance=" + b.Token
+}
+
+// NewBalanceToken generates the secret for a balance's payment link
+func NewBalanceToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,70 @@
+package types
+
+import (
+	"errors"
+	"time"
+)
+
+// Errors returned when saving or sending a catch report
+var (
+	ErrCatchNotFound = errors.New("catch report not found")
+	ErrCatchSpecies  = errors.New("every catch needs a species and a count")
+	ErrCatchEmailed  = errors.New("this catch report has already been emailed")
+)
+
+// CatchReport is what was caught on one departure, posted by its captain.
+// Published reports are shown on the public feed.
+type CatchReport struct {
+	ID         uint         `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	UpdatedAt  time.Time    `json:"updatedAt"`
+	MerchantID string       `json:"-" gorm:"index"`
+	ProductID  uint         `json:"productId" binding:"required"`
+	Product    string       `json:"product" gorm:"-"`
+	Time       time.Time    `json:"time" binding:"required"`
+	UserID     string       `json:"-"`
+	Captain    string       `json:"captain"`
+	Notes      string       `json:"notes"`
+	Published  bool         `json:"published"`
+	EmailedAt  *time.Time   `json:"emailedAt"`
+	Catches    []CatchEntry `json:"catches" gorm:"foreignkey:ReportID"`
+	Photos     []CatchPhoto `json:"photos" gorm:"foreignkey:ReportID"`
+}
+
+// Validate checks every catch of the report was filled in
+func (r *CatchReport) Validate() error {
+	for _, c := range r.Catches {
+		if c.Species == "" || c.Count < 0 {
+			return ErrCatchSpecies
+		}
+	}
+	return nil
+}
+
+// Total is how many fish were caught on the trip
+func (r *CatchReport) Total() int {
+	n := 0
+	for _, c := range r.Catches {
+		n += c.Count
+	}
+	return n
+}
+
+// CatchEntry is how many of one species were caught and the largest of them
+type CatchEntry struct {
+	ID         uint    `json:"-" gorm:"primary_key"`
+	ReportID   uint    `json:"-" gorm:"index"`
+	Species    string  `json:"species"`
+	Count      int     `json:"count"`
+	LargestLbs float64 `json:"largestLbs"`
+	LargestBy  string  `json:"largestBy"`
+}
+
+// CatchPhoto is a picture from the trip, URL is where the stored upload is
+// served from
+type CatchPhoto struct {
+	ID       uint   `json:"id" gorm:"primary_key"`
+	ReportID uint   `json:"-" gorm:"index"`
+	URL      string `json:"url"`
+	Caption  string `json:"caption"`
+}
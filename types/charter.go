@@ -0,0 +1,81 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ProductCharter is the kind of product which books a whole boat for a
+// private group instead of selling seats
+const ProductCharter = "charter"
+
+// CharterTicket is the ticket part of a charter's sku
+const CharterTicket = "CHARTER"
+
+// CharterHold is how long a charter is held for a customer to pay for it,
+// it is kept short as a hold takes the whole boat off sale
+const CharterHold = 15 * time.Minute
+
+// MaxCharterHolds is how many unpaid charters one email address or IP
+// address can hold at once
+const MaxCharterHolds = 2
+
+// The states of a charter booking
+const (
+	CharterHeld      = "held"
+	CharterBooked    = "booked"
+	CharterCancelled = "cancelled"
+)
+
+// Errors returned when a charter can't be booked
+var (
+	ErrCharterNotFound  = errors.New("charter booking not found")
+	ErrCharterExpired   = errors.New("the hold on this charter has expired, please book again")
+	ErrCharterConflict  = errors.New("the boat is already booked at that time")
+	ErrCharterHeadcount = errors.New("the group is too large for this charter")
+	ErrCharterHolds     = errors.New("too many charters are already being held, pay for them or wait for the holds to run out")
+)
+
+// Charter is a booking of a whole boat for a block of time by a group. It
+// is held when the group leader fills in their details and booked once it
+// has been paid for.
+type Charter struct {
+	ID          uint       `json:"id" gorm:"primary_key"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	MerchantID  string     `json:"-" gorm:"index"`
+	ProductID   uint       `json:"productId"`
+	BoatID      uint       `json:"boatId"`
+	Start       time.Time  `json:"start"`
+	End         time.Time  `json:"end"`
+	Status      string     `json:"status"`
+	HoldUntil   *time.Time `json:"holdUntil"`
+	HoldIP      string     `json:"-"`
+	LeaderName  string     `json:"leaderName"`
+	LeaderEmail string     `json:"leaderEmail"`
+	LeaderPhone string     `json:"leaderPhone"`
+	Headcount   int        `json:"headcount"`
+	Notes       string     `json:"notes"`
+	Price       Money      `json:"price" gorm:"type:bigint"`
+	Deposit     Money      `json:"deposit" gorm:"type:bigint"`
+	Provider    string     `json:"provider"`
+	OrderID     string     `json:"orderId"`
+}
+
+// Sku is what the charter is added to a cart as, the id on the end is
+// what ties the payment back to the booking.
+func (c *Charter) Sku() string {
+	return fmt.Sprintf("%d%s%d%d", c.ProductID, CharterTicket, c.Start.Unix(), c.ID)
+}
+
+// Active reports whether the charter is taking up its boat
+func (c *Charter) Active(now time.Time) bool {
+	switch c.Status {
+	case CharterBooked:
+		return true
+	case CharterHeld:
+		return c.HoldUntil != nil && now.Before(*c.HoldUntil)
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package types
+
+import (
+	"errors"
+	"time"
+)
+
+// The jobs crew can be assigned to on a departure
+const (
+	CrewCaptain  = "captain"
+	CrewDeckhand = "deckhand"
+)
+
+// Errors returned when crew can't be assigned to a departure
+var (
+	ErrCrewRole     = errors.New("crew must be assigned as a captain or deckhand")
+	ErrCrewConflict = errors.New("that crew member is already assigned to another trip at that time")
+	ErrCrewCaptain  = errors.New("that trip already has a captain")
+)
+
+// CrewAssignment puts a user on a departure as one of its crew. UserID is
+// their Auth0 user id, so it matches the user_id of their login.
+type CrewAssignment struct {
+	ID         uint      `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	MerchantID string    `json:"-" gorm:"index"`
+	UserID     string    `json:"userId" binding:"required"`
+	Name       string    `json:"name"`
+	Role       string    `json:"role" binding:"required"`
+	ProductID  uint      `json:"productId" binding:"required"`
+	BoatID     uint      `json:"boatId"`
+	Start      time.Time `json:"start" binding:"required"`
+	End        time.Time `json:"end"`
+	Notes      string    `json:"notes"`
+}
+
+// Validate checks the assignment is for a known role
+func (a *CrewAssignment) Validate() error {
+	switch a.Role {
+	case CrewCaptain, CrewDeckhand:
+		return nil
+	}
+	return ErrCrewRole
+}
+
+// Hours is how long the assignment is, which is what crew are paid for
+func (a *CrewAssignment) Hours() float64 {
+	return a.End.Sub(a.Start).Hours()
+}
@@ -0,0 +1,85 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// The kinds of booking fee that can be charged
+const (
+	// FeeFlat is a fixed amount per order
+	FeeFlat = "flat"
+	// FeePerTicket is a fixed amount for every ticket in the order
+	FeePerTicket = "per_ticket"
+	// FeePercent is a percentage of the ticket subtotal
+	FeePercent = "percent"
+	// FeeStep charges Amount for every full Step of the ticket subtotal
+	FeeStep = "step"
+	// FeeTiered picks the highest tier the subtotal reaches
+	FeeTiered = "tiered"
+)
+
+// FeeTier is a single bracket of a tiered fee, it applies when the
+// subtotal is at least Over.
+type FeeTier struct {
+	Over    Money `json:"over"`
+	Amount  Money `json:"amount"`
+	Percent int64 `json:"bps"`
+}
+
+// FeeTiers is stored as a json column
+type FeeTiers []FeeTier
+
+func (f FeeTiers) Value() (driver.Value, error) {
+	if f == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(f)
+}
+
+func (f *FeeTiers) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, f)
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	}
+	return fmt.Errorf("fee tiers: cannot scan %T", value)
+}
+
+// FeeRule is a booking fee a merchant charges the customer on top of the
+// ticket prices. Percentages are in basis points, so 250 is 2.5%, and a
+// non-zero Cap limits the fee for a single order.
+type FeeRule struct {
+	ID         uint     `json:"id" gorm:"primary_key"`
+	MerchantID string   `json:"-" gorm:"index"`
+	Name       string   `json:"name"`
+	Kind       string   `json:"kind"`
+	Amount     Money    `json:"amount" gorm:"type:bigint"`
+	Percent    int64    `json:"bps"`
+	Step       Money    `json:"step" gorm:"type:bigint"`
+	Tiers      FeeTiers `json:"tiers" gorm:"type:jsonb"`
+	Cap        Money    `json:"cap" gorm:"type:bigint"`
+}
+
+// Validate checks that the rule has what it needs for its kind
+func (f *FeeRule) Validate() error {
+	switch f.Kind {
+	case FeeFlat, FeePerTicket, FeePercent, FeeTiered:
+	case FeeStep:
+		if f.Step.Cents <= 0 {
+			return fmt.Errorf("fee %q: step fees need a positive step", f.Name)
+		}
+	default:
+		return fmt.Errorf("fee %q: unknown kind %q", f.Name, f.Kind)
+	}
+
+	if f.Amount.Cents < 0 || f.Percent < 0 || f.Cap.Cents < 0 {
+		return fmt.Errorf("fee %q: amounts can't be negative", f.Name)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package types
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const icsTime = "20060102T150405Z"
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// CalendarEvent is a trip on an iCalendar feed
+type CalendarEvent struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+	Cancelled   bool
+}
+
+// Calendar is an RFC 5545 calendar of trips
+type Calendar struct {
+	Name   string
+	Events []CalendarEvent
+}
+
+// icsWriter writes content lines folded at 75 octets and ending in CRLF
+type icsWriter struct {
+	w *bufio.Writer
+}
+
+func (iw icsWriter) line(name, value string) {
+	l := name + ":" + value
+	for len(l) > 75 {
+		cut := 75
+		for cut > 0 && !utf8.RuneStart(l[cut]) {
+			cut--
+		}
+		iw.w.WriteString(l[:cut] + "\r\n")
+		l = " " + l[cut:]
+	}
+	iw.w.WriteString(l + "\r\n")
+}
+
+// WriteICS writes the calendar in iCalendar format
+func (c *Calendar) WriteICS(w io.Writer) error {
+	iw := icsWriter{w: bufio.NewWriter(w)}
+	stamp := time.Now().UTC().Format(icsTime)
+
+	iw.line("BEGIN", "VCALENDAR")
+	iw.line("VERSION", "2.0")
+	iw.line("PRODID", "-//tmsapi//Trips//EN")
+	iw.line("CALSCALE", "GREGORIAN")
+	iw.line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		iw.line("X-WR-CALNAME", icsEscaper.Replace(c.Name))
+	}
+	for _, e := range c.Events {
+		iw.line("BEGIN", "VEVENT")
+		iw.line("UID", e.UID)
+		iw.line("DTSTAMP", stamp)
+		iw.line("DTSTART", e.Start.UTC().Format(icsTime))
+		if e.End.After(e.Start) {
+			iw.line("DTEND", e.End.UTC().Format(icsTime))
+		}
+		iw.line("SUMMARY", icsEscaper.Replace(e.Summary))
+		if e.Description != "" {
+			iw.line("DESCRIPTION", icsEscaper.Replace(e.Description))
+		}
+		if e.Location != "" {
+			iw.line("LOCATION", icsEscaper.Replace(e.Location))
+		}
+		if e.Cancelled {
+			iw.line("STATUS", "CANCELLED")
+		} else {
+			iw.line("STATUS", "CONFIRMED")
+		}
+		iw.line("END", "VEVENT")
+	}
+	iw.line("END", "VCALENDAR")
+	return iw.w.Flush()
+}
+
+// Bytes returns the calendar in iCalendar format
+func (c *Calendar) Bytes() []byte {
+	var buf bytes.Buffer
+	c.WriteICS(&buf)
+	return buf.Bytes()
+}
+
+// CalendarToken is the secret in the URL of a boat's or a crew member's
+// calendar feed, only one of BoatID and UserID is set
+type CalendarToken struct {
+	ID         uint      `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time `json:"createdAt"`
+	MerchantID string    `json:"-" gorm:"index"`
+	Token      string    `json:"token" gorm:"unique_index"`
+	BoatID     uint      `json:"boatId"`
+	UserID     string    `json:"userId"`
+	Name       string    `json:"name"`
+}
+
+// NewCalendarToken generates a random token for a calendar feed
+func NewCalendarToken() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
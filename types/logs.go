@@ -8,8 +8,13 @@ import (
 type LogAction struct {
 	gorm.Model
 	MerchantID string         `gorm:"index" json:"-"`
-	UserID     string         `json:"userId"`
+	UserID     string         `gorm:"index" json:"userId"`
+	UserName   string         `json:"userName"`
 	Method     string         `json:"method"`
 	Url        string         `json:"path"`
 	Payload    postgres.Jsonb `json:"message"`
+	Status     int            `json:"status"`
+	EntityType string         `gorm:"index:log_entity" json:"entityType"`
+	EntityID   string         `gorm:"index:log_entity" json:"entityId"`
+	Diff       postgres.Jsonb `json:"diff"`
 }
@@ -22,4 +22,13 @@ type MerchantConfig struct {
 	TwilioFromNumber string `json:"-"`
 	StripeKey        string `json:"-"`
 	PaymentType      string `json:"-"`
+	// DepositBps is the percent of the tickets, in basis points, paid up
+	// front by groups of at least DepositMinTickets who book with a deposit,
+	// the balance is due BalanceDays before departure
+	DepositBps        int64 `json:"depositBps"`
+	DepositMinTickets int   `json:"depositMinTickets"`
+	BalanceDays       int   `json:"balanceDays" gorm:"default:7"`
+	// CommissionBps is the platform commission taken from each order in
+	// basis points of the ticket subtotal, it's set by us and not the merchant
+	CommissionBps int64 `json:"-" gorm:"default:200"`
 }
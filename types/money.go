@@ -0,0 +1,223 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used for any Money which doesn't specify a currency
+const DefaultCurrency = "USD"
+
+// Money is an amount of currency stored as an integer number of cents so
+// that calculations never lose precision. It is stored in the database as a
+// bigint of cents and marshalled to JSON as a decimal string like "12.50",
+// matching the format used by PayPal and the front end.
+type Money struct {
+	Cents    int64
+	Currency string
+}
+
+// NewMoney returns an amount of cents in the given currency, an empty
+// currency means DefaultCurrency.
+func NewMoney(cents int64, currency string) Money {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return Money{Cents: cents, Currency: strings.ToUpper(currency)}
+}
+
+// ParseMoney parses a decimal amount such as "12.5", "-3.00" or the
+// postgres money output "$1,234.56" into Money.
+func ParseMoney(s string) (Money, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	s = strings.NewReplacer("$", "", ",", "").Replace(s)
+
+	neg := false
+	if strings.HasPrefix(s, "-") {
+		neg = true
+		s = s[1:]
+	} else if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		neg = true
+		s = s[1 : len(s)-1]
+	}
+
+	if s == "" {
+		return Money{}, fmt.Errorf("money: invalid amount %q", orig)
+	}
+
+	whole, frac := s, ""
+	if idx := strings.IndexByte(s, '.'); idx >= 0 {
+		whole, frac = s[:idx], s[idx+1:]
+	}
+	// the only sign allowed is the one taken off the front, strconv would
+	// accept another on either part
+	if (whole == "" && frac == "") || !digits(whole) || !digits(frac) {
+		return Money{}, fmt.Errorf("money: invalid amount %q", orig)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	dollars, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("money: invalid amount %q", orig)
+	}
+
+	// round anything past the cents to the nearest cent
+	roundUp := false
+	if len(frac) > 2 {
+		roundUp = frac[2] >= '5'
+		frac = frac[:2]
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	cents, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("money: invalid amount %q", orig)
+	}
+
+	total := dollars*100 + cents
+	if roundUp {
+		total++
+	}
+	if neg {
+		total = -total
+	}
+	return NewMoney(total, ""), nil
+}
+
+// digits reports whether s is only the digits 0 to 9
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Money) String() string {
+	sign := ""
+	cents := m.Cents
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// CurrencyCode returns the currency of this amount, defaulting to USD
+func (m Money) CurrencyCode() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+func (m Money) IsZero() bool { return m.Cents == 0 }
+
+func (m Money) Add(o Money) Money { return NewMoney(m.Cents+o.Cents, m.Currency) }
+
+func (m Money) Sub(o Money) Money { return NewMoney(m.Cents-o.Cents, m.Currency) }
+
+// Mul multiplies the amount by a quantity
+func (m Money) Mul(qty int64) Money { return NewMoney(m.Cents*qty, m.Currency) }
+
+// Percent returns the given number of basis points (hundredths of a
+// percent) of the amount, rounded half up to the nearest cent.
+func (m Money) Percent(bps int64) Money {
+	return m.Fraction(bps, 10000)
+}
+
+// Fraction returns num/denom of the amount rounded half up to the nearest
+// cent.
+func (m Money) Fraction(num, denom int64) Money {
+	v := m.Cents * num
+	if v >= 0 {
+		v = (v + denom/2) / denom
+	} else {
+		v = (v - denom/2) / denom
+	}
+	return NewMoney(v, m.Currency)
+}
+
+// Min returns the smaller of the two amounts
+func (m Money) Min(o Money) Money {
+	if o.Cents < m.Cents {
+		return o
+	}
+	return m
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts either a decimal string or a JSON number
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s == "" {
+			*m = Money{}
+			return nil
+		}
+	}
+
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	v.Currency = m.Currency
+	*m = NewMoney(v.Cents, v.Currency)
+	return nil
+}
+
+// Value stores the amount as a bigint of cents
+func (m Money) Value() (driver.Value, error) {
+	return m.Cents, nil
+}
+
+// Scan reads a bigint of cents, and also handles the text output of the
+// legacy money columns.
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = NewMoney(0, m.Currency)
+	case int64:
+		*m = NewMoney(v, m.Currency)
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	default:
+		return fmt.Errorf("money: cannot scan %T", value)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	if cents, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*m = NewMoney(cents, m.Currency)
+		return nil
+	}
+
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = NewMoney(v.Cents, m.Currency)
+	return nil
+}
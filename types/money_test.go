@@ -0,0 +1,135 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"12.50", 1250, false},
+		{"12.5", 1250, false},
+		{"12", 1200, false},
+		{".75", 75, false},
+		{"-3.00", -300, false},
+		{"(3.00)", -300, false},
+		{"$1,234.56", 123456, false},
+		{"0.005", 1, false},
+		{"0.004", 0, false},
+		{"1.999", 200, false},
+		{"-1.995", -200, false},
+		{"", 0, true},
+		{"abc", 0, true},
+		{"1.2x", 0, true},
+		{"--3", 0, true},
+		{"-+3", 0, true},
+		{"+3", 0, true},
+		{"1.+5", 0, true},
+		{"1.-5", 0, true},
+		{"(-3.00)", 0, true},
+		{"-(3.00)", 0, true},
+		{"1 000", 0, true},
+		{".", 0, true},
+		{"-", 0, true},
+		{"12.", 1200, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMoney(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMoney(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if err == nil && got.Cents != tt.want {
+				t.Errorf("ParseMoney(%q) = %d cents, want %d", tt.in, got.Cents, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		cents int64
+		want  string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1250, "12.50"},
+		{-5, "-0.05"},
+		{-123456, "-1234.56"},
+	}
+
+	for _, tt := range tests {
+		if got := NewMoney(tt.cents, "").String(); got != tt.want {
+			t.Errorf("NewMoney(%d).String() = %q, want %q", tt.cents, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		name  string
+		cents int64
+		bps   int64
+		want  int64
+	}{
+		{"whole", 10000, 1000, 1000},
+		{"rounds half up", 1250, 1000, 125},
+		{"rounds down", 1234, 1000, 123},
+		{"rounds up", 1235, 1000, 124},
+		{"tax", 1999, 825, 165},
+		{"half a cent", 50, 100, 1},
+		{"under half a cent", 49, 100, 0},
+		{"negative rounds away from zero", -1235, 1000, -124},
+		{"zero", 0, 825, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewMoney(tt.cents, "").Percent(tt.bps); got.Cents != tt.want {
+				t.Errorf("%d.Percent(%d) = %d, want %d", tt.cents, tt.bps, got.Cents, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyFraction(t *testing.T) {
+	// splitting 10.00 three ways rounds each share to the nearest cent
+	if got := NewMoney(1000, "").Fraction(1, 3); got.Cents != 333 {
+		t.Errorf("Fraction(1, 3) = %d, want 333", got.Cents)
+	}
+	if got := NewMoney(1000, "").Fraction(2, 3); got.Cents != 667 {
+		t.Errorf("Fraction(2, 3) = %d, want 667", got.Cents)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{`"12.50"`, 1250},
+		{`12.5`, 1250},
+		{`""`, 0},
+		{`"-0.01"`, -1},
+	}
+
+	for _, tt := range tests {
+		var m Money
+		if err := json.Unmarshal([]byte(tt.in), &m); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", tt.in, err)
+		}
+		if m.Cents != tt.want {
+			t.Errorf("Unmarshal(%s) = %d cents, want %d", tt.in, m.Cents, tt.want)
+		}
+	}
+
+	out, err := json.Marshal(NewMoney(1250, ""))
+	if err != nil || string(out) != `"12.50"` {
+		t.Errorf("Marshal(1250) = %s, %v, want \"12.50\"", out, err)
+	}
+}
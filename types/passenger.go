@@ -0,0 +1,132 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The age groups a passenger can be in, only adults sign waivers
+const (
+	AgeAdult  = "adult"
+	AgeSenior = "senior"
+	AgeChild  = "child"
+)
+
+// Errors returned when filling in passengers or checking them in
+var (
+	ErrPassengerAge       = errors.New("age group must be adult, senior or child")
+	ErrPassengerNotFound  = errors.New("no such passenger on this order")
+	ErrPassengerCheckedIn = errors.New("passenger has already checked in")
+	ErrWaiverUnsigned     = errors.New("the liability waiver hasn't been signed for this passenger")
+	ErrWaiverNotAdult     = errors.New("only adults sign the waiver")
+	ErrWaiverSignature    = errors.New("the signature must be the passenger's full name")
+)
+
+// Passenger is the person travelling on one seat of an order, the seat is
+// the number of the boarding pass for the ticket line with Sku.
+type Passenger struct {
+	ID              uint             `json:"id" gorm:"primary_key"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	UpdatedAt       time.Time        `json:"updatedAt"`
+	MerchantID      string           `json:"-" gorm:"index"`
+	OrderID         string           `json:"orderId"`
+	Sku             string           `json:"sku" binding:"required"`
+	Seat            int              `json:"seat" binding:"required"`
+	Name            string           `json:"name"`
+	AgeGroup        string           `json:"ageGroup"`
+	EmergencyName   string           `json:"emergencyName"`
+	EmergencyPhone  string           `json:"emergencyPhone"`
+	CheckedInAt     *time.Time       `json:"checkedInAt"`
+	CheckedInDevice string           `json:"checkedInDevice"`
+	Signature       *WaiverSignature `json:"signature" gorm:"foreignkey:PassengerID"`
+}
+
+// Validate checks the passenger's age group
+func (p *Passenger) Validate() error {
+	switch p.AgeGroup {
+	case AgeAdult, AgeSenior, AgeChild:
+		return nil
+	}
+	return ErrPassengerAge
+}
+
+// Adult reports whether the passenger has to sign the waiver themselves
+func (p *Passenger) Adult() bool {
+	return p.AgeGroup != AgeChild
+}
+
+// CanBoard reports whether the passenger has done what the merchant's active
+// waiver w asks of them, nil if there isn't one. Adults must have signed its
+// current version, a signature of an older one doesn't count, and a seat
+// nobody has filled in can't board.
+func (p *Passenger) CanBoard(w *Waiver) bool {
+	switch {
+	case w == nil:
+		return true
+	case p.ID == 0:
+		return false
+	case !p.Adult():
+		return true
+	}
+	return p.Signature != nil && p.Signature.Version == w.Version
+}
+
+// Matches reports whether a typed signature is the passenger's name,
+// ignoring case and spacing
+func (p *Passenger) Matches(signature string) bool {
+	norm := func(s string) string { return strings.ToLower(strings.Join(strings.Fields(s), " ")) }
+	return norm(signature) != "" && norm(signature) == norm(p.Name)
+}
+
+// PassCode is what is in the QR code of the passenger's boarding pass
+func PassCode(orderID, sku string, seat int) string {
+	return fmt.Sprintf("%s-%s-%d", orderID, sku, seat)
+}
+
+// ParsePassCode splits the QR code of a boarding pass into the order, sku
+// and seat number it was printed for
+func ParsePassCode(code string) (string, string, int, bool) {
+	parts := strings.Split(code, "-")
+	if len(parts) < 3 {
+		return "", "", 0, false
+	}
+
+	n := len(parts)
+	seat, err := strconv.Atoi(parts[n-1])
+	if err != nil || seat <= 0 {
+		return "", "", 0, false
+	}
+	if _, ok := ParseSku(parts[n-2]); !ok {
+		return "", "", 0, false
+	}
+	return strings.Join(parts[:n-2], "-"), parts[n-2], seat, true
+}
+
+// Waiver is a version of a merchant's liability waiver, a new version is
+// saved whenever the text changes so signatures keep what was agreed to.
+// Passengers must sign the latest version when it is Active.
+type Waiver struct {
+	ID         uint      `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time `json:"createdAt"`
+	MerchantID string    `json:"-" gorm:"index"`
+	Version    int       `json:"version"`
+	Title      string    `json:"title" binding:"required"`
+	Body       string    `json:"body" binding:"required"`
+	Active     bool      `json:"active"`
+}
+
+// WaiverSignature is a passenger's typed signature of a waiver, along with
+// when and where it was signed from
+type WaiverSignature struct {
+	ID          uint      `json:"-" gorm:"primary_key"`
+	MerchantID  string    `json:"-" gorm:"index"`
+	PassengerID uint      `json:"-" gorm:"index"`
+	WaiverID    uint      `json:"waiverId"`
+	Version     int       `json:"version"`
+	Signature   string    `json:"signature"`
+	SignedAt    time.Time `json:"signedAt"`
+	IP          string    `json:"ip"`
+}
@@ -0,0 +1,72 @@
+package types
+
+import "testing"
+
+func TestPassengerCanBoard(t *testing.T) {
+	waiver := &Waiver{ID: 7, Version: 3, Active: true}
+	signed := func(version int) *WaiverSignature { return &WaiverSignature{Version: version} }
+
+	tests := []struct {
+		name   string
+		p      Passenger
+		waiver *Waiver
+		want   bool
+	}{
+		{"no waiver", Passenger{}, nil, true},
+		{"nobody filled in the seat", Passenger{}, waiver, false},
+		{"child", Passenger{ID: 1, AgeGroup: AgeChild}, waiver, true},
+		{"adult who hasn't signed", Passenger{ID: 1, AgeGroup: AgeAdult}, waiver, false},
+		{"adult who signed", Passenger{ID: 1, AgeGroup: AgeAdult, Signature: signed(3)}, waiver, true},
+		{"senior who signed an older version", Passenger{ID: 1, AgeGroup: AgeSenior, Signature: signed(2)}, waiver, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.CanBoard(tt.waiver); got != tt.want {
+				t.Errorf("CanBoard() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPassCode(t *testing.T) {
+	sku := "12ADULT1909491200"
+
+	tests := []struct {
+		name    string
+		orderID string
+		seat    int
+	}{
+		{"paypal", "5O190127TN364715T", 1},
+		{"stripe", "pi_1HcxYzKb2VmWqLq3", 12},
+		{"voucher checkout", "VCH-ABCD-EFGH-JKLM", 2},
+		{"manual sale", "POS-ABCD-EFGH-JKLM", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := PassCode(tt.orderID, sku, tt.seat)
+			orderID, gotSku, seat, ok := ParsePassCode(code)
+			if !ok || orderID != tt.orderID || gotSku != sku || seat != tt.seat {
+				t.Errorf("ParsePassCode(%q) = %q, %q, %d, %v, want %q, %q, %d, true",
+					code, orderID, gotSku, seat, ok, tt.orderID, sku, tt.seat)
+			}
+		})
+	}
+}
+
+func TestParsePassCodeInvalid(t *testing.T) {
+	for _, code := range []string{
+		"",
+		"12ADULT1909491200-1",
+		"ORDER-12ADULT1909491200-0",
+		"ORDER-12ADULT1909491200--1",
+		"ORDER-12ADULT1909491200-x",
+		"ORDER-FEE-1",
+		"ORDER-12adult1909491200-1",
+	} {
+		if orderID, sku, seat, ok := ParsePassCode(code); ok {
+			t.Errorf("ParsePassCode(%q) = %q, %q, %d, true, want false", code, orderID, sku, seat)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package types
 
 import (
 	"encoding/json"
-	"regexp"
 	"strconv"
 	"time"
 
@@ -11,12 +10,12 @@ import (
 )
 
 type amount struct {
-	Total    string `json:"total" gorm:"type:money"`
+	Total    Money  `json:"total" gorm:"type:bigint"`
 	Currency string `json:"currency" gorm:"-"`
 }
 
 type Amount struct {
-	Value        string `json:"value" gorm:"type:money"`
+	Value        Money  `json:"value" gorm:"type:bigint"`
 	CurrencyCode string `json:"currency_code,omitempty" gorm:"-"`
 }
 
@@ -24,6 +23,7 @@ type Breakdown struct {
 	Amount
 	Breakdown struct {
 		ItemTotal Amount `json:"item_total" gorm:"embedded;embedded_prefix:item_"`
+		TaxTotal  Amount `json:"tax_total" gorm:"embedded;embedded_prefix:tax_"`
 	} `json:"breakdown" gorm:"embedded"`
 }
 
@@ -96,7 +96,7 @@ func (w *WebHookEvent) UnmarshalJSON(data []byte) error {
 		aux.Resource = new(Refund)
 	}
 
-	w.RawMessage = postgres.Jsonb{json.RawMessage(data)}
+	w.RawMessage = postgres.Jsonb{RawMessage: json.RawMessage(data)}
 	return json.Unmarshal(*aux.RawResource, aux.Resource)
 }
 
@@ -104,9 +104,9 @@ type Item struct {
 	Transaction string `json:"-" gorm:"primary_key"`
 	Name        string `json:"name"`
 	Sku         string `json:"sku" gorm:"primary_key"`
-	Price       string `json:"price" gorm:"type:money"`
+	Price       Money  `json:"price" gorm:"type:bigint"`
 	Currency    string `json:"currency"`
-	Tax         string `json:"tax" gorm:"type:money"`
+	Tax         Money  `json:"tax" gorm:"type:bigint"`
 	Qty         uint32 `json:"quantity"`
 }
 
@@ -179,6 +179,7 @@ type PurchaseItem struct {
 	Sku         string `json:"sku" gorm:"primary_key"`
 	Name        string `json:"name"`
 	Amount      Amount `json:"unit_amount" gorm:"embedded"`
+	Tax         Amount `json:"tax" gorm:"embedded;embedded_prefix:tax_"`
 	Quantity    uint   `json:"quantity,string"`
 	Description string `json:"description"`
 }
@@ -205,18 +206,16 @@ type PurchaseUnit struct {
 }
 
 func (pu *PurchaseUnit) AfterCreate(tx *gorm.DB) error {
-	re := regexp.MustCompile(`(\d+)[A-Z]+(\d{10})`)
-
 	for idx, item := range pu.Items {
 		pu.Items[idx].CheckoutID = pu.CheckoutID
 		tx.Create(&pu.Items[idx])
 
-		res := re.FindStringSubmatch(item.Sku)
-		pid, _ := strconv.Atoi(res[1])
-		timestamp, _ := strconv.ParseInt(res[2], 10, 64)
+		info, ok := ParseSku(item.Sku)
+		if !ok {
+			continue
+		}
 
-		tm := time.Unix(timestamp, 0).In(loc)
-		tx.Table("manual_overrides").Where("product_id = ? AND time = ?", pid, tm).
+		tx.Table("manual_overrides").Where("product_id = ? AND time = ?", info.ProductID, info.Time).
 			UpdateColumn("avail", gorm.Expr("avail - ?", item.Quantity))
 	}
 
@@ -262,6 +261,14 @@ type CheckoutOrder struct {
 	PayerID       string         `json:"-"`
 	Payer         *Payer         `json:"payer"`
 	Status        string         `json:"status"`
+	Fees          Money          `json:"fees" gorm:"type:bigint"`
+	Tax           Money          `json:"tax" gorm:"type:bigint"`
+	Discount      Money          `json:"discount" gorm:"type:bigint"`
+	PromoCode     string         `json:"promoCode"`
+	Credit        Money          `json:"credit" gorm:"type:bigint"`
+	Voucher       string         `json:"voucher"`
+	Balance       Money          `json:"balance" gorm:"type:bigint"`
+	Commission    Money          `json:"commission" gorm:"type:bigint"`
 }
 
 func (c *CheckoutOrder) AfterCreate(tx *gorm.DB) error {
@@ -294,7 +301,7 @@ type Sale struct {
 	Amount         amount `json:"amount" gorm:"embedded"`
 	PaymentMode    string `json:"payment_mode"`
 	TransactionFee struct {
-		Value    string `json:"value" gorm:"column:transaction_fee;type:money"`
+		Value    Money  `json:"value" gorm:"column:transaction_fee;type:bigint"`
 		Currency string `json:"currency" gorm:"-"`
 	} `json:"transaction_fee" gorm:"embedded"`
 	ParentPayment   string         `json:"parent_payment"`
@@ -338,3 +345,55 @@ func (t *Transaction) AfterCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// PendingOrder is a PayPal order created by the server, kept so that the
+// order can be checked against what was created before it is captured.
+// Items maps each sku to its quantity.
+type PendingOrder struct {
+	ID         string          `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	MerchantID string          `json:"-" gorm:"index"`
+	Payee      string          `json:"payee"`
+	Amount     Money           `json:"amount" gorm:"type:bigint"`
+	Items      postgres.Hstore `json:"items"`
+	Promo      string          `json:"promo"`
+	Voucher    string          `json:"voucher"`
+	Email      string          `json:"email"`
+	CapturedAt *time.Time      `json:"capturedAt"`
+	// Deposit is set when the order only pays a deposit, BalanceToken
+	// when the order pays off the balance of an earlier one
+	Deposit      bool   `json:"deposit"`
+	BalanceToken string `json:"-"`
+	// VoucherHold is the voucher ledger entry holding the order's credit
+	VoucherHold uint `json:"-"`
+	// PromoHold is the pending redemption holding the order's use of its
+	// promo code
+	PromoHold uint `json:"-"`
+	// Flagged is why the order wasn't fulfilled after it was captured
+	Flagged string `json:"flagged"`
+}
+
+// Matches checks that an order is still what was created, paid to the same
+// payee for the same amount with the same tickets.
+func (p *PendingOrder) Matches(payee string, total Money, items []PurchaseItem) bool {
+	if p.Payee != payee || p.Amount.Cents != total.Cents {
+		return false
+	}
+
+	// fee lines are added from the quote and aren't part of the cart
+	qtys := make(map[string]uint)
+	for _, i := range items {
+		if i.Sku != "FEE" {
+			qtys[i.Sku] += i.Quantity
+		}
+	}
+	if len(qtys) != len(p.Items) {
+		return false
+	}
+	for sku, q := range p.Items {
+		if q == nil || *q != strconv.FormatUint(uint64(qtys[sku]), 10) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package types
+
+import (
+	"errors"
+	"time"
+)
+
+// How a passenger paid to enter a pool
+const (
+	PoolCash = "cash"
+	PoolCard = "card"
+)
+
+// Errors returned when running a pool
+var (
+	ErrPoolFee          = errors.New("pools need an entry fee")
+	ErrPoolMethod       = errors.New("pool entries must be paid by cash or card")
+	ErrPoolNotFound     = errors.New("pool not found")
+	ErrPoolNotCheckedIn = errors.New("only passengers checked in for the trip can enter the pool")
+	ErrPoolEntered      = errors.New("passenger has already entered the pool")
+	ErrPoolSettled      = errors.New("the pool has already been paid out")
+	ErrPoolNoWeighIn    = errors.New("no fish have been weighed in for the pool")
+)
+
+// Pool is the biggest-fish jackpot of one departure. Passengers buy in for
+// EntryFee, the house keeps HouseBps basis points of the pot and the rest
+// is paid to whoever weighs in the heaviest fish.
+type Pool struct {
+	ID         uint        `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	UpdatedAt  time.Time   `json:"updatedAt"`
+	MerchantID string      `json:"-" gorm:"index"`
+	ProductID  uint        `json:"productId" binding:"required"`
+	Time       time.Time   `json:"time" binding:"required"`
+	Name       string      `json:"name"`
+	EntryFee   Money       `json:"entryFee" gorm:"type:bigint"`
+	HouseBps   int64       `json:"houseBps"`
+	WinnerID   *uint       `json:"winnerId"`
+	Payout     Money       `json:"payout" gorm:"type:bigint"`
+	PaidAt     *time.Time  `json:"paidAt"`
+	PaidBy     string      `json:"paidBy"`
+	Entries    []PoolEntry `json:"entries" gorm:"foreignkey:PoolID"`
+}
+
+// Validate checks the pool can be bought into
+func (p *Pool) Validate() error {
+	if p.EntryFee.Cents <= 0 || p.HouseBps < 0 || p.HouseBps > 10000 {
+		return ErrPoolFee
+	}
+	return nil
+}
+
+// Pot is everything paid into the pool
+func (p *Pool) Pot() Money {
+	pot := NewMoney(0, p.EntryFee.Currency)
+	for _, e := range p.Entries {
+		pot = pot.Add(e.Paid)
+	}
+	return pot
+}
+
+// Prize is what the winner is paid, the pot less the house's share
+func (p *Pool) Prize() Money {
+	pot := p.Pot()
+	return pot.Sub(pot.Percent(p.HouseBps))
+}
+
+// Winner is the entry with the heaviest fish, the first weighed in wins a
+// tie. It is nil until a fish has been weighed.
+func (p *Pool) Winner() *PoolEntry {
+	var best *PoolEntry
+	for idx := range p.Entries {
+		e := &p.Entries[idx]
+		if e.WeighedAt == nil || e.WeightLbs <= 0 {
+			continue
+		}
+		if best == nil || e.WeightLbs > best.WeightLbs ||
+			(e.WeightLbs == best.WeightLbs && e.WeighedAt.Before(*best.WeighedAt)) {
+			best = e
+		}
+	}
+	return best
+}
+
+// Summary is the totals of the pool for manifests and reports
+func (p *Pool) Summary() PoolSummary {
+	s := PoolSummary{
+		PoolID:    p.ID,
+		ProductID: p.ProductID,
+		Time:      p.Time,
+		Name:      p.Name,
+		Entries:   len(p.Entries),
+		Pot:       p.Pot(),
+		Prize:     p.Prize(),
+		Payout:    p.Payout,
+		PaidAt:    p.PaidAt,
+		Collected: make(map[string]Money),
+	}
+	for _, e := range p.Entries {
+		s.Collected[e.Method] = s.Collected[e.Method].Add(e.Paid)
+		if p.WinnerID != nil && e.ID == *p.WinnerID {
+			s.Winner, s.WeightLbs, s.Species = e.Name, e.WeightLbs, e.Species
+		}
+	}
+	if p.WinnerID == nil {
+		if w := p.Winner(); w != nil {
+			s.Winner, s.WeightLbs, s.Species = w.Name, w.WeightLbs, w.Species
+		}
+	}
+	if p.PaidAt != nil {
+		s.House = s.Pot.Sub(p.Payout)
+	}
+	return s
+}
+
+// PoolEntry is a passenger's buy in to a pool and the fish they weighed in
+type PoolEntry struct {
+	ID          uint       `json:"id" gorm:"primary_key"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	PoolID      uint       `json:"-" gorm:"index"`
+	PassengerID uint       `json:"passengerId"`
+	Name        string     `json:"name"`
+	Paid        Money      `json:"paid" gorm:"type:bigint"`
+	Method      string     `json:"method"`
+	WeightLbs   float64    `json:"weightLbs"`
+	Species     string     `json:"species"`
+	WeighedAt   *time.Time `json:"weighedAt"`
+}
+
+// PoolSummary is how much went into a pool, who won it and what was paid
+// out. House is only known once the pool has been paid out.
+type PoolSummary struct {
+	PoolID    uint             `json:"poolId"`
+	ProductID uint             `json:"productId"`
+	Time      time.Time        `json:"time"`
+	Name      string           `json:"name"`
+	Entries   int              `json:"entries"`
+	Collected map[string]Money `json:"collected"`
+	Pot       Money            `json:"pot"`
+	Prize     Money            `json:"prize"`
+	Winner    string           `json:"winner"`
+	WeightLbs float64          `json:"weightLbs"`
+	Species   string           `json:"species"`
+	Payout    Money            `json:"payout"`
+	House     Money            `json:"house"`
+	PaidAt    *time.Time       `json:"paidAt"`
+}
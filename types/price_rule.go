@@ -0,0 +1,148 @@
+package types
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The kinds of dynamic pricing rule
+const (
+	// PriceDays adjusts departures on the given weekdays, such as weekends
+	PriceDays = "days"
+	// PriceDates adjusts departures on specific dates, such as holidays
+	PriceDates = "dates"
+	// PriceSeason adjusts departures between StartDate and EndDate
+	PriceSeason = "season"
+	// PriceEarlyBird adjusts bookings made at least MinDays before departure
+	PriceEarlyBird = "early_bird"
+	// PriceLastMinute adjusts bookings made within MaxHours of departure
+	PriceLastMinute = "last_minute"
+	// PriceOccupancy adjusts departures once MinPercent of seats are sold
+	PriceOccupancy = "occupancy"
+)
+
+// PriceRule adjusts ticket prices for the trips it applies to, by Percent
+// basis points of the price and then by Amount, either of which can be
+// negative for a discount. A rule without a ProductID applies to all of the
+// merchant's products and rules are applied in Priority order.
+type PriceRule struct {
+	ID         uint           `json:"id" gorm:"primary_key"`
+	MerchantID string         `json:"-" gorm:"index"`
+	ProductID  *uint          `json:"productId" gorm:"index"`
+	Name       string         `json:"name"`
+	Kind       string         `json:"kind"`
+	Priority   int            `json:"priority"`
+	Active     bool           `json:"active"`
+	Percent    int64          `json:"bps"`
+	Amount     Money          `json:"amount" gorm:"type:bigint"`
+	Days       pq.Int64Array  `json:"days" gorm:"type:integer[]"`
+	Dates      pq.StringArray `json:"dates" gorm:"type:text[]"`
+	StartDate  *time.Time     `json:"startDate"`
+	EndDate    *time.Time     `json:"endDate"`
+	MinDays    int            `json:"minDays"`
+	MaxHours   int            `json:"maxHours"`
+	MinPercent int            `json:"minPercent"`
+}
+
+// Trip is what a price rule is evaluated against, a single departure being
+// booked at BookedAt with Occupancy percent of its seats already sold.
+type Trip struct {
+	ProductID uint
+	Departure time.Time
+	BookedAt  time.Time
+	Occupancy int
+}
+
+// Validate checks that the rule has what it needs for its kind
+func (r *PriceRule) Validate() error {
+	switch r.Kind {
+	case PriceDays:
+		if len(r.Days) == 0 {
+			return fmt.Errorf("price rule %q: needs at least one weekday", r.Name)
+		}
+	case PriceDates:
+		if len(r.Dates) == 0 {
+			return fmt.Errorf("price rule %q: needs at least one date", r.Name)
+		}
+		for _, d := range r.Dates {
+			if _, err := time.Parse("2006-01-02", d); err != nil {
+				return fmt.Errorf("price rule %q: invalid date %q", r.Name, d)
+			}
+		}
+	case PriceSeason:
+		if r.StartDate == nil || r.EndDate == nil || r.EndDate.Before(*r.StartDate) {
+			return fmt.Errorf("price rule %q: needs a start and end date", r.Name)
+		}
+	case PriceEarlyBird:
+		if r.MinDays <= 0 {
+			return fmt.Errorf("price rule %q: needs a number of days", r.Name)
+		}
+	case PriceLastMinute:
+		if r.MaxHours <= 0 {
+			return fmt.Errorf("price rule %q: needs a number of hours", r.Name)
+		}
+	case PriceOccupancy:
+		if r.MinPercent <= 0 || r.MinPercent > 100 {
+			return fmt.Errorf("price rule %q: percent sold must be between 1 and 100", r.Name)
+		}
+	default:
+		return fmt.Errorf("price rule %q: unknown kind %q", r.Name, r.Kind)
+	}
+
+	if r.Percent <= -10000 {
+		return fmt.Errorf("price rule %q: can't take 100%% or more off", r.Name)
+	}
+	return nil
+}
+
+// Applies reports whether the rule changes the price of a trip
+func (r *PriceRule) Applies(t Trip) bool {
+	if !r.Active || (r.ProductID != nil && *r.ProductID != t.ProductID) {
+		return false
+	}
+
+	dep := t.Departure.In(loc)
+
+	switch r.Kind {
+	case PriceDays:
+		for _, d := range r.Days {
+			if time.Weekday(d) == dep.Weekday() {
+				return true
+			}
+		}
+	case PriceDates:
+		for _, d := range r.Dates {
+			if d == dep.Format("2006-01-02") {
+				return true
+			}
+		}
+	case PriceSeason:
+		// the season's dates are whole days, a departure on the end date is
+		// in it whatever time of day the end date was saved with
+		if r.StartDate == nil || r.EndDate == nil {
+			return false
+		}
+		date := dep.Format("2006-01-02")
+		return date >= r.StartDate.In(loc).Format("2006-01-02") &&
+			date <= r.EndDate.In(loc).Format("2006-01-02")
+	case PriceEarlyBird:
+		return t.Departure.Sub(t.BookedAt) >= time.Duration(r.MinDays)*24*time.Hour
+	case PriceLastMinute:
+		left := t.Departure.Sub(t.BookedAt)
+		return left >= 0 && left <= time.Duration(r.MaxHours)*time.Hour
+	case PriceOccupancy:
+		return t.Occupancy >= r.MinPercent
+	}
+	return false
+}
+
+// Adjust applies the rule to a price, which never goes below zero
+func (r *PriceRule) Adjust(price Money) Money {
+	out := price.Add(price.Percent(r.Percent)).Add(r.Amount)
+	if out.Cents < 0 {
+		out.Cents = 0
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPriceRuleSeason(t *testing.T) {
+	start := time.Date(2020, time.June, 1, 0, 0, 0, 0, loc)
+	end := time.Date(2020, time.August, 31, 0, 0, 0, 0, loc)
+	rule := PriceRule{Kind: PriceSeason, Active: true, StartDate: &start, EndDate: &end}
+
+	tests := []struct {
+		name string
+		dep  time.Time
+		want bool
+	}{
+		{"before start", time.Date(2020, time.May, 31, 23, 0, 0, 0, loc), false},
+		{"start morning", time.Date(2020, time.June, 1, 6, 0, 0, 0, loc), true},
+		{"mid season", time.Date(2020, time.July, 15, 12, 0, 0, 0, loc), true},
+		{"end morning", time.Date(2020, time.August, 31, 6, 0, 0, 0, loc), true},
+		{"end evening", time.Date(2020, time.August, 31, 19, 30, 0, 0, loc), true},
+		{"end evening in utc", time.Date(2020, time.September, 1, 0, 30, 0, 0, time.UTC), true},
+		{"day after end", time.Date(2020, time.September, 1, 6, 0, 0, 0, loc), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rule.Applies(Trip{Departure: tt.dep}); got != tt.want {
+				t.Errorf("Applies(%s) = %v, want %v", tt.dep, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriceRuleSeasonEndTime(t *testing.T) {
+	// an end date saved with a time of day still covers the whole day
+	start := time.Date(2020, time.June, 1, 9, 0, 0, 0, loc)
+	end := time.Date(2020, time.August, 31, 9, 0, 0, 0, loc)
+	rule := PriceRule{Kind: PriceSeason, Active: true, StartDate: &start, EndDate: &end}
+
+	for _, dep := range []time.Time{
+		time.Date(2020, time.June, 1, 6, 0, 0, 0, loc),
+		time.Date(2020, time.August, 31, 18, 0, 0, 0, loc),
+	} {
+		if !rule.Applies(Trip{Departure: dep}) {
+			t.Errorf("Applies(%s) = false, want true", dep)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The kinds of discount a promo code can give
+const (
+	// PromoPercent takes Percent basis points off each eligible ticket
+	PromoPercent = "percent"
+	// PromoFixed takes Amount off each eligible ticket
+	PromoFixed = "fixed"
+)
+
+// Errors returned when a promo code can't be used
+var (
+	ErrPromoNotFound   = errors.New("promo code not found")
+	ErrPromoNotActive  = errors.New("promo code is not active")
+	ErrPromoUsedUp     = errors.New("promo code has been used up")
+	ErrPromoNeedsEmail = errors.New("promo code requires a customer email")
+	ErrPromoCustomer   = errors.New("promo code already used by this customer")
+)
+
+// PromoCode is a merchant managed discount code. A code limited to a
+// product or ticket category only discounts those tickets. StartsAt and
+// EndsAt limit when the code can be redeemed, and a MaxUses or
+// MaxPerCustomer of 0 means unlimited.
+type PromoCode struct {
+	ID               uint       `json:"id" gorm:"primary_key"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	MerchantID       string     `json:"-" gorm:"index"`
+	Code             string     `json:"code"`
+	Description      string     `json:"description"`
+	Kind             string     `json:"kind"`
+	Amount           Money      `json:"amount" gorm:"type:bigint"`
+	Percent          int64      `json:"bps"`
+	ProductID        *uint      `json:"productId"`
+	TicketCategoryID *uint      `json:"ticketCategoryId"`
+	StartsAt         *time.Time `json:"startsAt"`
+	EndsAt           *time.Time `json:"endsAt"`
+	MaxUses          int        `json:"maxUses"`
+	MaxPerCustomer   int        `json:"maxPerCustomer"`
+	Uses             int        `json:"uses"`
+	Active           bool       `json:"active"`
+}
+
+// PromoRedemption records a promo code being used on a paid order. A
+// pending one holds a use for a checkout that hasn't been paid yet so
+// checkouts at the same time can't go over the code's limits.
+type PromoRedemption struct {
+	ID          uint      `json:"id" gorm:"primary_key"`
+	CreatedAt   time.Time `json:"createdAt"`
+	PromoCodeID uint      `json:"promoCodeId" gorm:"index"`
+	MerchantID  string    `json:"-" gorm:"index"`
+	Email       string    `json:"email"`
+	Provider    string    `json:"provider"`
+	OrderID     string    `json:"orderId"`
+	Discount    Money     `json:"discount" gorm:"type:bigint"`
+	Pending     bool      `json:"pending"`
+}
+
+// NormalizePromoCode makes codes case insensitive
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate checks that the code has what it needs for its kind
+func (p *PromoCode) Validate() error {
+	p.Code = NormalizePromoCode(p.Code)
+	if p.Code == "" {
+		return errors.New("promo code can't be empty")
+	}
+
+	switch p.Kind {
+	case PromoPercent:
+		if p.Percent <= 0 || p.Percent > 10000 {
+			return fmt.Errorf("promo %q: percentage must be between 0 and 100%%", p.Code)
+		}
+	case PromoFixed:
+		if p.Amount.Cents <= 0 {
+			return fmt.Errorf("promo %q: fixed discounts need a positive amount", p.Code)
+		}
+	default:
+		return fmt.Errorf("promo %q: unknown kind %q", p.Code, p.Kind)
+	}
+
+	if p.StartsAt != nil && p.EndsAt != nil && p.EndsAt.Before(*p.StartsAt) {
+		return fmt.Errorf("promo %q: ends before it starts", p.Code)
+	}
+	if p.MaxUses < 0 || p.MaxPerCustomer < 0 {
+		return fmt.Errorf("promo %q: limits can't be negative", p.Code)
+	}
+	return nil
+}
+
+// Usable checks that the code is active, in its date window and hasn't
+// reached its usage limit at the given time.
+func (p *PromoCode) Usable(now time.Time) error {
+	if !p.Active || (p.StartsAt != nil && now.Before(*p.StartsAt)) || (p.EndsAt != nil && now.After(*p.EndsAt)) {
+		return ErrPromoNotActive
+	}
+	if p.MaxUses > 0 && p.Uses >= p.MaxUses {
+		return ErrPromoUsedUp
+	}
+	return nil
+}
+
+// Applies reports whether the code discounts a ticket for the product with
+// the given ticket category.
+func (p *PromoCode) Applies(productID, categoryID uint) bool {
+	if p.ProductID != nil && *p.ProductID != productID {
+		return false
+	}
+	if p.TicketCategoryID != nil && *p.TicketCategoryID != categoryID {
+		return false
+	}
+	return true
+}
+
+// Discount returns the discount for a single ticket at the given price,
+// never more than the price itself.
+func (p *PromoCode) Discount(unit Money) Money {
+	var d Money
+	switch p.Kind {
+	case PromoPercent:
+		d = unit.Percent(p.Percent)
+	case PromoFixed:
+		d = NewMoney(p.Amount.Cents, unit.Currency)
+	}
+	return d.Min(unit)
+}
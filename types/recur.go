@@ -0,0 +1,210 @@
+package types
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRecur is returned for a recurrence rule that can't be used
+var ErrRecur = errors.New("recurrence must be an RRULE with FREQ=DAILY, WEEKLY or MONTHLY and optionally INTERVAL, BYDAY and BYMONTHDAY")
+
+var rruleDays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// ByDay is a weekday of a recurrence rule, N is which one of the month
+// it is for monthly rules (-1 is the last) or 0 for all of them
+type ByDay struct {
+	N   int
+	Day time.Weekday
+}
+
+// RRule is the part of an RFC 5545 recurrence rule schedules can use, such
+// as "FREQ=WEEKLY;INTERVAL=2;BYDAY=SA" for every other Saturday or
+// "FREQ=MONTHLY;BYDAY=1SU" for the first Sunday of the month. It repeats
+// from the start of the schedule.
+type RRule struct {
+	Freq       string
+	Interval   int
+	ByDay      []ByDay
+	ByMonthDay []int
+}
+
+// ParseRRule parses a recurrence rule, with or without the "RRULE:" prefix
+func ParseRRule(s string) (*RRule, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+	r := &RRule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrRecur
+		}
+
+		switch kv[0] {
+		case "FREQ":
+			r.Freq = kv[1]
+		case "INTERVAL":
+			n, err := strconv.Atoi(kv[1])
+			if err != nil || n <= 0 {
+				return nil, ErrRecur
+			}
+			r.Interval = n
+		case "BYDAY":
+			for _, d := range strings.Split(kv[1], ",") {
+				if len(d) < 2 {
+					return nil, ErrRecur
+				}
+				day, ok := rruleDays[d[len(d)-2:]]
+				if !ok {
+					return nil, ErrRecur
+				}
+				bd := ByDay{Day: day}
+				if ord := d[:len(d)-2]; ord != "" {
+					n, err := strconv.Atoi(strings.TrimPrefix(ord, "+"))
+					if err != nil || n == 0 || n < -5 || n > 5 {
+						return nil, ErrRecur
+					}
+					bd.N = n
+				}
+				r.ByDay = append(r.ByDay, bd)
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(kv[1], ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, ErrRecur
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		default:
+			return nil, ErrRecur
+		}
+	}
+
+	switch r.Freq {
+	case "DAILY", "WEEKLY":
+		for _, bd := range r.ByDay {
+			if bd.N != 0 {
+				return nil, ErrRecur
+			}
+		}
+		if len(r.ByMonthDay) > 0 {
+			return nil, ErrRecur
+		}
+	case "MONTHLY":
+	default:
+		return nil, ErrRecur
+	}
+	return r, nil
+}
+
+// civil is the number of days from the epoch to the date of t
+func civil(t time.Time) int {
+	return int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+func (r *RRule) onWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, bd := range r.ByDay {
+		if bd.Day == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// On reports whether the rule repeating from start falls on the date of day
+func (r *RRule) On(start, day time.Time) bool {
+	if civil(day) < civil(start) {
+		return false
+	}
+
+	switch r.Freq {
+	case "DAILY":
+		return (civil(day)-civil(start))%r.Interval == 0 && r.onWeekday(day)
+	case "WEEKLY":
+		// weeks start on Monday, the RFC 5545 default
+		week := func(t time.Time) int { return (civil(t) - (int(t.Weekday())+6)%7) / 7 }
+		if (week(day)-week(start))%r.Interval != 0 {
+			return false
+		}
+		if len(r.ByDay) == 0 {
+			return day.Weekday() == start.Weekday()
+		}
+		return r.onWeekday(day)
+	}
+
+	months := (day.Year()-start.Year())*12 + int(day.Month()) - int(start.Month())
+	if months%r.Interval != 0 {
+		return false
+	}
+	if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+		return day.Day() == start.Day()
+	}
+
+	last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if len(r.ByMonthDay) > 0 {
+		found := false
+		for _, md := range r.ByMonthDay {
+			if md == day.Day() || (md < 0 && last+md+1 == day.Day()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, bd := range r.ByDay {
+		if bd.Day != day.Weekday() {
+			continue
+		}
+		switch {
+		case bd.N == 0:
+			return true
+		case bd.N > 0 && (day.Day()-1)/7+1 == bd.N:
+			return true
+		case bd.N < 0 && (last-day.Day())/7+1 == -bd.N:
+			return true
+		}
+	}
+	return false
+}
+
+// FederalHolidays returns the dates of the US federal holidays in a year
+func FederalHolidays(year int) []string {
+	nth := func(month time.Month, day time.Weekday, n int) time.Time {
+		first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+		return first.AddDate(0, 0, (int(day)-int(first.Weekday())+7)%7+(n-1)*7)
+	}
+	lastMonday := time.Date(year, time.June, 0, 0, 0, 0, 0, time.UTC)
+	lastMonday = lastMonday.AddDate(0, 0, -((int(lastMonday.Weekday()) + 6) % 7))
+
+	days := []time.Time{
+		time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC),
+		nth(time.January, time.Monday, 3),
+		nth(time.February, time.Monday, 3),
+		lastMonday,
+		time.Date(year, time.June, 19, 0, 0, 0, 0, time.UTC),
+		time.Date(year, time.July, 4, 0, 0, 0, 0, time.UTC),
+		nth(time.September, time.Monday, 1),
+		nth(time.October, time.Monday, 2),
+		time.Date(year, time.November, 11, 0, 0, 0, 0, time.UTC),
+		nth(time.November, time.Thursday, 4),
+		time.Date(year, time.December, 25, 0, 0, 0, 0, time.UTC),
+	}
+
+	out := make([]string, 0, len(days))
+	for _, d := range days {
+		out = append(out, d.Format("2006-01-02"))
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRRule(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    *RRule
+		wantErr bool
+	}{
+		{in: "FREQ=DAILY", want: &RRule{Freq: "DAILY", Interval: 1}},
+		{in: "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=SA", want: &RRule{Freq: "WEEKLY", Interval: 2, ByDay: []ByDay{{Day: time.Saturday}}}},
+		{in: " rrule:freq=weekly;byday=sa,su ", want: &RRule{Freq: "WEEKLY", Interval: 1, ByDay: []ByDay{{Day: time.Saturday}, {Day: time.Sunday}}}},
+		{in: "FREQ=MONTHLY;BYDAY=+2MO,-1SU", want: &RRule{Freq: "MONTHLY", Interval: 1, ByDay: []ByDay{{N: 2, Day: time.Monday}, {N: -1, Day: time.Sunday}}}},
+		{in: "FREQ=MONTHLY;BYMONTHDAY=1,-1", want: &RRule{Freq: "MONTHLY", Interval: 1, ByMonthDay: []int{1, -1}}},
+		{in: "", wantErr: true},
+		{in: "FREQ=YEARLY", wantErr: true},
+		{in: "FREQ=WEEKLY;COUNT=3", wantErr: true},
+		{in: "FREQ=DAILY;INTERVAL=0", wantErr: true},
+		{in: "FREQ=WEEKLY;BYDAY=XX", wantErr: true},
+		{in: "FREQ=WEEKLY;BYDAY=1SU", wantErr: true},
+		{in: "FREQ=WEEKLY;BYMONTHDAY=1", wantErr: true},
+		{in: "FREQ=MONTHLY;BYDAY=6SU", wantErr: true},
+		{in: "FREQ=MONTHLY;BYMONTHDAY=32", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseRRule(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRRule(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRRule(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRRuleOn(t *testing.T) {
+	date := func(m time.Month, d int) time.Time { return time.Date(2026, m, d, 8, 0, 0, 0, loc) }
+	// the schedules start on Saturday, January 3rd 2026
+	start := date(time.January, 3)
+
+	tests := []struct {
+		rule string
+		day  time.Time
+		want bool
+	}{
+		{"FREQ=DAILY", date(time.January, 2), false},
+		{"FREQ=DAILY", start, true},
+		{"FREQ=DAILY;INTERVAL=3", date(time.January, 6), true},
+		{"FREQ=DAILY;INTERVAL=3", date(time.January, 5), false},
+		{"FREQ=DAILY;BYDAY=SA,SU", date(time.January, 4), true},
+		{"FREQ=DAILY;BYDAY=SA,SU", date(time.January, 5), false},
+		{"FREQ=WEEKLY", date(time.January, 10), true},
+		{"FREQ=WEEKLY", date(time.January, 11), false},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=SA", date(time.January, 10), false},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=SA", date(time.January, 17), true},
+		// weeks start on Monday so the Sunday after the start is the same week
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=SA,SU", date(time.January, 4), true},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=SA,SU", date(time.January, 11), false},
+		{"FREQ=MONTHLY", date(time.February, 3), true},
+		{"FREQ=MONTHLY", date(time.February, 4), false},
+		{"FREQ=MONTHLY;BYDAY=1SU", date(time.January, 4), true},
+		{"FREQ=MONTHLY;BYDAY=1SU", date(time.February, 1), true},
+		{"FREQ=MONTHLY;BYDAY=1SU", date(time.February, 8), false},
+		{"FREQ=MONTHLY;BYDAY=-1FR", date(time.January, 30), true},
+		{"FREQ=MONTHLY;BYDAY=-1FR", date(time.January, 23), false},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", date(time.January, 31), true},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", date(time.February, 28), true},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", date(time.February, 27), false},
+		{"FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=15", date(time.January, 15), true},
+		{"FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=15", date(time.February, 15), false},
+		{"FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=15", date(time.March, 15), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule+" "+tt.day.Format("2006-01-02"), func(t *testing.T) {
+			r, err := ParseRRule(tt.rule)
+			if err != nil {
+				t.Fatalf("ParseRRule(%q): %v", tt.rule, err)
+			}
+			if got := r.On(start, tt.day); got != tt.want {
+				t.Errorf("On() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFederalHolidays(t *testing.T) {
+	want := []string{
+		"2026-01-01", "2026-01-19", "2026-02-16", "2026-05-25", "2026-06-19", "2026-07-04",
+		"2026-09-07", "2026-10-12", "2026-11-11", "2026-11-26", "2026-12-25",
+	}
+	if got := FederalHolidays(2026); !reflect.DeepEqual(got, want) {
+		t.Errorf("FederalHolidays(2026) = %v, want %v", got, want)
+	}
+}
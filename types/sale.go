@@ -0,0 +1,65 @@
+package types
+
+import (
+	"errors"
+	"time"
+)
+
+// SalePrefix starts the id of orders sold by staff from the dock or over
+// the phone
+const SalePrefix = "POS-"
+
+// How a manual sale was paid for, comps aren't paid for at all
+const (
+	SaleCash         = "cash"
+	SaleCheck        = "check"
+	SaleCardTerminal = "card-terminal"
+	SaleComp         = "comp"
+)
+
+// Where a manual sale was made
+const (
+	ChannelDock  = "dock"
+	ChannelPhone = "phone"
+)
+
+// Errors returned when recording a manual sale
+var (
+	ErrSaleMethod  = errors.New("payment method must be cash, check, card-terminal or comp")
+	ErrSaleChannel = errors.New("channel must be dock or phone")
+)
+
+// ManualSale records how an order sold by staff was paid for, the order
+// itself is stored with the merchant's payment provider's orders
+type ManualSale struct {
+	ID         uint      `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time `json:"createdAt"`
+	MerchantID string    `json:"-" gorm:"index"`
+	OrderID    string    `json:"orderId" gorm:"unique_index"`
+	Provider   string    `json:"provider"`
+	Channel    string    `json:"channel"`
+	Method     string    `json:"method"`
+	// Reference is the check number or card terminal receipt
+	Reference string `json:"reference"`
+	Amount    Money  `json:"amount" gorm:"type:bigint"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	Notes     string `json:"notes"`
+	SoldBy    string `json:"soldBy"`
+}
+
+// Validate checks the payment method and channel of the sale
+func (s *ManualSale) Validate() error {
+	switch s.Method {
+	case SaleCash, SaleCheck, SaleCardTerminal, SaleComp:
+	default:
+		return ErrSaleMethod
+	}
+	switch s.Channel {
+	case ChannelDock, ChannelPhone:
+	default:
+		return ErrSaleChannel
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package types
+
+import "time"
+
+// What happened to a check in recorded by a scanner when it was synced
+const (
+	ScanCheckedIn = "checked_in"
+	ScanAlready   = "already_checked_in"
+	ScanConflict  = "conflict"
+	ScanInvalid   = "invalid"
+	ScanUnsigned  = "unsigned"
+)
+
+// CheckInScan is a boarding pass scanned by a device while it may have been
+// offline. Scans are kept so syncing the same batch again gives the same
+// results.
+type CheckInScan struct {
+	ID          uint      `json:"-" gorm:"primary_key"`
+	CreatedAt   time.Time `json:"syncedAt"`
+	MerchantID  string    `json:"-" gorm:"index"`
+	DeviceID    string    `json:"deviceId"`
+	Code        string    `json:"code"`
+	ScannedAt   time.Time `json:"scannedAt"`
+	Status      string    `json:"status"`
+	PassengerID uint      `json:"passengerId"`
+	// ConflictDevice and ConflictAt are the other device that checked the
+	// seat in and when, it kept the seat if Status is a conflict as it
+	// scanned it first
+	ConflictDevice string     `json:"conflictDevice,omitempty"`
+	ConflictAt     *time.Time `json:"conflictAt,omitempty"`
+	// Warning is why the passenger wasn't let on when Status is unsigned
+	Warning string `json:"warning,omitempty"`
+}
+
+// ScannerPass is a seat a scanner can check in while offline
+type ScannerPass struct {
+	Code            string     `json:"code"`
+	OrderID         string     `json:"orderId"`
+	Sku             string     `json:"sku"`
+	Seat            int        `json:"seat"`
+	Product         string     `json:"product"`
+	Payer           string     `json:"payer"`
+	Name            string     `json:"name"`
+	AgeGroup        string     `json:"ageGroup"`
+	Signed          bool       `json:"signed"`
+	CheckedInAt     *time.Time `json:"checkedInAt"`
+	CheckedInDevice string     `json:"checkedInDevice"`
+	// Aliases are the codes printed on the seat's passes before its trip
+	// was moved to a new time, which are still good
+	Aliases []string `json:"aliases,omitempty"`
+}
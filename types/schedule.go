@@ -33,6 +33,13 @@ type Schedule struct {
 	TimeArray    []ScheduleTime `json:"timeArray"`
 	Days         pq.Int64Array  `json:"selectedDays" gorm:"type:integer[]"`
 	NotAvail     pq.StringArray `json:"notAvailArray,nilasempty" gorm:"type:text[]"`
+	// Recur is an RRULE the days of the schedule also have to match, such as
+	// every other Saturday
+	Recur string `json:"recur"`
+	// Blackouts are the dates the product's blackout calendars take off the
+	// schedule on top of NotAvail, they're only filled in to show it and
+	// aren't saved with it
+	Blackouts pq.StringArray `json:"blackoutArray" gorm:"-"`
 }
 
 func (s *Schedule) AfterUpdate(tx *gorm.DB) (err error) {
@@ -66,6 +73,9 @@ func (s *Schedule) UnmarshalJSON(data []byte) (err error) {
 	if s.End, err = time.ParseInLocation("2006-01-02", aux.EndDay, loc); err != nil {
 		return
 	}
+	if s.Recur != "" {
+		_, err = ParseRRule(s.Recur)
+	}
 
 	return
 }
@@ -76,6 +86,9 @@ func (s *Schedule) MarshalJSON() ([]byte, error) {
 	if s.NotAvail == nil {
 		s.NotAvail = make(pq.StringArray, 0)
 	}
+	if s.Blackouts == nil {
+		s.Blackouts = make(pq.StringArray, 0)
+	}
 	return json.Marshal(&struct {
 		*Alias
 		StartDay string `json:"start"`
@@ -86,3 +99,70 @@ func (s *Schedule) MarshalJSON() ([]byte, error) {
 		EndDay:   s.End.Format("2006-01-02"),
 	})
 }
+
+// Blackout is a reusable list of dates, like federal holidays or tournament
+// days, when none of its products run
+type Blackout struct {
+	ID         uint           `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time      `json:"-"`
+	UpdatedAt  time.Time      `json:"-"`
+	MerchantID string         `json:"-" gorm:"index"`
+	Name       string         `json:"name" binding:"required"`
+	Dates      pq.StringArray `json:"dates" gorm:"type:text[]"`
+	ProductIDs pq.Int64Array  `json:"productIds" gorm:"type:integer[]"`
+}
+
+// Validate checks the dates of the blackout are YYYY-MM-DD
+func (b *Blackout) Validate() error {
+	for _, d := range b.Dates {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExtraDeparture is a one-off trip of a product outside its regular
+// schedule, Price is the ticket category like a ScheduleTime's
+type ExtraDeparture struct {
+	ID           uint      `json:"id" gorm:"primary_key"`
+	CreatedAt    time.Time `json:"-"`
+	UpdatedAt    time.Time `json:"-"`
+	MerchantID   string    `json:"-" gorm:"index"`
+	ProductID    uint      `json:"productId" binding:"required"`
+	Time         time.Time `json:"time" binding:"required"`
+	EndTime      string    `json:"endTime"`
+	Price        string    `json:"price" binding:"required"`
+	TicketsAvail uint      `json:"ticketsAvail"`
+	Notes        string    `json:"notes"`
+}
+
+// Schedule is the extra departure as a schedule running only on its day,
+// so it is priced and sold like any other trip
+func (e *ExtraDeparture) Schedule() Schedule {
+	t := e.Time.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	return Schedule{
+		ProductID:    e.ProductID,
+		TicketsAvail: e.TicketsAvail,
+		Start:        day,
+		End:          day,
+		TimeArray: []ScheduleTime{{
+			StartTime: t.Format("15:04"),
+			EndTime:   e.EndTime,
+			Price:     e.Price,
+		}},
+	}
+}
+
+// TripMove records the bookings of a departure being moved to a new time
+// when its schedule changed. The skus of the tickets are changed to the new
+// time, the moves are kept so boarding passes printed before still scan.
+type TripMove struct {
+	ID         uint      `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time `json:"createdAt"`
+	MerchantID string    `json:"-" gorm:"index"`
+	ProductID  uint      `json:"productId"`
+	FromTime   time.Time `json:"from"`
+	ToTime     time.Time `json:"to"`
+}
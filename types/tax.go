@@ -0,0 +1,42 @@
+package types
+
+import "fmt"
+
+// TaxRate is a sales tax the merchant must collect. Rate is in parts per
+// million of the taxed amount so that rates like 6.625% (66250) are exact.
+// A rate limited to a product or ticket category only applies to those
+// tickets, otherwise it applies to every ticket sold. Multiple matching
+// rates are added together.
+type TaxRate struct {
+	ID               uint   `json:"id" gorm:"primary_key"`
+	MerchantID       string `json:"-" gorm:"index"`
+	Name             string `json:"name"`
+	Rate             int64  `json:"rate"`
+	ProductID        *uint  `json:"productId"`
+	TicketCategoryID *uint  `json:"ticketCategoryId"`
+}
+
+// Validate makes sure the rate is a sane percentage
+func (t *TaxRate) Validate() error {
+	if t.Rate < 0 || t.Rate > 1000000 {
+		return fmt.Errorf("tax %q: rate must be between 0 and 100%%", t.Name)
+	}
+	return nil
+}
+
+// Applies reports whether the rate covers a ticket for the product with
+// the given ticket category.
+func (t *TaxRate) Applies(productID, categoryID uint) bool {
+	if t.ProductID != nil && *t.ProductID != productID {
+		return false
+	}
+	if t.TicketCategoryID != nil && *t.TicketCategoryID != categoryID {
+		return false
+	}
+	return true
+}
+
+// Tax calculates this rate's tax on an amount
+func (t *TaxRate) Tax(amount Money) Money {
+	return amount.Fraction(t.Rate, 1000000)
+}
@@ -1,5 +1,11 @@
 package types
 
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
 type PassItem interface {
 	GetName() string
 	GetSku() string
@@ -7,3 +13,35 @@ type PassItem interface {
 	GetQuantity() uint
 	GetID() string
 }
+
+var skuRe = regexp.MustCompile(`^(\d+)([A-Z]+)(\d{10})(\d*)$`)
+
+// SkuInfo is the parsed form of a ticket sku, which is built by the front end
+// as the product id, the uppercased ticket category and the unix timestamp
+// of the departure. Anything after the timestamp is a reference to what was
+// booked, such as the id of a charter.
+type SkuInfo struct {
+	ProductID uint
+	Ticket    string
+	Time      time.Time
+	Ref       uint
+}
+
+// ParseSku splits a ticket sku into its pieces, returning false if the sku
+// isn't for a ticket (such as a fee line).
+func ParseSku(sku string) (SkuInfo, bool) {
+	res := skuRe.FindStringSubmatch(sku)
+	if res == nil {
+		return SkuInfo{}, false
+	}
+
+	pid, _ := strconv.ParseUint(res[1], 10, 32)
+	stamp, _ := strconv.ParseInt(res[3], 10, 64)
+	ref, _ := strconv.ParseUint(res[4], 10, 32)
+	return SkuInfo{
+		ProductID: uint(pid),
+		Ticket:    res[2],
+		Time:      time.Unix(stamp, 0).In(loc),
+		Ref:       uint(ref),
+	}, true
+}
@@ -0,0 +1,39 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSku(t *testing.T) {
+	tests := []struct {
+		sku  string
+		ok   bool
+		want SkuInfo
+	}{
+		{"12ADULT1593604800", true, SkuInfo{ProductID: 12, Ticket: "ADULT", Time: time.Unix(1593604800, 0)}},
+		{"3CHARTER159360480042", true, SkuInfo{ProductID: 3, Ticket: "CHARTER", Time: time.Unix(1593604800, 0), Ref: 42}},
+		{"12adult1593604800", false, SkuInfo{}},
+		{"12ADULT159360480", false, SkuInfo{}},
+		{"ADULT1593604800", false, SkuInfo{}},
+		{"FEE", false, SkuInfo{}},
+		{"ADDON-4-1593604800", false, SkuInfo{}},
+		{"", false, SkuInfo{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sku, func(t *testing.T) {
+			got, ok := ParseSku(tt.sku)
+			if ok != tt.ok {
+				t.Fatalf("ParseSku(%q) ok = %v, want %v", tt.sku, ok, tt.ok)
+			}
+			if got.ProductID != tt.want.ProductID || got.Ticket != tt.want.Ticket ||
+				!got.Time.Equal(tt.want.Time) || got.Ref != tt.want.Ref {
+				t.Errorf("ParseSku(%q) = %+v, want %+v", tt.sku, got, tt.want)
+			}
+			if ok && got.Time.Location() != loc {
+				t.Errorf("ParseSku(%q) time is in %s, want %s", tt.sku, got.Time.Location(), loc)
+			}
+		})
+	}
+}
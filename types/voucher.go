@@ -0,0 +1,99 @@
+package types
+
+import (
+	"crypto/rand"
+	"errors"
+	"time"
+)
+
+// The kinds of voucher
+const (
+	// VoucherGift is a gift card bought by a customer
+	VoucherGift = "gift"
+	// VoucherCredit is store credit issued by the merchant, for example
+	// instead of a refund when a trip is cancelled for weather
+	VoucherCredit = "credit"
+)
+
+// The kinds of voucher ledger entry
+const (
+	VoucherIssue  = "issue"
+	VoucherRedeem = "redeem"
+	VoucherVoid   = "void"
+	// VoucherHold is money set aside for a checkout that isn't paid yet
+	VoucherHold = "hold"
+)
+
+// Errors returned when a voucher can't be used
+var (
+	ErrVoucherNotFound = errors.New("voucher not found")
+	ErrVoucherExpired  = errors.New("voucher has expired")
+	ErrVoucherEmpty    = errors.New("voucher has no balance left")
+	ErrVoucherBalance  = errors.New("voucher balance is too low")
+	ErrVoucherHold     = errors.New("voucher hold not found")
+)
+
+// Voucher is a stored value code that can pay for bookings until its
+// Balance runs out or it expires.
+type Voucher struct {
+	ID         uint       `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	MerchantID string     `json:"-" gorm:"index"`
+	Code       string     `json:"code" gorm:"unique_index"`
+	Kind       string     `json:"kind"`
+	Amount     Money      `json:"amount" gorm:"type:bigint"`
+	Balance    Money      `json:"balance" gorm:"type:bigint"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	Email      string     `json:"email"`
+	Name       string     `json:"name"`
+	Note       string     `json:"note"`
+	// Provider and OrderID are the order a gift card was bought with
+	Provider string `json:"provider"`
+	OrderID  string `json:"orderId"`
+}
+
+// VoucherEntry is a single line of a voucher's ledger, Amount is positive
+// when value is added to the voucher and negative when it is spent.
+type VoucherEntry struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"createdAt"`
+	VoucherID uint      `json:"voucherId" gorm:"index"`
+	Kind      string    `json:"kind"`
+	Amount    Money     `json:"amount" gorm:"type:bigint"`
+	Provider  string    `json:"provider"`
+	OrderID   string    `json:"orderId"`
+	UserID    string    `json:"userId"`
+}
+
+// Usable checks that the voucher hasn't expired and still has a balance
+func (v *Voucher) Usable(now time.Time) error {
+	if v.ExpiresAt != nil && now.After(*v.ExpiresAt) {
+		return ErrVoucherExpired
+	}
+	if v.Balance.Cents <= 0 {
+		return ErrVoucherEmpty
+	}
+	return nil
+}
+
+// codeChars leaves out characters that are easily confused when a code
+// is read out over the phone
+const codeChars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// NewVoucherCode generates a random code like "7KQM-2XPA-R9DF"
+func NewVoucherCode() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, 0, 14)
+	for idx, b := range buf {
+		if idx > 0 && idx%4 == 0 {
+			code = append(code, '-')
+		}
+		code = append(code, codeChars[int(b)%len(codeChars)])
+	}
+	return string(code), nil
+}
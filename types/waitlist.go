@@ -0,0 +1,83 @@
+package types
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WaitlistHold is how long seats offered to someone on a waitlist are kept
+// for them to check out
+const WaitlistHold = 2 * time.Hour
+
+// The states of a place on a waitlist
+const (
+	WaitlistWaiting   = "waiting"
+	WaitlistOffered   = "offered"
+	WaitlistBooked    = "booked"
+	WaitlistExpired   = "expired"
+	WaitlistCancelled = "cancelled"
+)
+
+// Errors returned when joining a waitlist or using an offer from one
+var (
+	ErrWaitlistNotFound = errors.New("waitlist offer not found")
+	ErrWaitlistExpired  = errors.New("the seats offered from the waitlist are no longer held, please join again")
+	ErrWaitlistOpen     = errors.New("there are enough seats left to book this trip now")
+	ErrWaitlistParty    = errors.New("party size must be at least one")
+)
+
+// WaitlistEntry is a customer waiting for seats on a sold out departure.
+// When enough seats free up they are offered to the entries in Position
+// order and held until OfferUntil. The Code goes on the end of the skus of
+// the tickets bought with the offer so the held seats can be used.
+type WaitlistEntry struct {
+	ID         uint       `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	MerchantID string     `json:"-" gorm:"index"`
+	ProductID  uint       `json:"productId"`
+	Time       time.Time  `json:"time"`
+	Party      int        `json:"party"`
+	Name       string     `json:"name"`
+	Email      string     `json:"email"`
+	Phone      string     `json:"phone"`
+	Position   int        `json:"position"`
+	Status     string     `json:"status"`
+	Code       uint       `json:"-"`
+	OfferedAt  *time.Time `json:"offeredAt"`
+	OfferUntil *time.Time `json:"offerUntil"`
+	PayURL     string     `json:"-"`
+	Provider   string     `json:"provider"`
+	OrderID    string     `json:"orderId"`
+}
+
+// Holding reports whether the entry has seats held for it
+func (w *WaitlistEntry) Holding(now time.Time) bool {
+	return w.Status == WaitlistOffered && w.OfferUntil != nil && now.Before(*w.OfferUntil)
+}
+
+// Link is where the customer checks out with the seats offered to them
+func (w *WaitlistEntry) Link() string {
+	if w.PayURL == "" || w.Code == 0 {
+		return ""
+	}
+	sep := "?"
+	if strings.Contains(w.PayURL, "?") {
+		sep = "&"
+	}
+	return w.PayURL + sep + "waitlist=" + strconv.FormatUint(uint64(w.Code), 10)
+}
+
+// NewWaitlistCode generates the code for an offer, it is always nine digits
+// so it can't be mistaken for part of the timestamp in a sku
+func NewWaitlistCode() (uint, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(900000000))
+	if err != nil {
+		return 0, err
+	}
+	return uint(n.Int64()) + 100000000, nil
+}
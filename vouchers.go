@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/internal"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/stripe"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+func addVoucherRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.GET("/vouchers", checkJWT(), GetVouchers(db))
+	router.POST("/vouchers", checkJWT(), logActionMiddle(db), IssueVoucher(db))
+	router.GET("/vouchers/:code", GetVoucherBalance(db))
+	router.GET("/vouchers/:code/ledger", checkJWT(), GetVoucherLedger(db))
+	router.DELETE("/vouchers/:code", checkJWT(), logActionMiddle(db), VoidVoucher(db))
+	router.POST("/vouchers/checkout", VoucherCheckout(db))
+}
+
+// GetVouchers lists all of the merchant's vouchers, newest first
+func GetVouchers(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var out []types.Voucher
+		db.Order("created_at desc").Find(&out, "merchant_id = ?", c.Param("merchantid"))
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// IssueVoucher creates store credit for a customer, such as when a trip is
+// cancelled for weather, and emails them the code.
+func IssueVoucher(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var v types.Voucher
+		if err := c.ShouldBindJSON(&v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if v.Amount.Cents <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "voucher amount must be positive"})
+			return
+		}
+		if v.Kind == "" {
+			v.Kind = types.VoucherCredit
+		}
+
+		v.MerchantID = c.Param("merchantid")
+		v.Provider, v.OrderID = "", ""
+		if err := pricing.IssueVoucher(db, &v, c.GetString("user_id")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		recordChange(c, "voucher", v.ID, nil, &v)
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", v.MerchantID)
+		if err := internal.SendVoucherEmail(apiKey, &conf, v.Name, v.Email, []types.Voucher{v}); err != nil {
+			c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, v)
+	}
+}
+
+// GetVoucherBalance lets a customer check what is left on their voucher
+func GetVoucherBalance(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var v types.Voucher
+		if db.Where("merchant_id = ? AND code = ?", c.Param("merchantid"),
+			types.NormalizePromoCode(c.Param("code"))).First(&v).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": types.ErrVoucherNotFound.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"code": v.Code, "balance": v.Balance, "expiresAt": v.ExpiresAt})
+	}
+}
+
+// GetVoucherLedger returns every issue and redemption of a voucher
+func GetVoucherLedger(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var v types.Voucher
+		if db.Where("merchant_id = ? AND code = ?", c.Param("merchantid"),
+			types.NormalizePromoCode(c.Param("code"))).First(&v).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": types.ErrVoucherNotFound.Error()})
+			return
+		}
+
+		var entries []types.VoucherEntry
+		db.Order("created_at").Find(&entries, "voucher_id = ?", v.ID)
+		c.JSON(http.StatusOK, gin.H{"voucher": v, "entries": entries})
+	}
+}
+
+// VoidVoucher zeroes the balance of a voucher so it can't be used again
+func VoidVoucher(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var v types.Voucher
+		if db.Where("merchant_id = ? AND code = ?", c.Param("merchantid"),
+			types.NormalizePromoCode(c.Param("code"))).First(&v).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": types.ErrVoucherNotFound.Error()})
+			return
+		}
+
+		old := v
+		tx := db.Begin()
+		tx.Create(&types.VoucherEntry{
+			VoucherID: v.ID,
+			Kind:      types.VoucherVoid,
+			Amount:    v.Balance.Mul(-1),
+			UserID:    c.GetString("user_id"),
+		})
+		v.Balance = types.NewMoney(0, v.Balance.Currency)
+		tx.Model(&v).UpdateColumn("balance", v.Balance)
+		tx.Commit()
+
+		recordChange(c, "voucher", v.ID, &old, &v)
+		c.Status(http.StatusOK)
+	}
+}
+
+// VoucherCheckout books a cart that is paid for entirely by a voucher. The
+// order is stored with the merchant's payment provider's orders so it shows
+// up in manifests and boarding passes like any other.
+func VoucherCheckout(db *gorm.DB) gin.HandlerFunc {
+	type checkoutReq struct {
+		Cart    []pricing.CartItem `json:"cart" binding:"required"`
+		Voucher string             `json:"voucher" binding:"required"`
+		Promo   string             `json:"promo"`
+		Name    string             `json:"name"`
+		Email   string             `json:"email" binding:"required"`
+	}
+
+	return func(c *gin.Context) {
+		var req checkoutReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(req.Cart) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the cart is empty"})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		var (
+			opts pricing.Options
+			err  error
+		)
+		if opts.Promo, err = pricing.LoadPromo(db, conf.ID, req.Promo, req.Email); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if opts.Voucher, err = pricing.LoadVoucher(db, conf.ID, req.Voucher); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		cart, verr := pricing.ValidateCart(db, &conf, req.Cart)
+		if verr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": verr.Error(), "items": verr.Items})
+			return
+		}
+
+		quote := pricing.QuoteCart(db, &conf, cart, opts)
+		if len(quote.Lines) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the cart is empty"})
+			return
+		}
+		if quote.Due.Cents > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the voucher doesn't cover the whole order", "quote": quote})
+			return
+		}
+
+		code, err := types.NewVoucherCode()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		orderID := "VCH-" + code
+
+		// the promo code's use is held first so it can be given back if the
+		// voucher can't pay
+		var promoHold uint
+		if opts.Promo != nil && !quote.Discount.IsZero() {
+			hold, err := pricing.HoldPromo(db, opts.Promo, req.Email)
+			if err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			if hold != nil {
+				promoHold = hold.ID
+			}
+		}
+		if err := pricing.RedeemVoucher(db, opts.Voucher, quote.Credit, conf.PaymentType, orderID); err != nil {
+			if promoHold != 0 {
+				pricing.ReleasePromo(db, promoHold)
+			}
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if opts.Promo != nil && !quote.Discount.IsZero() {
+			if err := pricing.RedeemPromo(db, opts.Promo, promoHold, conf.PaymentType, orderID, req.Email, quote.Discount); err != nil {
+				log.Println("could not redeem promo code:", opts.Promo.Code, orderID, err)
+			}
+		}
+
+		skus := make([]string, 0, len(quote.Lines))
+		for _, line := range quote.Lines {
+			skus = append(skus, line.Sku)
+		}
+		pricing.BookCharters(db, conf.ID, conf.PaymentType, orderID, skus)
+		pricing.BookWaitlist(db, conf.ID, conf.PaymentType, orderID, skus)
+		if b := pricing.BalanceFor(conf.ID, quote); b != nil {
+			b.Provider, b.OrderID = conf.PaymentType, orderID
+			b.Email, b.Name = req.Email, req.Name
+			b.PayURL = c.Request.Header.Get("x-calendar-origin")
+			if b, err = pricing.OpenBalance(db, b); err != nil {
+				log.Println("could not open balance:", orderID, err)
+			} else if err := internal.SendBalanceEmail(apiKey, &conf, b, false); err != nil {
+				log.Println(err)
+			}
+		}
+
+		desc := "Paid by voucher " + quote.Voucher
+		var order *types.CheckoutOrder
+		switch conf.PaymentType {
+		case "stripe":
+			saveStripeOrder(db, &conf, orderID, req.Name, req.Email, quote)
+			// nothing went through Stripe checkout, so the customer gets the
+			// same confirmation as a PayPal order
+			order = quoteOrder(&conf, orderID, req.Name, req.Email, desc, quote)
+		default:
+			order = savePaypalOrder(db, &conf, orderID, req.Name, req.Email, desc, quote)
+		}
+		if _, err := SendClientMail(apiKey, c.Request.Host, req.Email, order, &conf, orderCalendar(db, &conf, order)); err != nil {
+			c.JSON(http.StatusFailedDependency, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"id": orderID, "quote": quote})
+	}
+}
+
+// saveStripeOrder stores an order that wasn't paid through Stripe with the
+// merchant's Stripe payments
+func saveStripeOrder(db *gorm.DB, conf *types.MerchantConfig, orderID, name, email string, quote *pricing.Quote) {
+	db.Save(&stripe.PaymentIntent{
+		ID:         orderID,
+		Acct:       conf.StripeKey,
+		CreatedAt:  time.Now(),
+		Amount:     quote.Due,
+		Fees:       quote.FeeTotal,
+		Tax:        quote.TaxTotal,
+		Discount:   quote.Discount,
+		Promo:      quote.Promo,
+		Credit:     quote.Credit,
+		Voucher:    quote.Voucher,
+		Balance:    quote.Balance,
+		Commission: quote.Commission,
+		Email:      email,
+		Name:       name,
+		Status:     "succeeded",
+	})
+
+	for idx, line := range quote.Lines {
+		db.Save(&stripe.LineItem{
+			ID:        fmt.Sprintf("%s-%d", orderID, idx),
+			PaymentID: orderID,
+			Acct:      conf.StripeKey,
+			Quantity:  int(line.Quantity),
+			Sku:       line.Sku,
+			Name:      line.Name,
+			UnitPrice: line.Unit.Sub(line.UnitDiscount),
+			Amount:    line.Total.Sub(line.Discount),
+			Tax:       line.Tax,
+			Discount:  line.Discount,
+		})
+	}
+}
+
+// savePaypalOrder stores an order that wasn't paid through PayPal with the
+// merchant's PayPal orders
+func savePaypalOrder(db *gorm.DB, conf *types.MerchantConfig, orderID, name, email, desc string, quote *pricing.Quote) *types.CheckoutOrder {
+	order := quoteOrder(conf, orderID, name, email, desc, quote)
+	db.Create(order)
+	return order
+}
+
+// quoteOrder is a quote as a completed PayPal order, which is also what the
+// confirmation email is sent from
+func quoteOrder(conf *types.MerchantConfig, orderID, name, email, desc string, quote *pricing.Quote) *types.CheckoutOrder {
+	payer := &types.Payer{ID: orderID, Email: email}
+	payer.Name.GivenName = name
+
+	unit := types.PurchaseUnit{Description: desc}
+	unit.Payee.MerchantID = conf.ID
+	unit.Amount.Value = quote.Due
+	unit.Amount.Breakdown.ItemTotal.Value = quote.Subtotal
+	unit.Amount.Breakdown.TaxTotal.Value = quote.TaxTotal
+	for _, line := range quote.Lines {
+		unit.Items = append(unit.Items, types.PurchaseItem{
+			Sku:         line.Sku,
+			Name:        line.Name,
+			Description: line.Desc,
+			Amount:      types.Amount{Value: line.Unit},
+			Tax:         types.Amount{Value: line.UnitTax},
+			Quantity:    uint(line.Quantity),
+		})
+	}
+
+	order := &types.CheckoutOrder{
+		ID:            orderID,
+		Intent:        "CAPTURE",
+		Status:        "COMPLETED",
+		PayerID:       payer.ID,
+		Payer:         payer,
+		PurchaseUnits: []types.PurchaseUnit{unit},
+		Fees:          quote.FeeTotal,
+		Tax:           quote.TaxTotal,
+		Discount:      quote.Discount,
+		PromoCode:     quote.Promo,
+		Credit:        quote.Credit,
+		Voucher:       quote.Voucher,
+		Balance:       quote.Balance,
+		Commission:    quote.Commission,
+	}
+	order.CreateTime = time.Now()
+	order.UpdateTime = order.CreateTime
+	return order
+}
+
+// runVoucherHolds gives back the voucher money and promo code uses held by
+// abandoned checkouts every hour until the context is cancelled.
+func runVoucherHolds(ctx context.Context, db *gorm.DB) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if n := pricing.ReleaseHolds(db, time.Now()); n > 0 {
+			log.Printf("%d voucher holds released", n)
+		}
+		if n := pricing.ReleasePromos(db, time.Now()); n > 0 {
+			log.Printf("%d promo code holds released", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/zeroshade/tmsapi/internal"
+	"github.com/zeroshade/tmsapi/pricing"
+	"github.com/zeroshade/tmsapi/types"
+)
+
+// waitlistSweep is how often lapsed offers are released and freed up seats
+// are offered to the people waiting for them
+const waitlistSweep = 5 * time.Minute
+
+func addWaitlistRoutes(router *gin.RouterGroup, db *gorm.DB) {
+	router.POST("/waitlist", JoinWaitlist(db))
+	router.GET("/waitlist/:code", GetWaitlistOffer(db))
+	router.DELETE("/waitlist/:id", checkJWT(), logActionMiddle(db), CancelWaitlist(db))
+	router.GET("/waitlists/:pid/:timestamp", checkJWT(), GetWaitlist(db))
+	router.PUT("/waitlists/:pid/:timestamp", checkJWT(), logActionMiddle(db), ReorderWaitlist(db))
+}
+
+// departureParams reads the product id and unix timestamp of a departure
+// from the path
+func departureParams(c *gin.Context) (uint, time.Time, error) {
+	pid, err := strconv.ParseUint(c.Param("pid"), 10, 32)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	ts, err := strconv.ParseInt(c.Param("timestamp"), 10, 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return uint(pid), time.Unix(ts, 0).In(timeloc), nil
+}
+
+// JoinWaitlist adds a customer to the waitlist of a sold out departure
+func JoinWaitlist(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req pricing.WaitlistRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+
+		w, err := pricing.JoinWaitlist(db, &conf, &req, c.Request.Header.Get("x-calendar-origin"))
+		switch err {
+		case nil:
+		case types.ErrWaitlistOpen:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, w)
+	}
+}
+
+// GetWaitlistOffer shows a customer the seats held for them by the code in
+// their offer link, the code goes on the end of the skus of their tickets
+func GetWaitlistOffer(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code, _ := strconv.ParseUint(c.Param("code"), 10, 32)
+		w, err := pricing.LoadOffer(db, c.Param("merchantid"), uint(code))
+		switch err {
+		case nil:
+		case types.ErrWaitlistNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"offer": w, "code": w.Code})
+	}
+}
+
+// CancelWaitlist takes someone off a waitlist by the id of their entry,
+// offering any seats they were holding to the next in line
+func CancelWaitlist(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var w types.WaitlistEntry
+		if db.Find(&w, "id = ? AND merchant_id = ?", c.Param("id"), c.Param("merchantid")).RecordNotFound() {
+			c.JSON(http.StatusNotFound, gin.H{"error": types.ErrWaitlistNotFound.Error()})
+			return
+		}
+
+		old := w
+		w.Status = types.WaitlistCancelled
+		db.Model(&w).Update("status", w.Status)
+		recordChange(c, "waitlist", w.ID, &old, &w)
+
+		if old.Status == types.WaitlistOffered {
+			var conf types.MerchantConfig
+			db.Find(&conf, "id = ?", w.MerchantID)
+			offerWaitlist(db, &conf, w.ProductID, w.Time)
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+// GetWaitlist lists everyone who joined the waitlist of a departure in the
+// order seats will be offered to them
+func GetWaitlist(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pid, t, err := departureParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var out []types.WaitlistEntry
+		db.Where("merchant_id = ? AND product_id = ? AND time = ?", c.Param("merchantid"), pid, t).
+			Order("position, id").Find(&out)
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// ReorderWaitlist moves the waitlist of a departure into the order of the
+// entry ids sent
+func ReorderWaitlist(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pid, t, err := departureParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var ids []uint
+		if err := c.ShouldBindJSON(&ids); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := pricing.ReorderWaitlist(db, c.Param("merchantid"), pid, t, ids); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		recordChange(c, "waitlist_order", c.Param("pid")+"@"+c.Param("timestamp"), nil, ids)
+
+		var conf types.MerchantConfig
+		db.Find(&conf, "id = ?", c.Param("merchantid"))
+		offerWaitlist(db, &conf, pid, t)
+		c.Status(http.StatusOK)
+	}
+}
+
+// offerWaitlist offers any free seats on a departure to its waitlist and
+// lets the people offered them know by email and text
+func offerWaitlist(db *gorm.DB, conf *types.MerchantConfig, productID uint, t time.Time) {
+	offered, err := pricing.OfferSeats(db, conf, productID, t)
+	if err != nil {
+		log.Println("could not offer waitlist seats:", productID, t, err)
+		return
+	}
+	if len(offered) == 0 {
+		return
+	}
+
+	var prod Product
+	db.Select("name").Find(&prod, "id = ?", productID)
+	for idx := range offered {
+		w := &offered[idx]
+		if err := internal.SendWaitlistEmail(apiKey, conf, w, prod.Name); err != nil {
+			log.Println("could not send waitlist offer:", w.ID, err)
+		}
+		if w.Phone != "" && conf.TwilioAcctSID != "" {
+			tw := internal.NewTwilio(conf.TwilioAcctSID, conf.TwilioAcctToken, conf.TwilioFromNumber)
+			tw.Send(w.Phone, "Seats have opened up on "+prod.Name+" "+w.Time.Format("Jan 2 3:04 PM")+
+				", book by "+w.OfferUntil.Format("3:04 PM")+": "+w.Link())
+		}
+	}
+}
+
+// runWaitlistOffers releases the seats of offers which weren't taken in time
+// and offers free seats to waitlists until the context is cancelled. This is
+// what picks up seats freed by refunds and expired holds.
+func runWaitlistOffers(ctx context.Context, db *gorm.DB) {
+	ticker := time.NewTicker(waitlistSweep)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if n := pricing.ExpireOffers(db, now); n > 0 {
+			log.Printf("%d waitlist offers expired", n)
+		}
+
+		for _, d := range pricing.WaitingDepartures(db, now) {
+			var conf types.MerchantConfig
+			db.Find(&conf, "id = ?", d.MerchantID)
+			offerWaitlist(db, &conf, d.ProductID, d.Time)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}